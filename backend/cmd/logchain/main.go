@@ -0,0 +1,46 @@
+// logchain 校验访问日志哈希链，链条完整时退出码为 0，发现断裂时为 1
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/database"
+	"siqian-admin/internal/logger"
+	sysservice "siqian-admin/internal/sys/service"
+)
+
+func main() {
+	cfg := config.Load()
+	if _, _, err := logger.Init(cfg.Log); err != nil {
+		slog.Error("日志初始化失败", "err", err)
+		os.Exit(1)
+	}
+
+	if cfg.AccessLog.ChainKey == "" {
+		slog.Error("未配置访问日志哈希链密钥 access_log.chain_key")
+		os.Exit(1)
+	}
+
+	db, err := database.InitDB(cfg)
+	if err != nil {
+		slog.Error("数据库连接失败", "err", err)
+		os.Exit(1)
+	}
+
+	report, err := sysservice.NewAccessLogChainService(db, cfg.AccessLog.ChainKey).Verify()
+	if err != nil {
+		slog.Error("校验哈希链失败", "err", err)
+		os.Exit(1)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	if !report.Valid {
+		slog.Error("哈希链断裂", "log_id", report.Broken.LogID, "reason", report.Broken.Reason)
+		os.Exit(1)
+	}
+	slog.Info("哈希链完整", "checked", report.Checked)
+}
@@ -1,38 +1,103 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
 	"siqian-admin/internal/config"
 	"siqian-admin/internal/database"
-	"siqian-admin/internal/middleware"
+	"siqian-admin/internal/logger"
 	"siqian-admin/internal/router"
+	sysservice "siqian-admin/internal/sys/service"
+	"siqian-admin/internal/tracing"
+	"syscall"
+	"time"
 )
 
 func main() {
 	// 加载配置
 	cfg := config.Load()
 
+	// 初始化日志，之后各模块通过 slog 输出
+	_, logCloser, err := logger.Init(cfg.Log)
+	if err != nil {
+		slog.Error("日志初始化失败", "err", err)
+		os.Exit(1)
+	}
+	defer logCloser.Close()
+
+	// 初始化链路追踪，需在数据库、Redis 与路由之前完成
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("链路追踪初始化失败", "err", err)
+		os.Exit(1)
+	}
+
+	// 哈希链密钥只保存在配置中，缺失时无法为访问日志签名
+	if cfg.AccessLog.ChainKey == "" {
+		slog.Error("未配置访问日志哈希链密钥 access_log.chain_key")
+		os.Exit(1)
+	}
+
 	// 初始化数据库连接
 	db, err := database.InitDB(cfg)
 	if err != nil {
-		log.Fatal("数据库连接失败:", err)
+		slog.Error("数据库连接失败", "err", err)
+		os.Exit(1)
 	}
 
 	// 初始化Redis连接
 	rdb, err := database.InitRedis(cfg)
 	if err != nil {
-		log.Fatal("Redis连接失败:", err)
+		slog.Error("Redis连接失败", "err", err)
+		os.Exit(1)
 	}
 
-	// 创建路由
-	r := router.SetupRouter(cfg, db, rdb)
+	// 访问日志后台批量写入
+	accessLogWriter := sysservice.NewAccessLogWriter(db, cfg.AccessLog)
+	go accessLogWriter.Run()
 
-	// 添加中间件
-	middleware.SetupMiddleware(r, cfg)
+	// 后台任务（过期授权清理等）随该 context 在退出时停止
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// 创建路由
+	r, err := router.SetupRouter(bgCtx, cfg, db, rdb, accessLogWriter)
+	if err != nil {
+		slog.Error("路由初始化失败", "err", err)
+		os.Exit(1)
+	}
 
 	// 启动服务器
-	log.Printf("服务器启动在端口 %s", cfg.Server.Port)
-	if err := r.Run(":" + cfg.Server.Port); err != nil {
-		log.Fatal("服务器启动失败:", err)
+	srv := &http.Server{Addr: ":" + cfg.Server.Port, Handler: r}
+	go func() {
+		slog.Info("服务器启动", "port", cfg.Server.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("服务器启动失败", "err", err)
+			os.Exit(1)
+		}
+	}()
+
+	// 收到退出信号后停止接收请求，并写完队列中的访问日志
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	slog.Info("正在关闭服务器")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("服务器关闭失败", "err", err)
+	}
+	stopBackground()
+	if err := accessLogWriter.Close(ctx); err != nil {
+		slog.Error("访问日志写入未完成", "err", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("链路追踪数据上报未完成", "err", err)
 	}
+	slog.Info("服务器已退出")
 }
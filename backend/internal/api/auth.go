@@ -1,27 +1,49 @@
 package api
 
 import (
-	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
-	"siqian-admin/internal/config"
+	"siqian-admin/internal/metrics"
 	"siqian-admin/internal/service"
+	"siqian-admin/internal/sys/model"
 	sysservice "siqian-admin/internal/sys/service"
-	"siqian-admin/internal/utils"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
 )
 
 type AuthHandler struct {
-	authService *service.AuthService
-	menuService *sysservice.MenuService
-	rdb         *redis.Client
+	authService      *service.AuthService
+	userService      *sysservice.UserService
+	menuService      *sysservice.MenuService
+	sessionService   *service.SessionService
+	twoFactorService *service.TwoFactorService
+	loginGuard       *service.LoginGuardService
+	loginLogService  *sysservice.LoginLogService
 }
 
-func NewAuthHandler(authService *service.AuthService, menuService *sysservice.MenuService, rdb *redis.Client) *AuthHandler {
-	return &AuthHandler{authService: authService, menuService: menuService, rdb: rdb}
+func NewAuthHandler(authService *service.AuthService, userService *sysservice.UserService, menuService *sysservice.MenuService, sessionService *service.SessionService, twoFactorService *service.TwoFactorService, loginGuard *service.LoginGuardService, loginLogService *sysservice.LoginLogService) *AuthHandler {
+	return &AuthHandler{
+		authService:      authService,
+		userService:      userService,
+		menuService:      menuService,
+		sessionService:   sessionService,
+		twoFactorService: twoFactorService,
+		loginGuard:       loginGuard,
+		loginLogService:  loginLogService,
+	}
+}
+
+// recordEvent 记录登录历史与安全事件
+func (h *AuthHandler) recordEvent(c *gin.Context, entry model.LoginLog) {
+	entry.IP = c.ClientIP()
+	entry.UserAgent = c.Request.UserAgent()
+	h.loginLogService.Record(c.Request.Context(), entry)
+	if entry.Event == model.LoginEventLogin {
+		metrics.ObserveLogin(entry.Result)
+	}
 }
 
 type LoginRequest struct {
@@ -29,6 +51,21 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type LoginTwoFactorRequest struct {
+	Ticket       string `json:"ticket" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type ChangeExpiredPasswordRequest struct {
+	Ticket      string `json:"ticket" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -36,43 +73,190 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authService.Login(req.Username, req.Password)
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+
+	// 用户名或 IP 处于锁定期时直接拒绝，不再校验密码
+	if err := h.loginGuard.Check(ctx, req.Username, ip); err != nil {
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			h.recordEvent(c, model.LoginLog{Username: req.Username, Event: model.LoginEventLogin, Result: model.LoginResultFailure, Reason: locked.Error()})
+			c.Header("Retry-After", locked.RetryAfterSeconds())
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": locked.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "登录锁定检查失败", "err", err)
+	}
+
+	user, err := h.authService.WithContext(c.Request.Context()).Login(req.Username, req.Password)
 	if err != nil {
+		if !errors.Is(err, service.ErrInvalidCredentials) {
+			slog.ErrorContext(c.Request.Context(), "登录查询失败", "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+			return
+		}
+		h.recordEvent(c, model.LoginLog{Username: req.Username, Event: model.LoginEventLogin, Result: model.LoginResultFailure, Reason: err.Error()})
+		h.recordLoginFailure(c, req.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 生成JWT令牌
-	cfg := config.GetConfig()
-	token, err := utils.GenerateJWT(user.ID, user.Username, cfg)
+	// 启用或被角色要求两步验证：返回登录票据，由 /auth/login/2fa 完成登录。
+	// 失败计数要等第二步通过后才清空，否则可用已知密码反复重置计数来爆破验证码
+	if h.twoFactorService.NeedsChallenge(user) {
+		challenge, err := h.twoFactorService.CreateChallenge(c.Request.Context(), user)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "两步验证票据生成失败", "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"two_factor_required": true, "challenge": challenge})
+		return
+	}
+
+	h.recordLoginSuccess(c, user.Username)
+	h.completeLogin(c, user, nil)
+}
+
+// LoginTwoFactor 两步登录第二步：票据 + 验证码（或恢复码）换取会话
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req LoginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入验证码或恢复码"})
+		return
+	}
+
+	// 第二步同样受 IP 锁定约束；用户名锁定在签发票据前已检查，票据本身也有尝试次数上限
+	if err := h.loginGuard.CheckIP(c.Request.Context(), c.ClientIP()); err != nil {
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			c.Header("Retry-After", locked.RetryAfterSeconds())
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": locked.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "登录锁定检查失败", "err", err)
+	}
+
+	user, recoveryCodes, err := h.twoFactorService.VerifyChallenge(c.Request.Context(), req.Ticket, req.Code, req.RecoveryCode)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "令牌生成失败"})
+		if errors.Is(err, service.ErrTwoFactorCodeInvalid) && user != nil {
+			h.recordEvent(c, model.LoginLog{UserID: user.ID, Username: user.Username, Event: model.LoginEventLogin, Result: model.LoginResultFailure, Reason: err.Error()})
+			h.recordLoginFailure(c, user.Username)
+		}
+		if errors.Is(err, service.ErrTwoFactorTicketInvalid) || errors.Is(err, service.ErrTwoFactorCodeInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "两步验证失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		return
+	}
+
+	h.recordLoginSuccess(c, user.Username)
+	h.completeLogin(c, user, recoveryCodes)
+}
+
+// recordLoginFailure 密码或验证码错误时按用户名与 IP 累计失败次数，并施加渐进延迟
+func (h *AuthHandler) recordLoginFailure(c *gin.Context, username string) {
+	ctx := c.Request.Context()
+	delay, err := h.loginGuard.RecordFailure(ctx, username, c.ClientIP())
+	if err != nil {
+		slog.ErrorContext(ctx, "登录失败计数写入失败", "err", err)
+	}
+	// 渐进延迟：连续失败越多，响应越慢
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+}
+
+// recordLoginSuccess 全部验证通过后清空该用户名的失败计数
+func (h *AuthHandler) recordLoginSuccess(c *gin.Context, username string) {
+	if err := h.loginGuard.RecordSuccess(c.Request.Context(), username); err != nil {
+		slog.ErrorContext(c.Request.Context(), "登录失败计数清理失败", "err", err)
+	}
+}
+
+// ChangeExpiredPassword 密码过期时凭改密票据设置新密码，成功后直接登录
+func (h *AuthHandler) ChangeExpiredPassword(c *gin.Context) {
+	var req ChangeExpiredPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID, err := h.sessionService.PasswordChangeTicketUser(ctx, req.Ticket)
+	if err != nil {
+		if errors.Is(err, service.ErrPasswordTicketInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "读取改密票据失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+
+	if err := h.userService.WithContext(c.Request.Context()).ChangePassword(userID, req.NewPassword); err != nil {
+		var policyErr *sysservice.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Error(), "violations": policyErr.Violations})
+			return
+		}
+		h.recordEvent(c, model.LoginLog{UserID: userID, Event: model.LoginEventPasswordChange, Result: model.LoginResultFailure, Reason: err.Error()})
+		slog.ErrorContext(c.Request.Context(), "过期密码修改失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+	h.recordEvent(c, model.LoginLog{UserID: userID, Event: model.LoginEventPasswordChange, Result: model.LoginResultSuccess, Reason: "密码过期修改"})
+	if err := h.sessionService.DeletePasswordChangeTicket(ctx, req.Ticket); err != nil {
+		slog.ErrorContext(c.Request.Context(), "改密票据删除失败", "err", err)
+	}
+
+	user, err := h.userService.WithContext(c.Request.Context()).GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		return
+	}
+	h.completeLogin(c, user, nil)
+}
+
+// completeLogin 签发会话并返回令牌、用户与菜单；密码已过期时只返回改密票据
+func (h *AuthHandler) completeLogin(c *gin.Context, user *model.User, recoveryCodes []string) {
+	if sysservice.PasswordExpired(user) {
+		h.respondPasswordExpired(c, user.ID, user.Username, model.LoginEventLogin, recoveryCodes)
 		return
 	}
 
 	// menus 随 token 一起返回
-	menus, err := h.menuService.GetUserMenus(user.ID)
+	menus, err := h.menuService.WithContext(c.Request.Context()).GetUserMenus(user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户菜单失败"})
 		return
 	}
 
-	// 将 token 写入 Redis 白名单，TTL 与 token 剩余有效期对齐
-	if h.rdb != nil {
-		if ttl, err := utils.RemainingTTL(token); err == nil {
-			key := "jwt:whitelist:" + token
-			b, _ := json.Marshal(gin.H{"menus": menus, "user": user})
-			if err := h.rdb.Set(c.Request.Context(), key, b, ttl).Err(); err != nil {
-				// 仅记录，不阻断登录
-				fmt.Printf("登录白名单写入失败: %v\n", err)
-			}
-		} else {
-			fmt.Printf("计算 token TTL 失败: %v\n", err)
-		}
+	// 签发访问令牌 + 刷新令牌，并写入 Redis 白名单
+	pair, err := h.sessionService.CreateSession(c.Request.Context(), user, menus, service.ClientMeta{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "登录会话创建失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "令牌生成失败"})
+		return
 	}
+	h.recordEvent(c, model.LoginLog{UserID: user.ID, Username: user.Username, Event: model.LoginEventLogin, Result: model.LoginResultSuccess, SessionID: pair.SessionID})
 
 	resp := gin.H{
-		"token": token,
+		"token":              pair.AccessToken,
+		"refresh_token":      pair.RefreshToken,
+		"expires_in":         pair.ExpiresIn,
+		"refresh_expires_in": pair.RefreshExpiresIn,
+		"menus_version":      pair.MenusVersion,
 		"user": gin.H{
 			"id":        user.ID,
 			"username":  user.Username,
@@ -84,21 +268,95 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	if menus != nil {
 		resp["menus"] = menus
 	}
+	// 登录时完成强制绑定的，恢复码仅在此返回一次
+	if len(recoveryCodes) > 0 {
+		resp["recovery_codes"] = recoveryCodes
+	}
 	c.JSON(http.StatusOK, resp)
 }
 
+// respondPasswordExpired 密码已过期：不签发会话，只返回改密票据，登录与刷新返回相同的结构
+func (h *AuthHandler) respondPasswordExpired(c *gin.Context, userID int64, username, event string, recoveryCodes []string) {
+	ticket, err := h.sessionService.CreatePasswordChangeTicket(c.Request.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "改密票据生成失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		return
+	}
+	h.recordEvent(c, model.LoginLog{UserID: userID, Username: username, Event: event, Result: model.LoginResultFailure, Reason: "密码已过期"})
+	resp := gin.H{
+		"password_expired": true,
+		"change_ticket":    ticket,
+		"message":          service.ErrPasswordExpired.Error(),
+	}
+	if len(recoveryCodes) > 0 {
+		resp["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Refresh 轮换刷新令牌，返回新的令牌对
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pair, err := h.sessionService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		var reused *service.RefreshReusedError
+		if errors.As(err, &reused) {
+			h.recordEvent(c, model.LoginLog{UserID: reused.UserID, Event: model.LoginEventRefresh, Result: model.LoginResultFailure, Reason: err.Error(), SessionID: reused.SessionID})
+		}
+		var expired *service.PasswordExpiredError
+		if errors.As(err, &expired) {
+			h.respondPasswordExpired(c, expired.UserID, expired.Username, model.LoginEventRefresh, nil)
+			return
+		}
+		if errors.Is(err, service.ErrRefreshTokenInvalid) || errors.Is(err, service.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "刷新令牌失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刷新令牌失败"})
+		return
+	}
+	h.recordEvent(c, model.LoginLog{UserID: pair.UserID, Username: pair.Username, Event: model.LoginEventRefresh, Result: model.LoginResultSuccess, SessionID: pair.SessionID})
+
+	c.JSON(http.StatusOK, pair)
+}
+
 func (h *AuthHandler) Logout(c *gin.Context) {
-	// 从 Authorization 头提取 token 并从白名单移除
+	// 从 Authorization 头提取 token，注销其所属会话
 	authHeader := c.GetHeader("Authorization")
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	if tokenString == "" || tokenString == authHeader {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供有效令牌"})
 		return
 	}
-	if h.rdb != nil {
-		if err := h.rdb.Del(c.Request.Context(), "jwt:whitelist:"+tokenString).Err(); err != nil {
-			fmt.Printf("退出白名单删除失败: %v\n", err)
-		}
+	// 注销前读取会话，令牌已失效时不记录
+	snapshot, _ := h.sessionService.GetSnapshot(c.Request.Context(), tokenString)
+	if err := h.sessionService.RevokeByAccessToken(c.Request.Context(), tokenString); err != nil {
+		slog.ErrorContext(c.Request.Context(), "退出会话注销失败", "err", err)
+	}
+	if snapshot != nil && snapshot.User != nil {
+		h.recordEvent(c, model.LoginLog{UserID: snapshot.User.ID, Username: snapshot.User.Username, Event: model.LoginEventLogout, Result: model.LoginResultSuccess, SessionID: snapshot.SessionID})
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "退出成功"})
 }
+
+// Menus 返回当前会话最新的菜单与版本号，客户端在 X-Menus-Version 变化后调用
+func (h *AuthHandler) Menus(c *gin.Context) {
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	snapshot, err := h.sessionService.GetSnapshot(c.Request.Context(), tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证或会话失效"})
+		return
+	}
+	menus := snapshot.Menus
+	if menus == nil {
+		menus = []model.Menu{}
+	}
+	c.JSON(http.StatusOK, gin.H{"menus": menus, "menus_version": snapshot.MenusVersion})
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"siqian-admin/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// healthCheckTimeout 单项依赖检查的超时
+const healthCheckTimeout = 2 * time.Second
+
+// migrationCheckInterval 迁移检查通过后的缓存时间；表结构只在发布时变化，不必每次探针都查询，
+// 定期复查以发现跨月后缺少的访问日志分区
+const migrationCheckInterval = 5 * time.Minute
+
+// 就绪检查状态
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusDegraded = "degraded" // 非关键依赖异常，仍可接收流量
+	HealthStatusDown     = "down"     // 关键依赖异常
+)
+
+// DependencyStatus 单项依赖的检查结果
+type DependencyStatus struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"` // 关键依赖异常时 /readyz 返回 503
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type healthCheck struct {
+	name     string
+	critical bool
+	check    func(ctx context.Context) error
+}
+
+type HealthHandler struct {
+	checks []healthCheck
+}
+
+func NewHealthHandler(db *gorm.DB, rdb *redis.Client, uploadDir string) *HealthHandler {
+	return &HealthHandler{checks: []healthCheck{
+		{name: "postgres", critical: true, check: func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		}},
+		{name: "redis", critical: true, check: func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		}},
+		{name: "migrations", critical: true, check: cachedCheck(migrationCheckInterval, func(ctx context.Context) error {
+			return database.CheckMigrations(ctx, db)
+		})},
+		// 上传目录不可写只影响头像上传，不摘除流量
+		{name: "upload_dir", critical: false, check: func(ctx context.Context) error {
+			return checkWritableDir(uploadDir)
+		}},
+	}}
+}
+
+// Healthz 存活探针：进程能处理请求即返回 200，不检查外部依赖，避免依赖故障导致 Pod 被反复重启
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": HealthStatusOK})
+}
+
+// Readyz 就绪探针：并发检查各依赖，返回各项状态与耗时；关键依赖异常时返回 503
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	results := make(map[string]DependencyStatus, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, hc := range h.checks {
+		wg.Add(1)
+		go func(hc healthCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := hc.check(ctx)
+			res := DependencyStatus{
+				Status:    HealthStatusOK,
+				Critical:  hc.critical,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				res.Status = HealthStatusDown
+				// 错误详情可能含表名、地址等内部信息，探针接口无需鉴权，只返回通用提示，详情写日志
+				res.Error = "检查失败"
+				slog.WarnContext(c.Request.Context(), "就绪检查失败", "dependency", hc.name, "err", err)
+			}
+			mu.Lock()
+			results[hc.name] = res
+			mu.Unlock()
+		}(hc)
+	}
+	wg.Wait()
+
+	status, code := HealthStatusOK, http.StatusOK
+	for _, res := range results {
+		if res.Status == HealthStatusOK {
+			continue
+		}
+		if res.Critical {
+			status, code = HealthStatusDown, http.StatusServiceUnavailable
+			break
+		}
+		status = HealthStatusDegraded
+	}
+	c.JSON(code, gin.H{"status": status, "checks": results})
+}
+
+// cachedCheck 检查通过后在 ttl 内直接返回成功，失败不缓存；并发的探针排队，不会同时发起检查
+func cachedCheck(ttl time.Duration, check func(ctx context.Context) error) func(ctx context.Context) error {
+	var mu sync.Mutex
+	var okAt time.Time
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !okAt.IsZero() && time.Since(okAt) < ttl {
+			return nil
+		}
+		if err := check(ctx); err != nil {
+			return err
+		}
+		okAt = time.Now()
+		return nil
+	}
+}
+
+// checkWritableDir 在目录中创建并删除一个临时文件
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s 不是目录", dir)
+	}
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCachedCheck(t *testing.T) {
+	var calls int
+	var fail bool
+	check := cachedCheck(time.Hour, func(ctx context.Context) error {
+		calls++
+		if fail {
+			return errors.New("缺少字段")
+		}
+		return nil
+	})
+	ctx := context.Background()
+
+	// 失败不缓存，每次都重新检查
+	fail = true
+	for i := 0; i < 2; i++ {
+		if err := check(ctx); err == nil {
+			t.Fatal("检查失败时应返回错误")
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("失败时检查次数 = %d，期望 2", calls)
+	}
+
+	// 通过后在有效期内直接返回成功
+	fail = false
+	for i := 0; i < 3; i++ {
+		if err := check(ctx); err != nil {
+			t.Fatalf("检查通过后返回错误: %v", err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("通过后检查次数 = %d，期望 3", calls)
+	}
+
+	expired := cachedCheck(0, func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+	calls = 0
+	_ = expired(ctx)
+	_ = expired(ctx)
+	if calls != 2 {
+		t.Errorf("缓存过期后检查次数 = %d，期望 2", calls)
+	}
+}
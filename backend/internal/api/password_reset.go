@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"siqian-admin/internal/service"
+	"siqian-admin/internal/sys/model"
+	sysservice "siqian-admin/internal/sys/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resetMailTimeout 后台查询账户并发送重置邮件的超时
+const resetMailTimeout = 30 * time.Second
+
+type PasswordResetHandler struct {
+	resetService    *service.PasswordResetService
+	loginLogService *sysservice.LoginLogService
+	pending         chan struct{} // 后台发信任务的信号量，限制同时进行的数量
+}
+
+func NewPasswordResetHandler(resetService *service.PasswordResetService, loginLogService *sysservice.LoginLogService, maxPending int) *PasswordResetHandler {
+	if maxPending <= 0 {
+		maxPending = 1
+	}
+	return &PasswordResetHandler{resetService: resetService, loginLogService: loginLogService, pending: make(chan struct{}, maxPending)}
+}
+
+type ForgotPasswordRequest struct {
+	Account string `json:"account" binding:"required"` // 用户名或邮箱
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ForgotPassword 发送密码重置邮件，无论账户是否存在都返回相同结果
+func (h *PasswordResetHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 先按 IP 限流，再占用后台任务名额，匿名请求无法堆积任意多的后台任务
+	if err := h.resetService.CheckIP(c.Request.Context(), c.ClientIP()); err != nil {
+		var limited *service.ResetRateLimitedError
+		if errors.As(err, &limited) {
+			c.Header("Retry-After", limited.RetryAfterSeconds())
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": limited.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "重置请求限流检查失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "发送失败，请稍后再试"})
+		return
+	}
+	select {
+	case h.pending <- struct{}{}:
+	default:
+		slog.WarnContext(c.Request.Context(), "重置邮件后台任务已满，丢弃请求")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务繁忙，请稍后再试"})
+		return
+	}
+
+	// 查询账户与发信都在后台进行，响应耗时与账户是否存在无关；沿用请求 ID 等值但不随请求结束取消
+	ctx := context.WithoutCancel(c.Request.Context())
+	go func() {
+		defer func() { <-h.pending }()
+		ctx, cancel := context.WithTimeout(ctx, resetMailTimeout)
+		defer cancel()
+		if err := h.resetService.RequestReset(ctx, req.Account); err != nil {
+			slog.ErrorContext(ctx, "发送重置邮件失败", "err", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "如果该账户存在且已绑定邮箱，重置邮件已发送，请查收"})
+}
+
+// ResetPassword 使用邮件中的一次性令牌设置新密码
+func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := h.resetService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword)
+	if userID != 0 {
+		entry := model.LoginLog{UserID: userID, Event: model.LoginEventPasswordChange, Result: model.LoginResultSuccess, Reason: "邮件重置", IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+		if err != nil {
+			entry.Result, entry.Reason = model.LoginResultFailure, "邮件重置: "+err.Error()
+		}
+		h.loginLogService.Record(c.Request.Context(), entry)
+	}
+	if err != nil {
+		var policyErr *sysservice.PasswordPolicyError
+		switch {
+		case errors.As(err, &policyErr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Error(), "violations": policyErr.Violations})
+		case errors.Is(err, service.ErrResetTokenInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			slog.ErrorContext(c.Request.Context(), "重置密码失败", "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码已重置，请使用新密码登录"})
+}
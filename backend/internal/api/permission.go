@@ -0,0 +1,199 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"siqian-admin/internal/middleware"
+	"siqian-admin/internal/service"
+	"siqian-admin/internal/sys/model"
+	sysservice "siqian-admin/internal/sys/service"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PermissionHandler struct {
+	permissions      middleware.RoutePermissions
+	sessionService   *service.SessionService
+	roleService      *sysservice.RoleService
+	roleGrantService *sysservice.RoleGrantService
+	dataScopeService *sysservice.DataScopeService
+}
+
+func NewPermissionHandler(permissions middleware.RoutePermissions, sessionService *service.SessionService, roleService *sysservice.RoleService, roleGrantService *sysservice.RoleGrantService, dataScopeService *sysservice.DataScopeService) *PermissionHandler {
+	return &PermissionHandler{
+		permissions:      permissions,
+		sessionService:   sessionService,
+		roleService:      roleService,
+		roleGrantService: roleGrantService,
+		dataScopeService: dataScopeService,
+	}
+}
+
+// List 列出全部已登记的权限码及对应路由，供菜单/按钮绑定权限标识
+func (h *PermissionHandler) List(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": h.permissions.Codes()})
+}
+
+// SnapshotExplain 某个访问令牌缓存的会话快照上的判定结果，以及与数据库的差异
+type SnapshotExplain struct {
+	SessionID          string                        `json:"session_id"`
+	MenusVersion       int64                         `json:"menus_version"`
+	Decision           middleware.PermissionDecision `json:"decision"`
+	Stale              bool                          `json:"stale"`               // 快照与数据库计算结果不一致
+	MissingPermissions []string                      `json:"missing_permissions"` // 数据库中有、快照中没有
+	ExtraPermissions   []string                      `json:"extra_permissions"`   // 快照中有、数据库中已没有
+	MissingRoles       []string                      `json:"missing_roles"`
+	ExtraRoles         []string                      `json:"extra_roles"`
+}
+
+// Explain 解释某用户对权限码或路由的判定：
+// GET /permissions/explain?user_id=1&permission=user:update 或 ?user_id=1&method=PUT&path=/api/v1/users/2
+func (h *PermissionHandler) Explain(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	need := strings.TrimSpace(c.Query("permission"))
+	route := ""
+	if need == "" {
+		method := strings.ToUpper(strings.TrimSpace(c.Query("method")))
+		path := strings.TrimSpace(c.Query("path"))
+		if method == "" || path == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请提供 permission，或同时提供 method 与 path"})
+			return
+		}
+		var ok bool
+		if route, need, ok = h.permissions.Match(method, path); !ok {
+			// 与 PermissionMiddleware 一致：未声明的路由一律拒绝
+			c.JSON(http.StatusOK, gin.H{
+				"user_id":  strconv.FormatInt(userID, 10),
+				"route":    middleware.RouteKey(method, path),
+				"decision": middleware.PermissionDecision{Reason: middleware.DecisionUndeclared},
+			})
+			return
+		}
+	}
+
+	if !h.userInScope(c, userID) {
+		return
+	}
+
+	user, menus, err := h.sessionService.LoadPermissionState(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在或已禁用"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加载用户权限失败"})
+		return
+	}
+	decision := middleware.Decide(need, user, menus)
+
+	var trace *sysservice.PermissionTrace
+	if need != middleware.PermissionPublic && need != middleware.PermissionLogin {
+		if trace, err = h.roleService.WithContext(c.Request.Context()).TracePermission(userID, need); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "追溯权限来源失败"})
+			return
+		}
+	}
+	grants, err := h.roleGrantService.WithContext(c.Request.Context()).ListUserGrants(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取角色授权失败"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	version, err := h.sessionService.MenusVersion(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取会话信息失败"})
+		return
+	}
+	snapshots, err := h.sessionService.UserSnapshots(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取会话信息失败"})
+		return
+	}
+	sessions := make([]SnapshotExplain, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		sessions = append(sessions, explainSnapshot(need, user, menus, snapshot))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":       strconv.FormatInt(userID, 10),
+		"username":      user.Username,
+		"route":         route,
+		"permission":    need,
+		"decision":      decision,
+		"trace":         trace,
+		"grants":        grants,
+		"menus_version": version,
+		"sessions":      sessions,
+	})
+}
+
+// userInScope 只能排查数据权限范围内的用户
+func (h *PermissionHandler) userInScope(c *gin.Context, userID int64) bool {
+	scope, err := h.dataScopeService.WithContext(c.Request.Context()).Resolve(c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析数据权限失败"})
+		return false
+	}
+	visible, err := h.dataScopeService.WithContext(c.Request.Context()).ContainsUser(scope, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "校验数据权限失败"})
+		return false
+	}
+	if !visible {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在或已禁用"})
+		return false
+	}
+	return true
+}
+
+func explainSnapshot(need string, user *model.User, menus []model.Menu, snapshot service.SessionSnapshot) SnapshotExplain {
+	result := SnapshotExplain{
+		SessionID:    snapshot.SessionID,
+		MenusVersion: snapshot.MenusVersion,
+		Decision:     middleware.Decide(need, snapshot.User, snapshot.Menus),
+	}
+	result.MissingPermissions, result.ExtraPermissions = diffKeys(middleware.MenuPermissions(menus), middleware.MenuPermissions(snapshot.Menus))
+	result.MissingRoles, result.ExtraRoles = diffKeys(roleCodes(user), roleCodes(snapshot.User))
+	result.Stale = len(result.MissingPermissions) > 0 || len(result.ExtraPermissions) > 0 ||
+		len(result.MissingRoles) > 0 || len(result.ExtraRoles) > 0
+	return result
+}
+
+func roleCodes(user *model.User) map[string]struct{} {
+	codes := map[string]struct{}{}
+	if user == nil {
+		return codes
+	}
+	for _, role := range user.Roles {
+		codes[role.Code] = struct{}{}
+	}
+	return codes
+}
+
+// diffKeys 返回 want 中有而 got 中没有的键，以及 got 中多出的键
+func diffKeys(want, got map[string]struct{}) (missing, extra []string) {
+	missing, extra = []string{}, []string{}
+	for k := range want {
+		if _, ok := got[k]; !ok {
+			missing = append(missing, k)
+		}
+	}
+	for k := range got {
+		if _, ok := want[k]; !ok {
+			extra = append(extra, k)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
@@ -0,0 +1,433 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"siqian-admin/internal/sys/model"
+	"siqian-admin/internal/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 需要审计的表及其实体类型
+var entityTypes = map[string]string{
+	"sys_users":              "user",
+	"sys_roles":              "role",
+	"sys_menus":              "menu",
+	"sys_organizations":      "organization",
+	"sys_dicts":              "dict",
+	"sys_dict_items":         "dict_item",
+	"sys_user_roles":         "user_role",
+	"sys_user_organizations": "user_organization",
+	"sys_role_menus":         "role_menu",
+	"sys_role_data_scopes":   "role_data_scope",
+}
+
+// 敏感字段只记录“发生了变化”，不记录内容
+var maskedColumns = map[string]bool{
+	"password":          true,
+	"password_hash":     true,
+	"two_factor_secret": true,
+}
+
+// 每次写入都会变化或属于登录行为的字段，不计入差异
+var ignoredColumns = map[string]bool{
+	"created_at":    true,
+	"updated_at":    true,
+	"last_login_at": true,
+}
+
+const (
+	maskedValue   = "******"
+	beforeRowsKey = "audit:before_rows"
+)
+
+// Operator 发起变更的操作人，通过 context 传递到 GORM 回调
+type Operator struct {
+	ID       int64
+	Username string
+	IP       string
+}
+
+type operatorKey struct{}
+
+// WithOperator 在 context 中记录操作人，服务层以 db.WithContext(ctx) 执行的写操作会归属到该操作人
+func WithOperator(ctx context.Context, op Operator) context.Context {
+	return context.WithValue(ctx, operatorKey{}, op)
+}
+
+// OperatorFrom 读取 context 中的操作人，没有时视为系统任务
+func OperatorFrom(ctx context.Context) Operator {
+	if ctx != nil {
+		if op, ok := ctx.Value(operatorKey{}).(Operator); ok {
+			return op
+		}
+	}
+	return Operator{Username: "system"}
+}
+
+// Change 单个字段的变更前后值
+type Change struct {
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// Register 注册 GORM 回调，对用户、角色、菜单、组织、字典及其关联表的增删改记录审计日志。
+// 审计日志与业务写入在同一事务中提交
+func Register(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("audit:before_create", captureBeforeUpsert); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register("audit:after_create", afterCreate); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("audit:before_update", captureBefore); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("audit:after_update", afterUpdate); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("audit:before_delete", captureBefore); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register("audit:after_delete", afterDelete)
+}
+
+func audited(db *gorm.DB) (string, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return "", false
+	}
+	entity, ok := entityTypes[db.Statement.Table]
+	return entity, ok
+}
+
+// captureBefore 更新/删除前按相同条件读取受影响的行
+func captureBefore(db *gorm.DB) {
+	if _, ok := audited(db); !ok {
+		return
+	}
+	rows, err := loadRows(db, nil)
+	if err != nil {
+		slog.ErrorContext(db.Statement.Context, "审计日志读取变更前数据失败", "table", db.Statement.Table, "err", err)
+		return
+	}
+	db.InstanceSet(beforeRowsKey, rows)
+}
+
+// captureBeforeUpsert 带 ON CONFLICT 的插入（关联表追加、授权有效期调整）可能命中已有行，先记录这些行
+func captureBeforeUpsert(db *gorm.DB) {
+	if _, ok := audited(db); !ok {
+		return
+	}
+	if _, ok := db.Statement.Clauses["ON CONFLICT"]; !ok {
+		return
+	}
+	rows := structRows(db)
+	if len(rows) == 0 {
+		return
+	}
+	existing, err := loadRows(db, rows)
+	if err != nil {
+		slog.ErrorContext(db.Statement.Context, "审计日志读取变更前数据失败", "table", db.Statement.Table, "err", err)
+		return
+	}
+	db.InstanceSet(beforeRowsKey, existing)
+}
+
+func afterCreate(db *gorm.DB) {
+	entity, ok := audited(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+	s := db.Statement.Schema
+	existing := map[string]map[string]interface{}{}
+	for _, row := range beforeRows(db) {
+		existing[entityID(s, row)] = row
+	}
+
+	var logs []model.AuditLog
+	var upserted []map[string]interface{}
+	for _, row := range structRows(db) {
+		id := entityID(s, row)
+		if old, ok := existing[id]; ok {
+			upserted = append(upserted, old)
+			continue
+		}
+		logs = append(logs, newLog(db, entity, model.AuditActionCreate, id, diff(nil, row)))
+	}
+
+	// 已存在的行：DO NOTHING 时没有差异，DO UPDATE 时记录为更新
+	if len(upserted) > 0 {
+		after, err := loadRows(db, upserted)
+		if err != nil {
+			slog.ErrorContext(db.Statement.Context, "审计日志读取变更后数据失败", "table", db.Statement.Table, "err", err)
+		}
+		for _, row := range after {
+			id := entityID(s, row)
+			if changes := diff(existing[id], row); len(changes) > 0 {
+				logs = append(logs, newLog(db, entity, model.AuditActionUpdate, id, changes))
+			}
+		}
+	}
+	write(db, logs)
+}
+
+func afterUpdate(db *gorm.DB) {
+	entity, ok := audited(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+	before := beforeRows(db)
+	if len(before) == 0 {
+		return
+	}
+	after, err := loadRows(db, before)
+	if err != nil {
+		slog.ErrorContext(db.Statement.Context, "审计日志读取变更后数据失败", "table", db.Statement.Table, "err", err)
+		return
+	}
+	afterByID := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByID[entityID(db.Statement.Schema, row)] = row
+	}
+
+	var logs []model.AuditLog
+	for _, old := range before {
+		id := entityID(db.Statement.Schema, old)
+		changes := diff(old, afterByID[id])
+		if len(changes) == 0 {
+			continue
+		}
+		logs = append(logs, newLog(db, entity, model.AuditActionUpdate, id, changes))
+	}
+	write(db, logs)
+}
+
+func afterDelete(db *gorm.DB) {
+	entity, ok := audited(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+	var logs []model.AuditLog
+	for _, old := range beforeRows(db) {
+		logs = append(logs, newLog(db, entity, model.AuditActionDelete, entityID(db.Statement.Schema, old), diff(old, nil)))
+	}
+	write(db, logs)
+}
+
+func beforeRows(db *gorm.DB) []map[string]interface{} {
+	v, ok := db.InstanceGet(beforeRowsKey)
+	if !ok {
+		return nil
+	}
+	rows, _ := v.([]map[string]interface{})
+	return rows
+}
+
+// loadRows 读取语句影响的行；byRows 非空时改为按这些行的主键读取（用于读取更新后的值）
+func loadRows(db *gorm.DB, byRows []map[string]interface{}) ([]map[string]interface{}, error) {
+	stmt := db.Statement
+	q := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Table(stmt.Table)
+
+	if byRows != nil {
+		q = q.Where(primaryKeyCondition(stmt.Schema, byRows))
+	} else {
+		conditions := 0
+		if where, ok := stmt.Clauses["WHERE"]; ok {
+			if w, ok := where.Expression.(clause.Where); ok && len(w.Exprs) > 0 {
+				q = q.Clauses(clause.Where{Exprs: w.Exprs})
+				conditions++
+			}
+		}
+		// 按模型主键更新/删除时，主键条件由 GORM 在执行阶段才加入
+		mv := reflect.Indirect(reflect.ValueOf(stmt.Model))
+		if mv.Kind() == reflect.Struct && mv.Type() == stmt.Schema.ModelType {
+			for _, field := range stmt.Schema.PrimaryFields {
+				if value, zero := field.ValueOf(stmt.Context, mv); !zero {
+					q = q.Where(clause.Eq{Column: clause.Column{Name: field.DBName}, Value: value})
+					conditions++
+				}
+			}
+		}
+		// 没有任何条件的全表操作 GORM 本身会拒绝，这里不做全表读取
+		if conditions == 0 {
+			return nil, nil
+		}
+		if _, ok := stmt.Schema.FieldsByDBName["deleted_at"]; ok && !stmt.Unscoped {
+			q = q.Where("deleted_at IS NULL")
+		}
+	}
+
+	var rows []map[string]interface{}
+	err := q.Find(&rows).Error
+	return rows, err
+}
+
+// structRows 将新建的模型（单个或切片）转换为按列名组织的值
+func structRows(db *gorm.DB) []map[string]interface{} {
+	stmt := db.Statement
+	value := reflect.Indirect(stmt.ReflectValue)
+	var values []reflect.Value
+	switch value.Kind() {
+	case reflect.Struct:
+		values = append(values, value)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			values = append(values, reflect.Indirect(value.Index(i)))
+		}
+	}
+
+	rows := make([]map[string]interface{}, 0, len(values))
+	for _, v := range values {
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		row := map[string]interface{}{}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			fv, _ := field.ValueOf(stmt.Context, v)
+			row[field.DBName] = fv
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func primaryKeyCondition(s *schema.Schema, rows []map[string]interface{}) clause.Expression {
+	var ors []clause.Expression
+	for _, row := range rows {
+		var ands []clause.Expression
+		for _, field := range s.PrimaryFields {
+			ands = append(ands, clause.Eq{Column: clause.Column{Name: field.DBName}, Value: row[field.DBName]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	return clause.Or(ors...)
+}
+
+// entityID 主键值，复合主键（关联表）以冒号连接
+func entityID(s *schema.Schema, row map[string]interface{}) string {
+	parts := make([]string, 0, len(s.PrimaryFields))
+	for _, field := range s.PrimaryFields {
+		parts = append(parts, fmt.Sprint(indirect(row[field.DBName])))
+	}
+	return strings.Join(parts, ":")
+}
+
+// diff 计算字段级差异，old 为 nil 表示新建，new 为 nil 表示删除
+func diff(old, new map[string]interface{}) map[string]Change {
+	changes := map[string]Change{}
+	for column := range union(old, new) {
+		if ignoredColumns[column] {
+			continue
+		}
+		o, n := normalize(old[column]), normalize(new[column])
+		if jsonEqual(o, n) {
+			continue
+		}
+		if maskedColumns[column] {
+			changes[column] = Change{Old: maskIfSet(o), New: maskIfSet(n)}
+			continue
+		}
+		changes[column] = Change{Old: o, New: n}
+	}
+	return changes
+}
+
+func union(a, b map[string]interface{}) map[string]struct{} {
+	keys := map[string]struct{}{}
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	return keys
+}
+
+// normalize 统一指针、零值时间与 DeletedAt 等类型，便于比较与序列化
+func normalize(v interface{}) interface{} {
+	v = indirect(v)
+	switch t := v.(type) {
+	case gorm.DeletedAt:
+		if !t.Valid {
+			return nil
+		}
+		return t.Time
+	case time.Time:
+		if t.IsZero() {
+			return nil
+		}
+	case string:
+		if t == "" {
+			return nil
+		}
+	}
+	return v
+}
+
+func indirect(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.IsValid() && rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	return rv.Interface()
+}
+
+func jsonEqual(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+func maskIfSet(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return maskedValue
+}
+
+func newLog(db *gorm.DB, entity, action, id string, changes map[string]Change) model.AuditLog {
+	op := OperatorFrom(db.Statement.Context)
+	raw, err := json.Marshal(changes)
+	if err != nil {
+		raw = []byte("{}")
+	}
+	return model.AuditLog{
+		ID:         utils.GenerateID(),
+		OperatorID: op.ID,
+		Operator:   op.Username,
+		IP:         op.IP,
+		EntityType: entity,
+		EntityID:   id,
+		Action:     action,
+		Changes:    model.JSONText(raw),
+		CreatedAt:  time.Now(),
+	}
+}
+
+// write 在当前事务内写入审计日志，失败时中止业务写入，保证变更一定有迹可查
+func write(db *gorm.DB, logs []model.AuditLog) {
+	if len(logs) == 0 {
+		return
+	}
+	if err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Create(&logs).Error; err != nil {
+		db.AddError(fmt.Errorf("写入审计日志失败: %w", err))
+	}
+}
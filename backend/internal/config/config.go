@@ -1,7 +1,7 @@
 package config
 
 import (
-	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 
@@ -11,11 +11,23 @@ import (
 var globalConfig *Config
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Upload   UploadConfig   `mapstructure:"upload"`
+	Server         ServerConfig         `mapstructure:"server"`
+	Database       DatabaseConfig       `mapstructure:"database"`
+	Redis          RedisConfig          `mapstructure:"redis"`
+	JWT            JWTConfig            `mapstructure:"jwt"`
+	Upload         UploadConfig         `mapstructure:"upload"`
+	TwoFactor      TwoFactorConfig      `mapstructure:"two_factor"`
+	LoginSecurity  LoginSecurityConfig  `mapstructure:"login_security"`
+	PasswordPolicy PasswordPolicyConfig `mapstructure:"password_policy"`
+	PasswordReset  PasswordResetConfig  `mapstructure:"password_reset"`
+	Mail           MailConfig           `mapstructure:"mail"`
+	Permission     PermissionConfig     `mapstructure:"permission"`
+	RoleGrant      RoleGrantConfig      `mapstructure:"role_grant"`
+	AccessLog      AccessLogConfig      `mapstructure:"access_log"`
+	LoginLog       LoginLogConfig       `mapstructure:"login_log"`
+	Log            LogConfig            `mapstructure:"log"`
+	Tracing        TracingConfig        `mapstructure:"tracing"`
+	Metrics        MetricsConfig        `mapstructure:"metrics"`
 }
 
 type ServerConfig struct {
@@ -41,8 +53,8 @@ type RedisConfig struct {
 
 type JWTConfig struct {
 	Secret              string `mapstructure:"secret"`
-	ExpireTime          int    `mapstructure:"expire_time"`
-	RefreshAheadSeconds int    `mapstructure:"refresh_ahead_seconds"`
+	AccessExpireMinutes int    `mapstructure:"access_expire_minutes"`
+	RefreshExpireHours  int    `mapstructure:"refresh_expire_hours"`
 }
 
 type UploadConfig struct {
@@ -51,6 +63,121 @@ type UploadConfig struct {
 	AllowedTypes []string `mapstructure:"allowed_types"`
 }
 
+type TwoFactorConfig struct {
+	Issuer           string `mapstructure:"issuer"`             // 验证器 App 中显示的发行方
+	TicketTTLSeconds int    `mapstructure:"ticket_ttl_seconds"` // 两步登录票据有效期
+}
+
+type LoginSecurityConfig struct {
+	MaxFailures          int `mapstructure:"max_failures"`           // 同一用户名失败次数上限，达到后锁定
+	IPMaxFailures        int `mapstructure:"ip_max_failures"`        // 同一 IP 失败次数上限，达到后锁定
+	FailureWindowMinutes int `mapstructure:"failure_window_minutes"` // 失败计数的统计窗口
+	LockoutMinutes       int `mapstructure:"lockout_minutes"`        // 临时锁定时长
+	DelayBaseMs          int `mapstructure:"delay_base_ms"`          // 失败后渐进延迟的基数，按失败次数指数增长
+	MaxDelayMs           int `mapstructure:"max_delay_ms"`           // 单次延迟上限
+}
+
+type PasswordPolicyConfig struct {
+	MinLength     int      `mapstructure:"min_length"`
+	RequireUpper  bool     `mapstructure:"require_upper"`  // 至少一个大写字母
+	RequireLower  bool     `mapstructure:"require_lower"`  // 至少一个小写字母
+	RequireDigit  bool     `mapstructure:"require_digit"`  // 至少一个数字
+	RequireSymbol bool     `mapstructure:"require_symbol"` // 至少一个特殊字符
+	Blocklist     []string `mapstructure:"blocklist"`      // 常见弱密码（不区分大小写）
+	HistorySize   int      `mapstructure:"history_size"`   // 不允许与最近 N 次密码相同，0 表示不限制
+	MaxAgeDays    int      `mapstructure:"max_age_days"`   // 密码最长使用天数，0 表示永不过期
+}
+
+type PasswordResetConfig struct {
+	TokenTTLMinutes int    `mapstructure:"token_ttl_minutes"` // 重置令牌有效期
+	ResetURL        string `mapstructure:"reset_url"`         // 前端重置页面地址，令牌以 token 参数附加
+	IPLimit         int    `mapstructure:"ip_limit"`          // 同一 IP 在统计窗口内最多请求次数，0 表示不限制
+	IPWindowMinutes int    `mapstructure:"ip_window_minutes"` // IP 请求次数统计窗口
+	MaxPending      int    `mapstructure:"max_pending"`       // 同时在后台处理的发信任务上限，已满时拒绝新请求
+}
+
+type MailConfig struct {
+	Driver   string `mapstructure:"driver"` // smtp | file | log
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+	FileDir  string `mapstructure:"file_dir"` // driver=file 时邮件（.eml）写入的目录
+}
+
+type PermissionConfig struct {
+	SuperRoles []string `mapstructure:"super_roles"` // 拥有这些角色编码的用户跳过路由权限校验
+}
+
+type RoleGrantConfig struct {
+	SweepIntervalSeconds int `mapstructure:"sweep_interval_seconds"` // 清理过期角色授权并刷新会话的间隔
+}
+
+type AccessLogConfig struct {
+	QueueSize       int    `mapstructure:"queue_size"`        // 内存队列容量
+	BatchSize       int    `mapstructure:"batch_size"`        // 攒够多少条写入一次
+	FlushIntervalMs int    `mapstructure:"flush_interval_ms"` // 未攒够时的最长写入间隔
+	OverflowPolicy  string `mapstructure:"overflow_policy"`   // 队列满时：drop_newest | drop_oldest | block
+	BlockTimeoutMs  int    `mapstructure:"block_timeout_ms"`  // overflow_policy=block 时请求最多等待的时长
+
+	RetentionDays        int    `mapstructure:"retention_days"`         // 保留天数，0 表示永久保留
+	PurgeIntervalMinutes int    `mapstructure:"purge_interval_minutes"` // 定期清理的间隔
+	Archive              bool   `mapstructure:"archive"`                // 删除前是否归档为 gzip 压缩的 NDJSON 文件
+	ArchiveDir           string `mapstructure:"archive_dir"`
+	PartitionMonthsAhead int    `mapstructure:"partition_months_ahead"` // 提前创建的月分区数
+	DeleteFloorDays      int    `mapstructure:"delete_floor_days"`      // 保护期：写入未满该天数的日志不允许删除，保留天数也不会短于此值
+	ChainKey             string `mapstructure:"chain_key"`              // 哈希链 HMAC 密钥，只保存在配置中，不能写入数据库
+
+	Capture AccessLogCaptureConfig `mapstructure:"capture"`
+}
+
+type AccessLogCaptureConfig struct {
+	Routes            []string `mapstructure:"routes"`              // 采集请求/响应内容的路由，如 "POST /api/v1/users"，"*" 表示全部；为空不采集
+	MaxBodyBytes      int      `mapstructure:"max_body_bytes"`      // 请求参数、请求体、响应体各自的长度上限，超出截断
+	MaskFields        []string `mapstructure:"mask_fields"`         // 入库前替换为 *** 的字段名（不区分大小写）
+	SuccessSampleRate float64  `mapstructure:"success_sample_rate"` // 成功请求（状态码 < 400）的采样率，0~1
+	FailureSampleRate float64  `mapstructure:"failure_sample_rate"` // 失败请求的采样率，0~1
+}
+
+type LoginLogConfig struct {
+	AlertIPThreshold   int      `mapstructure:"alert_ip_threshold"`   // 同一账户在窗口内从多少个不同 IP 登录成功时告警，0 表示不告警
+	AlertWindowMinutes int      `mapstructure:"alert_window_minutes"` // 统计窗口
+	AlertEmails        []string `mapstructure:"alert_emails"`         // 告警邮件收件人，为空只记录告警
+}
+
+type LogConfig struct {
+	Level        string   `mapstructure:"level"`         // debug | info | warn | error
+	Format       string   `mapstructure:"format"`        // text | json
+	Output       string   `mapstructure:"output"`        // stdout | file | both
+	File         string   `mapstructure:"file"`          // output 含 file 时的日志文件
+	MaxSizeMB    int      `mapstructure:"max_size_mb"`   // 单个文件达到该大小后轮转
+	MaxBackups   int      `mapstructure:"max_backups"`   // 保留的历史文件数，0 表示不限
+	MaxAgeDays   int      `mapstructure:"max_age_days"`  // 历史文件保留天数，0 表示不限
+	RedactFields []string `mapstructure:"redact_fields"` // 字段名包含这些词（不区分大小写）时输出 ***
+	SQLLevel     string   `mapstructure:"sql_level"`     // GORM 日志级别：silent | error | warn | info
+	SlowQueryMs  int      `mapstructure:"slow_query_ms"` // 超过该耗时的 SQL 记为慢查询，0 表示不记录
+	SQLParams    bool     `mapstructure:"sql_params"`    // SQL 日志是否带参数值，关闭时只输出占位符
+}
+
+type TracingConfig struct {
+	Enabled     bool              `mapstructure:"enabled"`
+	ServiceName string            `mapstructure:"service_name"` // 上报的 service.name
+	Exporter    string            `mapstructure:"exporter"`     // otlp | stdout | file
+	Endpoint    string            `mapstructure:"endpoint"`     // exporter=otlp 时 OTLP/HTTP 接收端地址，如 localhost:4318
+	Insecure    bool              `mapstructure:"insecure"`     // OTLP 使用 HTTP 而非 HTTPS
+	Headers     map[string]string `mapstructure:"headers"`      // OTLP 请求附带的头，如鉴权令牌
+	File        string            `mapstructure:"file"`         // exporter=file 时写入的文件，每行一个 span
+	SampleRatio float64           `mapstructure:"sample_ratio"` // 根 span 采样率，0~1；上游已决定采样的请求沿用上游结果
+}
+
+type MetricsConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	Path     string   `mapstructure:"path"`      // Prometheus 抓取地址
+	AllowIPs []string `mapstructure:"allow_ips"` // 允许抓取的 IP 或网段（按连接对端地址判断）
+	Token    string   `mapstructure:"token"`     // 不在白名单时可携带 Authorization: Bearer <token> 抓取，为空表示不启用
+}
+
 func Load() *Config {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -85,28 +212,103 @@ func Load() *Config {
 	viper.SetDefault("redis.password", "")
 	viper.SetDefault("redis.db", 0)
 	viper.SetDefault("jwt.secret", "your-secret-key")
-	viper.SetDefault("jwt.expire_time", 24)
-	// 当 token 剩余有效期小于该阈值（秒）时，自动续期
-	viper.SetDefault("jwt.refresh_ahead_seconds", 900) // 15 分钟
+	// 访问令牌短期有效，过期后由客户端使用刷新令牌换取新令牌
+	viper.SetDefault("jwt.access_expire_minutes", 30)
+	viper.SetDefault("jwt.refresh_expire_hours", 168) // 7 天
 	viper.SetDefault("upload.avatar_path", "uploads/avatars/")
 	viper.SetDefault("upload.max_size", 5242880) // 5MB
 	viper.SetDefault("upload.allowed_types", []string{"image/jpeg", "image/png", "image/gif"})
+	viper.SetDefault("two_factor.issuer", "siqian-admin")
+	viper.SetDefault("two_factor.ticket_ttl_seconds", 300)
+	viper.SetDefault("login_security.max_failures", 5)
+	viper.SetDefault("login_security.ip_max_failures", 20)
+	viper.SetDefault("login_security.failure_window_minutes", 15)
+	viper.SetDefault("login_security.lockout_minutes", 15)
+	viper.SetDefault("login_security.delay_base_ms", 200)
+	viper.SetDefault("login_security.max_delay_ms", 5000)
+	viper.SetDefault("password_policy.min_length", 8)
+	viper.SetDefault("password_policy.require_upper", false)
+	viper.SetDefault("password_policy.require_lower", true)
+	viper.SetDefault("password_policy.require_digit", true)
+	viper.SetDefault("password_policy.require_symbol", false)
+	viper.SetDefault("password_policy.blocklist", []string{
+		"123456", "12345678", "123456789", "1234567890", "000000", "111111", "888888",
+		"password", "password1", "passw0rd", "qwerty", "qwerty123", "abc123", "abc12345",
+		"admin", "admin123", "admin888", "root123", "iloveyou", "qwe123", "a123456",
+	})
+	viper.SetDefault("password_policy.history_size", 5)
+	viper.SetDefault("password_policy.max_age_days", 90)
+	viper.SetDefault("password_reset.token_ttl_minutes", 30)
+	viper.SetDefault("password_reset.reset_url", "http://localhost:3000/reset-password")
+	viper.SetDefault("password_reset.ip_limit", 10)
+	viper.SetDefault("password_reset.ip_window_minutes", 15)
+	viper.SetDefault("password_reset.max_pending", 16)
+	viper.SetDefault("mail.driver", "log")
+	viper.SetDefault("mail.host", "localhost")
+	viper.SetDefault("mail.port", 1025)
+	viper.SetDefault("mail.from", "siqian-admin <no-reply@localhost>")
+	viper.SetDefault("mail.file_dir", "mails/")
+	viper.SetDefault("permission.super_roles", []string{"superadmin"})
+	viper.SetDefault("role_grant.sweep_interval_seconds", 60)
+	viper.SetDefault("access_log.queue_size", 10000)
+	viper.SetDefault("access_log.batch_size", 200)
+	viper.SetDefault("access_log.flush_interval_ms", 1000)
+	viper.SetDefault("access_log.overflow_policy", "drop_newest")
+	viper.SetDefault("access_log.block_timeout_ms", 50)
+	viper.SetDefault("access_log.retention_days", 90)
+	viper.SetDefault("access_log.purge_interval_minutes", 60)
+	viper.SetDefault("access_log.archive", false)
+	viper.SetDefault("access_log.archive_dir", "archives/access_logs/")
+	viper.SetDefault("access_log.partition_months_ahead", 2)
+	viper.SetDefault("access_log.delete_floor_days", 30)
+	viper.SetDefault("access_log.capture.routes", []string{})
+	viper.SetDefault("access_log.capture.max_body_bytes", 4096)
+	viper.SetDefault("access_log.capture.mask_fields", []string{
+		"password", "old_password", "new_password", "confirm_password",
+		"token", "access_token", "refresh_token", "ticket", "secret",
+		"otpauth_uri", "recovery_codes", "recovery_code", "code",
+	})
+	viper.SetDefault("access_log.capture.success_sample_rate", 0.0)
+	viper.SetDefault("access_log.capture.failure_sample_rate", 1.0)
+	viper.SetDefault("login_log.alert_ip_threshold", 5)
+	viper.SetDefault("login_log.alert_window_minutes", 60)
+	viper.SetDefault("login_log.alert_emails", []string{})
+	viper.SetDefault("log.level", "info")
+	viper.SetDefault("log.format", "text")
+	viper.SetDefault("log.output", "stdout")
+	viper.SetDefault("log.file", "logs/app.log")
+	viper.SetDefault("log.max_size_mb", 100)
+	viper.SetDefault("log.max_backups", 7)
+	viper.SetDefault("log.max_age_days", 30)
+	viper.SetDefault("log.redact_fields", []string{
+		"password", "token", "secret", "ticket", "authorization", "recovery_code",
+	})
+	viper.SetDefault("log.sql_level", "warn")
+	viper.SetDefault("log.slow_query_ms", 200)
+	viper.SetDefault("log.sql_params", false)
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.service_name", "siqian-admin")
+	viper.SetDefault("tracing.exporter", "otlp")
+	viper.SetDefault("tracing.endpoint", "localhost:4318")
+	viper.SetDefault("tracing.insecure", true)
+	viper.SetDefault("tracing.file", "logs/traces.json")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+	viper.SetDefault("metrics.enabled", true)
+	viper.SetDefault("metrics.path", "/metrics")
+	viper.SetDefault("metrics.allow_ips", []string{"127.0.0.1", "::1"})
+	viper.SetDefault("metrics.token", "")
 
-	// 打印当前工作目录和搜索路径
+	// 输出当前工作目录和搜索路径；配置加载前日志尚未初始化，使用 slog 默认输出
 	if pwd, err := os.Getwd(); err == nil {
-		fmt.Println("当前工作目录:", pwd)
-	}
-	if execPath, err := os.Executable(); err == nil {
-		fmt.Println("可执行文件路径:", execPath)
-		fmt.Println("可执行文件目录:", filepath.Dir(execPath))
+		slog.Debug("当前工作目录", "dir", pwd)
 	}
-	fmt.Println("搜索配置文件路径:")
 	// 显示配置的搜索路径
 	searchPaths := []string{
 		".", "./configs", "../", "../../",
 	}
 	if execPath, err := os.Executable(); err == nil {
 		execDir := filepath.Dir(execPath)
+		slog.Debug("可执行文件路径", "path", execPath)
 		searchPaths = append([]string{
 			execDir,
 			filepath.Join(execDir, "configs"),
@@ -114,18 +316,15 @@ func Load() *Config {
 			filepath.Join(execDir, "../configs"),
 		}, searchPaths...)
 	}
-	for _, path := range searchPaths {
-		fmt.Printf("  - %s\n", path)
-	}
+	slog.Debug("搜索配置文件路径", "paths", searchPaths)
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
 			panic(err)
 		}
-		fmt.Println("警告: 配置文件未找到，使用默认配置")
-		fmt.Println("错误详情:", err)
+		slog.Warn("配置文件未找到，使用默认配置", "err", err)
 	} else {
-		fmt.Println("配置文件加载成功:", viper.ConfigFileUsed())
+		slog.Info("配置文件加载成功", "file", viper.ConfigFileUsed())
 	}
 
 	var config Config
@@ -133,9 +332,8 @@ func Load() *Config {
 		panic(err)
 	}
 
-	// 打印配置信息用于调试
-	fmt.Printf("数据库配置: host=%s, port=%d, user=%s, dbname=%s\n",
-		config.Database.Host, config.Database.Port, config.Database.User, config.Database.DBName)
+	slog.Debug("数据库配置", "host", config.Database.Host, "port", config.Database.Port,
+		"user", config.Database.User, "dbname", config.Database.DBName)
 
 	globalConfig = &config
 	return &config
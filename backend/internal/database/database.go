@@ -1,16 +1,47 @@
 package database
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"siqian-admin/internal/audit"
 	"siqian-admin/internal/config"
+	"siqian-admin/internal/logger"
 	"siqian-admin/internal/sys/model"
+	"siqian-admin/internal/tracing"
+	"strings"
+	"time"
 
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
 )
 
+// models 启动时自动迁移的表，就绪检查据此确认迁移已完成
+var models = []interface{}{
+	&model.User{},
+	&model.Organization{},
+	&model.Role{},
+	&model.Menu{},
+	&model.Dict{},
+	&model.DictItem{},
+	&model.UserRole{},
+	&model.RoleMenu{},
+	&model.RoleDataScope{},
+	&model.RoleConstraint{},
+	&model.RoleConstraintRole{},
+	&model.UserOrganization{},
+	&model.AccessLog{},
+	&model.AccessLogTombstone{},
+	&model.AuditLog{},
+	&model.UserRecoveryCode{},
+	&model.PasswordHistory{},
+	&model.LoginLog{},
+	&model.SecurityAlert{},
+}
+
 func InitDB(cfg *config.Config) (*gorm.DB, error) {
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
 		cfg.Database.Host,
@@ -21,8 +52,13 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 		cfg.Database.SSLMode,
 	)
 
+	// SQL 日志写入 slog，请求 ID 由日志 handler 从 context 中附加
+	sqlLogger, err := logger.NewGormLogger(slog.Default(), cfg.Log.SQLLevel, time.Duration(cfg.Log.SlowQueryMs)*time.Millisecond, cfg.Log.SQLParams)
+	if err != nil {
+		return nil, err
+	}
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger:                                   logger.Default.LogMode(logger.Info),
+		Logger:                                   sqlLogger,
 		DisableForeignKeyConstraintWhenMigrating: true,
 	})
 	if err != nil {
@@ -30,21 +66,39 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 	}
 
 	// 自动迁移
-	if err := db.AutoMigrate(
-		&model.User{},
-		&model.Organization{},
-		&model.Role{},
-		&model.Menu{},
-		&model.Dict{},
-		&model.DictItem{},
-		&model.UserRole{},
-		&model.RoleMenu{},
-		&model.UserOrganization{},
-		&model.AccessLog{},
-	); err != nil {
+	if err := db.AutoMigrate(models...); err != nil {
+		return nil, err
+	}
+
+	// 密码有效期从迁移时开始计算，没有修改时间的老账户不会在升级后立即过期
+	if err := db.Exec("UPDATE sys_users SET password_changed_at = now() WHERE password_changed_at IS NULL").Error; err != nil {
+		return nil, err
+	}
+
+	// 访问日志按月分区
+	if err := partitionAccessLogs(db, cfg.AccessLog.PartitionMonthsAhead); err != nil {
+		return nil, err
+	}
+
+	// 启动时确认迁移结果完整，就绪检查之后只做周期性复查
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := CheckMigrations(ctx, db); err != nil {
+		return nil, err
+	}
+
+	// 业务数据变更审计
+	if err := audit.Register(db); err != nil {
 		return nil, err
 	}
 
+	// SQL 链路追踪
+	if cfg.Tracing.Enabled {
+		if err := tracing.RegisterGorm(db); err != nil {
+			return nil, err
+		}
+	}
+
 	return db, nil
 }
 
@@ -55,5 +109,83 @@ func InitRedis(cfg *config.Config) (*redis.Client, error) {
 		DB:       cfg.Redis.DB,
 	})
 
+	// 启动时确认 Redis 可用，会话与登录保护都依赖它
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+
+	// Redis 命令链路追踪；命令参数中有会话与刷新令牌，span 不记录完整命令
+	if cfg.Tracing.Enabled {
+		if err := redisotel.InstrumentTracing(rdb, redisotel.WithDBStatement(false)); err != nil {
+			return nil, err
+		}
+	}
+
 	return rdb, nil
 }
+
+// CheckMigrations 确认自动迁移的表与字段都已存在；访问日志已分区时还需存在当月分区。
+// 一次查询取回全部相关表的字段，在内存中比对
+func CheckMigrations(ctx context.Context, db *gorm.DB) error {
+	db = db.WithContext(ctx)
+	schemas := make([]*schema.Schema, 0, len(models))
+	tables := make([]string, 0, len(models)+1)
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return err
+		}
+		schemas = append(schemas, stmt.Schema)
+		tables = append(tables, stmt.Schema.Table)
+	}
+	partitioned, err := IsAccessLogPartitioned(db)
+	if err != nil {
+		return err
+	}
+	if partitioned {
+		tables = append(tables, AccessLogPartitionName(time.Now()))
+	}
+
+	var rows []struct {
+		TableName  string
+		ColumnName string
+	}
+	if err := db.Raw(`SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name IN ?`, tables).
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+	columns := make(map[string]map[string]bool, len(tables))
+	for _, r := range rows {
+		if columns[r.TableName] == nil {
+			columns[r.TableName] = map[string]bool{}
+		}
+		columns[r.TableName][r.ColumnName] = true
+	}
+
+	var missing []string
+	for _, t := range tables {
+		if columns[t] == nil {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("缺少数据表: %s", strings.Join(missing, ", "))
+	}
+
+	// 表已存在但新增字段未迁移时，读写该字段的接口会报错
+	for _, sch := range schemas {
+		for _, field := range sch.Fields {
+			if field.DBName != "" && !columns[sch.Table][field.DBName] {
+				missing = append(missing, sch.Table+"."+field.DBName)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("缺少字段: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
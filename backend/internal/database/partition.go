@@ -0,0 +1,225 @@
+package database
+
+import (
+	"fmt"
+	"siqian-admin/internal/sys/model"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccessLogTable 访问日志表，按 created_at 以自然月（UTC）做范围分区
+const AccessLogTable = "sys_access_logs"
+
+// accessLogDefaultPartition 兜底分区，接收未建分区月份的数据；正常情况下应为空
+const accessLogDefaultPartition = AccessLogTable + "_default"
+
+// AccessLogPartition 一个按月的访问日志分区
+type AccessLogPartition struct {
+	Name  string    `json:"name"`
+	From  time.Time `json:"from"` // 含
+	To    time.Time `json:"to"`   // 不含
+	Rows  int64     `json:"rows"` // 统计信息中的估算行数
+	Bytes int64     `json:"bytes"`
+}
+
+// AccessLogPartitionName 分区表名，如 sys_access_logs_p202501
+func AccessLogPartitionName(month time.Time) string {
+	return fmt.Sprintf("%s_p%s", AccessLogTable, month.UTC().Format("200601"))
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// IsAccessLogPartitioned 访问日志表是否已是分区表
+func IsAccessLogPartitioned(db *gorm.DB) (bool, error) {
+	var count int64
+	err := db.Raw(`SELECT count(*) FROM pg_partitioned_table pt
+		JOIN pg_class c ON c.oid = pt.partrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relname = ? AND n.nspname = current_schema()`, AccessLogTable).
+		Scan(&count).Error
+	return count > 0, err
+}
+
+// EnsureAccessLogPartitions 创建 from 所在月份到其后 monthsAhead 个月的分区（已存在则跳过）
+func EnsureAccessLogPartitions(db *gorm.DB, from time.Time, monthsAhead int) error {
+	start := monthStart(from)
+	for i := 0; i <= monthsAhead; i++ {
+		month := start.AddDate(0, i, 0)
+		if err := ensureAccessLogPartition(db, month); err != nil {
+			return fmt.Errorf("创建访问日志分区 %s 失败: %w", AccessLogPartitionName(month), err)
+		}
+	}
+	return nil
+}
+
+// ensureAccessLogPartition 创建一个月的分区。分区未及时创建时该月数据会落入兜底分区，
+// PostgreSQL 不允许新分区覆盖兜底分区中已有的行，因此先建独立表、把这些行移过去，再挂载为分区
+func ensureAccessLogPartition(db *gorm.DB, month time.Time) error {
+	name := AccessLogPartitionName(month)
+	exists, err := tableExists(db, name)
+	if err != nil || exists {
+		return err
+	}
+	from, to := month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339)
+
+	hasDefault, err := tableExists(db, accessLogDefaultPartition)
+	if err != nil {
+		return err
+	}
+	if !hasDefault {
+		return db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')`,
+			name, AccessLogTable, from, to)).Error
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 挂载完成前阻止写入兜底分区，多个实例同时补分区时也在此排队
+		if err := tx.Exec(fmt.Sprintf(`LOCK TABLE %s IN EXCLUSIVE MODE`, accessLogDefaultPartition)).Error; err != nil {
+			return err
+		}
+		exists, err := tableExists(tx, name)
+		if err != nil || exists {
+			return err
+		}
+		steps := []string{
+			fmt.Sprintf(`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)`, name, AccessLogTable),
+			fmt.Sprintf(`WITH moved AS (DELETE FROM %s WHERE created_at >= '%s' AND created_at < '%s' RETURNING *)
+				INSERT INTO %s SELECT * FROM moved`, accessLogDefaultPartition, from, to, name),
+			// 挂载时按父表自动补建主键与索引
+			fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`, AccessLogTable, name, from, to),
+		}
+		for _, sql := range steps {
+			if err := tx.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func tableExists(db *gorm.DB, name string) (bool, error) {
+	var exists bool
+	err := db.Raw(`SELECT to_regclass(?) IS NOT NULL`, name).Scan(&exists).Error
+	return exists, err
+}
+
+// ListAccessLogPartitions 列出按月分区（不含兜底分区），按时间升序
+func ListAccessLogPartitions(db *gorm.DB) ([]AccessLogPartition, error) {
+	var rows []struct {
+		Name  string
+		Rows  float64
+		Bytes int64
+	}
+	err := db.Raw(`SELECT c.relname AS name, c.reltuples AS rows, pg_total_relation_size(c.oid) AS bytes
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		JOIN pg_namespace n ON n.oid = p.relnamespace
+		WHERE p.relname = ? AND n.nspname = current_schema()`, AccessLogTable).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := AccessLogTable + "_p"
+	partitions := make([]AccessLogPartition, 0, len(rows))
+	for _, r := range rows {
+		if len(r.Name) != len(prefix)+6 || r.Name[:len(prefix)] != prefix {
+			continue
+		}
+		month, err := time.Parse("200601", r.Name[len(prefix):])
+		if err != nil {
+			continue
+		}
+		estimate := int64(r.Rows)
+		if estimate < 0 { // 从未 ANALYZE 过
+			estimate = 0
+		}
+		partitions = append(partitions, AccessLogPartition{
+			Name:  r.Name,
+			From:  month,
+			To:    month.AddDate(0, 1, 0),
+			Rows:  estimate,
+			Bytes: r.Bytes,
+		})
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].From.Before(partitions[j].From) })
+	return partitions, nil
+}
+
+// partitionAccessLogs 将普通的访问日志表迁移为按月分区表，已是分区表时只补齐后续月份的分区。
+// 分区表的主键必须包含分区键，因此主键改为 (id, created_at)。
+func partitionAccessLogs(db *gorm.DB, monthsAhead int) error {
+	partitioned, err := IsAccessLogPartitioned(db)
+	if err != nil {
+		return err
+	}
+	if partitioned {
+		return EnsureAccessLogPartitions(db, time.Now(), monthsAhead)
+	}
+
+	legacy := AccessLogTable + "_legacy"
+	err = db.Transaction(func(tx *gorm.DB) error {
+		steps := []string{
+			fmt.Sprintf(`UPDATE %s SET created_at = now() WHERE created_at IS NULL`, AccessLogTable),
+			fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, AccessLogTable, legacy),
+			fmt.Sprintf(`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS) PARTITION BY RANGE (created_at)`, AccessLogTable, legacy),
+			fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN created_at SET NOT NULL`, AccessLogTable),
+			fmt.Sprintf(`ALTER TABLE %s ADD PRIMARY KEY (id, created_at)`, AccessLogTable),
+			fmt.Sprintf(`CREATE TABLE %s PARTITION OF %s DEFAULT`, accessLogDefaultPartition, AccessLogTable),
+		}
+		for _, sql := range steps {
+			if err := tx.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+
+		// 自增序列归属到新表，否则删除旧表时会被一并删除
+		var sequence *string
+		if err := tx.Raw(`SELECT pg_get_serial_sequence(?, 'id')`, legacy).Scan(&sequence).Error; err != nil {
+			return err
+		}
+		if sequence != nil {
+			if err := tx.Exec(fmt.Sprintf(`ALTER SEQUENCE %s OWNED BY %s.id`, *sequence, AccessLogTable)).Error; err != nil {
+				return err
+			}
+		}
+
+		// 为历史数据覆盖的每个月建分区，保证兜底分区为空
+		var oldest *time.Time
+		if err := tx.Raw(fmt.Sprintf(`SELECT min(created_at) FROM %s`, legacy)).Scan(&oldest).Error; err != nil {
+			return err
+		}
+		from := time.Now()
+		if oldest != nil && oldest.Before(from) {
+			from = *oldest
+		}
+		months := monthsAhead
+		for m := monthStart(from); m.Before(monthStart(time.Now())); m = m.AddDate(0, 1, 0) {
+			months++
+		}
+		if err := EnsureAccessLogPartitions(tx, from, months); err != nil {
+			return err
+		}
+
+		for _, sql := range []string{
+			fmt.Sprintf(`INSERT INTO %s SELECT * FROM %s`, AccessLogTable, legacy),
+			fmt.Sprintf(`DROP TABLE %s`, legacy),
+		} {
+			if err := tx.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("访问日志表分区迁移失败: %w", err)
+	}
+
+	// 旧表的索引随旧表删除，在分区表上重新创建
+	return db.AutoMigrate(&model.AccessLog{})
+}
@@ -0,0 +1,147 @@
+// Package logger 基于 log/slog 的结构化日志：文本或 JSON 输出、按大小轮转、
+// 自动附带请求 ID 与 trace_id，并对密码、令牌等敏感字段脱敏
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/utils"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Init 按配置创建日志并设为 slog 默认日志，返回的 io.Closer 用于退出时关闭日志文件
+func Init(cfg config.LogConfig) (*slog.Logger, io.Closer, error) {
+	var out io.Writer = os.Stdout
+	var closer io.Closer = nopCloser{}
+	switch cfg.Output {
+	case "", "stdout":
+	case "file", "both":
+		file, err := NewRotatingFile(cfg.File, cfg.MaxSizeMB, cfg.MaxBackups, cfg.MaxAgeDays)
+		if err != nil {
+			return nil, nil, err
+		}
+		out, closer = file, file
+		if cfg.Output == "both" {
+			out = io.MultiWriter(os.Stdout, file)
+		}
+	default:
+		return nil, nil, fmt.Errorf("不支持的日志输出: %s", cfg.Output)
+	}
+
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: newRedactor(cfg.RedactFields)}
+
+	var handler slog.Handler
+	switch cfg.Format {
+	case "", "text":
+		handler = slog.NewTextHandler(out, opts)
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		return nil, nil, fmt.Errorf("不支持的日志格式: %s", cfg.Format)
+	}
+
+	l := slog.New(contextHandler{handler})
+	slog.SetDefault(l)
+	return l, closer, nil
+}
+
+// ParseLevel 解析 debug | info | warn | error，空串视为 info
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("无效的日志级别: %s", s)
+	}
+	return level, nil
+}
+
+// contextHandler 从 context 中取出请求 ID 与链路追踪的 trace_id、span_id 附加到每条日志
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := utils.RequestIDFrom(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+var (
+	// bearerPattern、jwtPattern 匹配混在错误信息等文本中的令牌
+	bearerPattern = regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`)
+	jwtPattern    = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// tokenParamPattern 匹配链接中的令牌参数，如密码重置链接的 ?token=xxx、refresh_token=xxx、ticket=xxx
+	tokenParamPattern = regexp.MustCompile(`(?i)\b([a-z_]*(?:token|ticket)=)[^&\s#"'<>]+`)
+)
+
+// newRedactor 字段名包含 fields 中任一词时整个值替换为 ***；其余字符串与错误中的令牌同样替换
+func newRedactor(fields []string) func(groups []string, a slog.Attr) slog.Attr {
+	lowered := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			lowered = append(lowered, f)
+		}
+	}
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if a.Value.Kind() == slog.KindGroup {
+			return a
+		}
+		key := strings.ToLower(a.Key)
+		for _, f := range lowered {
+			if strings.Contains(key, f) {
+				return slog.String(a.Key, "***")
+			}
+		}
+		switch a.Value.Kind() {
+		case slog.KindString:
+			return slog.String(a.Key, RedactString(a.Value.String()))
+		case slog.KindAny:
+			if err, ok := a.Value.Any().(error); ok {
+				return slog.String(a.Key, RedactString(err.Error()))
+			}
+		}
+		return a
+	}
+}
+
+// RedactString 替换文本中的 Bearer 令牌、JWT 与链接中的令牌参数
+func RedactString(s string) string {
+	lower := strings.ToLower(s)
+	if !strings.Contains(s, "eyJ") && !strings.Contains(lower, "bearer") &&
+		!strings.Contains(lower, "token=") && !strings.Contains(lower, "ticket=") {
+		return s
+	}
+	s = bearerPattern.ReplaceAllString(s, "Bearer ***")
+	s = jwtPattern.ReplaceAllString(s, "***")
+	return tokenParamPattern.ReplaceAllString(s, "${1}***")
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
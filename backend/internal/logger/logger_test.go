@@ -0,0 +1,26 @@
+package logger
+
+import "testing"
+
+func TestRedactString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"普通文本", "用户登录成功", "用户登录成功"},
+		{"Bearer 令牌", "Authorization: Bearer abc.def-123", "Authorization: Bearer ***"},
+		{"JWT", "token eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig-1 invalid", "token *** invalid"},
+		{"重置链接", "请打开 https://example.com/reset-password?token=Ab3_x-9 重置密码", "请打开 https://example.com/reset-password?token=*** 重置密码"},
+		{"多个参数", "/callback?a=1&refresh_token=xyz&b=2", "/callback?a=1&refresh_token=***&b=2"},
+		{"大小写与票据", "Ticket=T123#frag", "Ticket=***#frag"},
+		{"不是参数", "tokens are rotated", "tokens are rotated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactString(tt.in); got != tt.want {
+				t.Errorf("RedactString(%q) = %q，期望 %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/logger"
+	"strings"
+	"time"
+)
+
+// Message 一封纯文本邮件
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送接口，按配置选择 SMTP、写文件或打印日志实现
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewMailer 根据 mail.driver 创建发送器，未知驱动回退为日志输出
+func NewMailer(cfg config.MailConfig) Mailer {
+	switch cfg.Driver {
+	case "smtp":
+		return &SMTPMailer{cfg: cfg}
+	case "file":
+		return &FileMailer{dir: cfg.FileDir, from: cfg.From}
+	default:
+		return &LogMailer{from: cfg.From}
+	}
+}
+
+// SMTPMailer 通过 SMTP 发送，服务端支持时自动使用 STARTTLS；未配置用户名时不做认证
+type SMTPMailer struct {
+	cfg config.MailConfig
+}
+
+// smtpTimeout ctx 未设置截止时间时，单封邮件从连接到发送完成的超时
+const smtpTimeout = 30 * time.Second
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	addr := fmt.Sprintf("%s:%d", m.cfg.Host, m.cfg.Port)
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	// 读写都受截止时间约束；ctx 提前取消时关闭连接，阻塞中的读写随即返回，不会遗留连接与协程
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return contextError(ctx, err)
+	}
+	defer c.Close()
+	if err := m.deliver(c, msg); err != nil {
+		return contextError(ctx, err)
+	}
+	return nil
+}
+
+// deliver 与 smtp.SendMail 相同的会话流程：服务端支持时启用 STARTTLS，配置了用户名时认证
+func (m *SMTPMailer) deliver(c *smtp.Client, msg Message) error {
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if m.cfg.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: 服务端不支持 AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(envelopeAddress(m.cfg.From)); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(m.cfg.From, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// contextError ctx 已取消或超时时返回 ctx 的错误，而不是关闭连接引起的读写错误
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// FileMailer 将邮件写成 .eml 文件，便于本地开发与测试查看
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405.000000000"),
+		unsafeFileChars.ReplaceAllString(strings.Join(msg.To, "_"), "_"))
+	return os.WriteFile(filepath.Join(m.dir, name), buildMessage(m.from, msg), 0o600)
+}
+
+// LogMailer 仅将邮件写入日志，用于开发环境。正文可能含重置链接等凭据，只在 debug 级别输出，
+// 其中的令牌参数同样会被替换
+type LogMailer struct {
+	from string
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "邮件发送(日志模式)", "from", m.from, "to", strings.Join(msg.To, ","), "subject", msg.Subject, "body_bytes", len(msg.Body))
+	slog.DebugContext(ctx, "邮件正文(日志模式)", "subject", msg.Subject, "body", logger.RedactString(msg.Body))
+	return nil
+}
+
+// buildMessage 组装 RFC 5322 报文，主题与正文按 UTF-8 编码
+func buildMessage(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from + "\r\n")
+	buf.WriteString("To: " + strings.Join(msg.To, ", ") + "\r\n")
+	buf.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", msg.Subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// envelopeAddress 从 "名称 <地址>" 中取出信封发件地址
+func envelopeAddress(from string) string {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		if j := strings.LastIndex(from, ">"); j > i {
+			return from[i+1 : j]
+		}
+	}
+	return from
+}
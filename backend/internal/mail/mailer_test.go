@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"siqian-admin/internal/config"
+)
+
+// 服务端接受连接后不作任何响应时，Send 应在 ctx 超时后返回并关闭连接
+func TestSMTPMailerSendStalledServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	defer ln.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// 客户端关闭连接后读到 EOF
+		_, _ = io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	mailer := &SMTPMailer{cfg: config.MailConfig{Host: "127.0.0.1", Port: addr.Port, From: "test <test@localhost>"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = mailer.Send(ctx, Message{To: []string{"user@localhost"}, Subject: "测试", Body: "正文"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send() 错误 = %v，期望 context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send() 耗时 %v，未按 ctx 截止时间返回", elapsed)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Error("Send() 返回后连接仍未关闭")
+	}
+}
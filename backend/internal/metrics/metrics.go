@@ -0,0 +1,54 @@
+// Package metrics Prometheus 运行指标：HTTP 请求量与耗时、登录结果、在线令牌数、
+// 数据库与 Redis 连接池、访问日志队列以及 Go 运行时
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "siqian"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP 请求数，按方法、路由模板与状态码统计",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP 请求耗时（秒），按方法、路由模板与状态码统计",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"method", "route", "status"})
+
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "logins_total",
+		Help:      "登录次数，result 为 success 或 failure",
+	}, []string{"result"})
+)
+
+// UnmatchedRoute 未匹配到路由的请求统一归到该标签，避免任意路径撑大指标基数
+const UnmatchedRoute = "unmatched"
+
+// ObserveHTTP 记录一次 HTTP 请求，route 为路由模板（如 /api/v1/users/:id）
+func ObserveHTTP(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(method, route, code).Inc()
+	httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// ObserveLogin 记录一次登录结果（含两步验证与过期改密后的登录）
+func ObserveLogin(result string) {
+	logins.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"siqian-admin/internal/service"
+	sysservice "siqian-admin/internal/sys/service"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// scrapeTimeout 采集时读取 Redis 的超时，避免 Redis 异常时拖住抓取
+const scrapeTimeout = 3 * time.Second
+
+// NewRegistry 注册全部指标；连接池、在线令牌数与访问日志队列在每次抓取时读取当前值
+func NewRegistry(db *gorm.DB, rdb *redis.Client, sessionService *service.SessionService, accessLogWriter *sysservice.AccessLogWriter) (*prometheus.Registry, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	reg := prometheus.NewRegistry()
+	for _, c := range []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(sqlDB, db.Migrator().CurrentDatabase()),
+		httpRequests,
+		httpDuration,
+		logins,
+		newSessionCollector(sessionService),
+		newRedisPoolCollector(rdb),
+		newAccessLogCollector(accessLogWriter),
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return reg, nil
+}
+
+// sessionCollector Redis 白名单中未过期的访问令牌数
+type sessionCollector struct {
+	sessions *service.SessionService
+	active   *prometheus.Desc
+}
+
+func newSessionCollector(sessions *service.SessionService) *sessionCollector {
+	return &sessionCollector{
+		sessions: sessions,
+		active: prometheus.NewDesc(prometheus.BuildFQName(namespace, "auth", "active_sessions"),
+			"Redis 白名单中未过期的访问令牌数", nil, nil),
+	}
+}
+
+func (c *sessionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+}
+
+func (c *sessionCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+	n, err := c.sessions.CountActiveTokens(ctx)
+	if err != nil {
+		slog.Error("统计在线令牌数失败", "err", err)
+		ch <- prometheus.NewInvalidMetric(c.active, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(n))
+}
+
+// redisPoolCollector go-redis 连接池状态
+type redisPoolCollector struct {
+	rdb                   *redis.Client
+	hits, misses, timeout *prometheus.Desc
+	total, idle, stale    *prometheus.Desc
+}
+
+func newRedisPoolCollector(rdb *redis.Client) *redisPoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "redis_pool", name), help, nil, nil)
+	}
+	return &redisPoolCollector{
+		rdb:     rdb,
+		hits:    desc("hits_total", "从连接池取到空闲连接的次数"),
+		misses:  desc("misses_total", "连接池无空闲连接需新建的次数"),
+		timeout: desc("timeouts_total", "等待连接超时的次数"),
+		total:   desc("connections", "连接池中的连接数"),
+		idle:    desc("idle_connections", "空闲连接数"),
+		stale:   desc("stale_connections_total", "因过期被移除的连接数"),
+	}
+}
+
+func (c *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.hits, c.misses, c.timeout, c.total, c.idle, c.stale} {
+		ch <- d
+	}
+}
+
+func (c *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.rdb.PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeout, prometheus.CounterValue, float64(s.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(s.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.stale, prometheus.CounterValue, float64(s.StaleConns))
+}
+
+// accessLogCollector 访问日志写入队列的积压与累计计数
+type accessLogCollector struct {
+	writer                             *sysservice.AccessLogWriter
+	length, capacity                   *prometheus.Desc
+	enqueued, written, dropped, failed *prometheus.Desc
+}
+
+func newAccessLogCollector(writer *sysservice.AccessLogWriter) *accessLogCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "access_log", name), help, nil, nil)
+	}
+	return &accessLogCollector{
+		writer:   writer,
+		length:   desc("queue_length", "队列中等待写入的访问日志数"),
+		capacity: desc("queue_capacity", "队列容量"),
+		enqueued: desc("enqueued_total", "成功入队的访问日志数"),
+		written:  desc("written_total", "已写入数据库的访问日志数"),
+		dropped:  desc("dropped_total", "因队列满或已关闭被丢弃的访问日志数"),
+		failed:   desc("failed_total", "写入数据库失败的访问日志数"),
+	}
+}
+
+func (c *accessLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.length, c.capacity, c.enqueued, c.written, c.dropped, c.failed} {
+		ch <- d
+	}
+}
+
+func (c *accessLogCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.writer.Stats()
+	ch <- prometheus.MustNewConstMetric(c.length, prometheus.GaugeValue, float64(s.Length))
+	ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(s.Capacity))
+	ch <- prometheus.MustNewConstMetric(c.enqueued, prometheus.CounterValue, float64(s.Enqueued))
+	ch <- prometheus.MustNewConstMetric(c.written, prometheus.CounterValue, float64(s.Written))
+	ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(s.Dropped))
+	ch <- prometheus.MustNewConstMetric(c.failed, prometheus.CounterValue, float64(s.Failed))
+}
@@ -0,0 +1,258 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"siqian-admin/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+const truncatedSuffix = "...(已截断)"
+
+// neverCapturedRoutes 登录、两步验证接口的请求与响应含密码、验证码、恢复码、绑定密钥与令牌，
+// 无论 routes 如何配置（包括 "*"）都不采集，该路由本身及其下级路由均适用
+var neverCapturedRoutes = []string{"/api/v1/auth", "/api/v1/profile/2fa"}
+
+// bodyCapture 按路由采集请求参数、请求体与响应体，写入访问日志前对敏感字段脱敏
+type bodyCapture struct {
+	all         bool
+	routes      map[string]struct{}
+	maxBytes    int
+	maskFields  map[string]struct{}
+	maskPattern *regexp.Regexp // 截断后无法解析的 JSON 按正则脱敏
+	successRate float64
+	failureRate float64
+}
+
+// capturedBody 一次请求采集到的内容
+type capturedBody struct {
+	Query        string
+	RequestBody  string
+	ResponseBody string
+}
+
+// newBodyCapture 未配置任何路由时返回 nil，表示不采集
+func newBodyCapture(cfg config.AccessLogCaptureConfig) *bodyCapture {
+	if len(cfg.Routes) == 0 {
+		return nil
+	}
+	bc := &bodyCapture{
+		routes:      make(map[string]struct{}, len(cfg.Routes)),
+		maxBytes:    cfg.MaxBodyBytes,
+		maskFields:  make(map[string]struct{}, len(cfg.MaskFields)),
+		successRate: cfg.SuccessSampleRate,
+		failureRate: cfg.FailureSampleRate,
+	}
+	if bc.maxBytes <= 0 {
+		bc.maxBytes = 4096
+	}
+	for _, route := range cfg.Routes {
+		route = strings.TrimSpace(route)
+		if route == "*" {
+			bc.all = true
+			continue
+		}
+		if method, path, ok := strings.Cut(route, " "); ok {
+			bc.routes[RouteKey(strings.ToUpper(method), strings.TrimSpace(path))] = struct{}{}
+		}
+	}
+	quoted := make([]string, 0, len(cfg.MaskFields))
+	for _, field := range cfg.MaskFields {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		bc.maskFields[field] = struct{}{}
+		quoted = append(quoted, regexp.QuoteMeta(field))
+	}
+	if len(quoted) > 0 {
+		// 值可能是字符串、数组（如 recovery_codes）或数字等，截断处之后的部分同样替换
+		bc.maskPattern = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)(\[[^\]]*\]?|"(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	}
+	return bc
+}
+
+// enabled 路由（gin 注册的路由模板）是否开启采集
+func (bc *bodyCapture) enabled(method, route string) bool {
+	if bc == nil || route == "" {
+		return false
+	}
+	for _, prefix := range neverCapturedRoutes {
+		if route == prefix || strings.HasPrefix(route, prefix+"/") {
+			return false
+		}
+	}
+	if bc.all {
+		return true
+	}
+	_, ok := bc.routes[RouteKey(method, route)]
+	return ok
+}
+
+// sampled 按请求结果分别采样，status >= 400 视为失败
+func (bc *bodyCapture) sampled(status int) bool {
+	rate := bc.successRate
+	if status >= 400 {
+		rate = bc.failureRate
+	}
+	return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+}
+
+// readRequest 读取至多 maxBytes+1 字节的请求体，并把已读部分放回，处理器仍可完整读取
+func (bc *bodyCapture) readRequest(c *gin.Context) []byte {
+	if c.Request.Body == nil || !textualContent(c.ContentType()) {
+		return nil
+	}
+	head, _ := io.ReadAll(io.LimitReader(c.Request.Body, int64(bc.maxBytes)+1))
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), c.Request.Body), c.Request.Body}
+	return head
+}
+
+// wrapResponse 替换 ResponseWriter，写出响应的同时保留前 maxBytes+1 字节
+func (bc *bodyCapture) wrapResponse(c *gin.Context) *captureWriter {
+	w := &captureWriter{ResponseWriter: c.Writer, limit: bc.maxBytes + 1}
+	c.Writer = w
+	return w
+}
+
+// build 脱敏并截断后生成要入库的内容
+func (bc *bodyCapture) build(c *gin.Context, request []byte, response *captureWriter) capturedBody {
+	body := capturedBody{Query: bc.maskQuery(c.Request.URL.RawQuery)}
+	if request != nil {
+		body.RequestBody = bc.maskBody(c.ContentType(), request)
+	} else if c.Request.ContentLength > 0 {
+		body.RequestBody = "[" + c.ContentType() + " 未采集]"
+	}
+	if response != nil && response.buf.Len() > 0 {
+		contentType, _, _ := mime.ParseMediaType(response.Header().Get("Content-Type"))
+		if textualContent(contentType) {
+			body.ResponseBody = bc.maskBody(contentType, response.buf.Bytes())
+		} else {
+			body.ResponseBody = "[" + contentType + " 未采集]"
+		}
+	}
+	return body
+}
+
+func (bc *bodyCapture) maskQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return bc.truncate([]byte(raw))
+	}
+	for key := range values {
+		if bc.masked(key) {
+			values[key] = []string{"***"}
+		}
+	}
+	return bc.truncate([]byte(values.Encode()))
+}
+
+func (bc *bodyCapture) maskBody(contentType string, data []byte) string {
+	truncated := len(data) > bc.maxBytes
+	if truncated {
+		data = data[:bc.maxBytes]
+	}
+
+	var masked string
+	switch {
+	case contentType == "application/x-www-form-urlencoded":
+		masked = bc.maskQuery(string(data))
+	case strings.Contains(contentType, "json"):
+		var v interface{}
+		if !truncated && json.Unmarshal(data, &v) == nil {
+			if out, err := json.Marshal(bc.maskValue(v)); err == nil {
+				masked = bc.truncate(out)
+				break
+			}
+		}
+		if bc.maskPattern != nil {
+			data = bc.maskPattern.ReplaceAll(data, []byte(`${1}"***"`))
+		}
+		masked = bc.truncate(data)
+	default:
+		masked = bc.truncate(data)
+	}
+
+	if truncated && !strings.HasSuffix(masked, truncatedSuffix) {
+		masked += truncatedSuffix
+	}
+	return masked
+}
+
+func (bc *bodyCapture) maskValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if bc.masked(k) {
+				val[k] = "***"
+			} else {
+				val[k] = bc.maskValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = bc.maskValue(item)
+		}
+	}
+	return v
+}
+
+func (bc *bodyCapture) masked(field string) bool {
+	_, ok := bc.maskFields[strings.ToLower(field)]
+	return ok
+}
+
+func (bc *bodyCapture) truncate(data []byte) string {
+	if len(data) <= bc.maxBytes {
+		return string(data)
+	}
+	return string(bytes.ToValidUTF8(data[:bc.maxBytes], nil)) + truncatedSuffix
+}
+
+// textualContent 只采集文本类内容，文件上传等二进制内容不读取
+func textualContent(contentType string) bool {
+	return contentType == "" ||
+		strings.Contains(contentType, "json") ||
+		strings.HasPrefix(contentType, "text/") ||
+		contentType == "application/x-www-form-urlencoded"
+}
+
+// captureWriter 写出响应的同时保留前 limit 字节
+type captureWriter struct {
+	gin.ResponseWriter
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.keep(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *captureWriter) keep(data []byte) {
+	if room := w.limit - w.buf.Len(); room > 0 {
+		if len(data) > room {
+			data = data[:room]
+		}
+		w.buf.Write(data)
+	}
+}
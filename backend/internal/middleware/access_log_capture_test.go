@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+
+	"siqian-admin/internal/config"
+)
+
+func testCapture(routes []string, maxBytes int) *bodyCapture {
+	return newBodyCapture(config.AccessLogCaptureConfig{
+		Routes:       routes,
+		MaxBodyBytes: maxBytes,
+		MaskFields: []string{"password", "new_password", "token", "refresh_token", "ticket", "secret",
+			"otpauth_uri", "recovery_codes", "recovery_code", "code"},
+		SuccessSampleRate: 1,
+		FailureSampleRate: 1,
+	})
+}
+
+func TestBodyCaptureEnabled(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []string
+		method string
+		route  string
+		want   bool
+	}{
+		{"配置的路由", []string{"POST /api/v1/users"}, "POST", "/api/v1/users", true},
+		{"方法不区分大小写", []string{"post /api/v1/users"}, "POST", "/api/v1/users", true},
+		{"未配置的方法", []string{"POST /api/v1/users"}, "PUT", "/api/v1/users", false},
+		{"未匹配的路由", []string{"POST /api/v1/users"}, "POST", "", false},
+		{"全部路由", []string{"*"}, "PUT", "/api/v1/roles/:id", true},
+		{"登录接口始终不采集", []string{"*"}, "POST", "/api/v1/auth/login", false},
+		{"显式配置也不采集登录接口", []string{"POST /api/v1/auth/login/2fa"}, "POST", "/api/v1/auth/login/2fa", false},
+		{"两步验证接口始终不采集", []string{"*"}, "POST", "/api/v1/profile/2fa/setup", false},
+		{"前缀相似的路由照常采集", []string{"*"}, "POST", "/api/v1/authorizations", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testCapture(tt.routes, 0).enabled(tt.method, tt.route); got != tt.want {
+				t.Errorf("enabled(%s %s) = %v，期望 %v", tt.method, tt.route, got, tt.want)
+			}
+		})
+	}
+
+	var none *bodyCapture
+	if none.enabled("POST", "/api/v1/users") {
+		t.Error("未配置路由时不应采集")
+	}
+}
+
+func TestBodyCaptureMaskBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxBytes    int
+		contentType string
+		body        string
+		want        string
+		leaks       []string // 结果中不能出现的内容
+	}{
+		{
+			name:        "JSON 字段",
+			contentType: "application/json",
+			body:        `{"username":"admin","password":"p@ss"}`,
+			want:        `{"password":"***","username":"admin"}`,
+		},
+		{
+			name:        "字段名不区分大小写",
+			contentType: "application/json",
+			body:        `{"Password":"p@ss","Token":"t"}`,
+			want:        `{"Password":"***","Token":"***"}`,
+		},
+		{
+			name:        "嵌套对象与数组",
+			contentType: "application/json",
+			body:        `{"items":[{"ticket":"a"},{"name":"b"}],"data":{"refresh_token":"r"}}`,
+			want:        `{"data":{"refresh_token":"***"},"items":[{"ticket":"***"},{"name":"b"}]}`,
+		},
+		{
+			name:        "两步验证字段",
+			contentType: "application/json",
+			body:        `{"secret":"JBSW","otpauth_uri":"otpauth://totp/x?secret=JBSW","recovery_codes":["aaaa-bbbb","cccc-dddd"],"code":"123456"}`,
+			want:        `{"code":"***","otpauth_uri":"***","recovery_codes":"***","secret":"***"}`,
+		},
+		{
+			name:        "截断的 JSON 按正则脱敏",
+			maxBytes:    60,
+			contentType: "application/json",
+			body:        `{"recovery_codes":["aaaa-bbbb","cccc-dddd"],"password":"p@ss","note":"` + strings.Repeat("x", 40) + `"}`,
+			leaks:       []string{"aaaa-bbbb", "cccc-dddd", "p@ss"},
+		},
+		{
+			name:        "截断处位于敏感值中间",
+			maxBytes:    30,
+			contentType: "application/json",
+			body:        `{"name":"a","password":"0123456789abcdef"}`,
+			leaks:       []string{"0123"},
+		},
+		{
+			name:        "表单",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "username=admin&new_password=p%40ss",
+			want:        "new_password=%2A%2A%2A&username=admin",
+		},
+		{
+			name:        "纯文本只截断",
+			maxBytes:    5,
+			contentType: "text/plain",
+			body:        "hello world",
+			want:        "hello" + truncatedSuffix,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := testCapture([]string{"*"}, tt.maxBytes).maskBody(tt.contentType, []byte(tt.body))
+			if tt.want != "" && got != tt.want {
+				t.Errorf("maskBody() = %s，期望 %s", got, tt.want)
+			}
+			for _, leak := range tt.leaks {
+				if strings.Contains(got, leak) {
+					t.Errorf("maskBody() = %s，泄露了 %q", got, leak)
+				}
+			}
+		})
+	}
+}
+
+func TestBodyCaptureMaskQuery(t *testing.T) {
+	bc := testCapture([]string{"*"}, 0)
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"空", "", ""},
+		{"无敏感参数", "page=1&size=10", "page=1&size=10"},
+		{"敏感参数", "token=abc&page=1", "page=1&token=%2A%2A%2A"},
+		{"重复参数", "ticket=a&ticket=b", "ticket=%2A%2A%2A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bc.maskQuery(tt.raw); got != tt.want {
+				t.Errorf("maskQuery(%q) = %q，期望 %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsMiddleware 按路由模板统计请求数与耗时；需注册在 RecoveryMiddleware 之前（外层），panic 转成的 500 才会被计入
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		metrics.ObserveHTTP(c.Request.Method, c.FullPath(), c.Writer.Status(), time.Since(start))
+	}
+}
+
+// MetricsAccessMiddleware /metrics 只允许来自 allow_ips 的请求，或携带 Authorization: Bearer <token> 的请求。
+// 白名单按 TCP 连接的对端地址判断，不信任 X-Forwarded-For；经反向代理抓取时请使用令牌
+func MetricsAccessMiddleware(cfg config.MetricsConfig) (gin.HandlerFunc, error) {
+	var nets []*net.IPNet
+	for _, s := range cfg.AllowIPs {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的指标白名单 IP: %s", s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("无效的指标白名单网段: %s", s)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return func(c *gin.Context) {
+		if cfg.Token != "" {
+			token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if ok && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) == 1 {
+				c.Next()
+				return
+			}
+		}
+		if ip := net.ParseIP(c.RemoteIP()); ip != nil {
+			for _, n := range nets {
+				if n.Contains(ip) {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "无权访问"})
+	}, nil
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"siqian-admin/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricsAccessMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	access, err := MetricsAccessMiddleware(config.MetricsConfig{
+		AllowIPs: []string{"127.0.0.1", "10.0.0.0/8", " ", "::1"},
+		Token:    "scrape-token",
+	})
+	if err != nil {
+		t.Fatalf("创建中间件失败: %v", err)
+	}
+	r := gin.New()
+	r.GET("/metrics", access, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		authorization string
+		forwardedFor  string
+		want          int
+	}{
+		{"白名单 IP", "127.0.0.1:5000", "", "", http.StatusOK},
+		{"白名单网段", "10.1.2.3:5000", "", "", http.StatusOK},
+		{"白名单 IPv6", "[::1]:5000", "", "", http.StatusOK},
+		{"不在白名单", "192.168.1.1:5000", "", "", http.StatusForbidden},
+		{"不信任 X-Forwarded-For", "192.168.1.1:5000", "", "127.0.0.1", http.StatusForbidden},
+		{"正确的令牌", "192.168.1.1:5000", "Bearer scrape-token", "", http.StatusOK},
+		{"错误的令牌", "192.168.1.1:5000", "Bearer wrong", "", http.StatusForbidden},
+		{"缺少 Bearer 前缀", "192.168.1.1:5000", "scrape-token", "", http.StatusForbidden},
+		{"其他认证方式", "192.168.1.1:5000", "Basic scrape-token", "", http.StatusForbidden},
+		{"空令牌", "192.168.1.1:5000", "Bearer ", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("状态码 = %d，期望 %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsAccessMiddlewareInvalidConfig(t *testing.T) {
+	for _, ip := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := MetricsAccessMiddleware(config.MetricsConfig{AllowIPs: []string{ip}}); err == nil {
+			t.Errorf("白名单 %q 应报错", ip)
+		}
+	}
+}
+
+func TestMetricsAccessMiddlewareWithoutToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	access, err := MetricsAccessMiddleware(config.MetricsConfig{})
+	if err != nil {
+		t.Fatalf("创建中间件失败: %v", err)
+	}
+	r := gin.New()
+	r.GET("/metrics", access, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// 未配置令牌时，空的 Bearer 不能与空令牌匹配
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.RemoteAddr = "192.168.1.1:5000"
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("状态码 = %d，期望 %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -1,35 +1,21 @@
 package middleware
 
 import (
-	"context"
-	"fmt"
 	"strings"
 	"time"
 
 	"siqian-admin/internal/config"
 	"siqian-admin/internal/sys/model"
+	sysservice "siqian-admin/internal/sys/service"
 	"siqian-admin/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func SetupMiddleware(r *gin.Engine, cfg *config.Config) {
-	// CORS中间件
-	r.Use(CORSMiddleware())
-
-	// 日志中间件（控制台）
-	r.Use(gin.Logger())
-
-	// 恢复中间件
-	r.Use(gin.Recovery())
-
-	// 设置Gin模式
-	gin.SetMode(cfg.Server.Mode)
-}
-
-// RequestLogMiddleware 记录访问日志到数据库
-func RequestLogMiddleware(db *gorm.DB) gin.HandlerFunc {
+// RequestLogMiddleware 记录访问日志，交由 AccessLogWriter 批量写入数据库；
+// 按 capture 配置的路由与采样率附带脱敏后的请求参数、请求体和响应体
+func RequestLogMiddleware(writer *sysservice.AccessLogWriter, capture config.AccessLogCaptureConfig) gin.HandlerFunc {
+	bc := newBodyCapture(capture)
 	return func(c *gin.Context) {
 		start := time.Now()
 
@@ -56,6 +42,15 @@ func RequestLogMiddleware(db *gorm.DB) gin.HandlerFunc {
 			}
 		}
 
+		// GET 请求不记录，也不采集内容
+		var request []byte
+		var response *captureWriter
+		capturing := method != "GET" && bc.enabled(method, c.FullPath())
+		if capturing {
+			request = bc.readRequest(c)
+			response = bc.wrapResponse(c)
+		}
+
 		c.Next()
 
 		duration := time.Since(start)
@@ -66,24 +61,27 @@ func RequestLogMiddleware(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 写数据库（异步，避免阻塞请求）
-		go func() {
-			log := model.AccessLog{
-				Username:   username,
-				Path:       path,
-				Method:     method,
-				IP:         ip,
-				StatusCode: status,
-				UserAgent:  ua,
-				LatencyMs:  duration.Milliseconds(),
-				CreatedAt:  time.Now(),
-			}
-			if db != nil {
-				if err := db.WithContext(context.Background()).Create(&log).Error; err != nil {
-					// 控制台输出错误，便于排查
-					fmt.Printf("访问日志写入失败: %v\n", err)
-				}
-			}
-		}()
+		var body capturedBody
+		if capturing && bc.sampled(status) {
+			body = bc.build(c, request, response)
+		}
+
+		// 入队后由后台批量写入，队列满时按 overflow_policy 处理
+		if writer != nil {
+			writer.Enqueue(model.AccessLog{
+				RequestID:    utils.RequestIDFrom(c.Request.Context()),
+				Username:     username,
+				Path:         path,
+				Method:       method,
+				IP:           ip,
+				StatusCode:   status,
+				UserAgent:    ua,
+				LatencyMs:    duration.Milliseconds(),
+				Query:        body.Query,
+				RequestBody:  body.RequestBody,
+				ResponseBody: body.ResponseBody,
+				CreatedAt:    time.Now(),
+			})
+		}
 	}
 }
@@ -0,0 +1,258 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/service"
+	"siqian-admin/internal/sys/model"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 特殊权限标识，不作为权限码对外列出
+const (
+	PermissionPublic = "@public" // 无需登录
+	PermissionLogin  = "@login"  // 登录即可访问
+)
+
+// RoutePermissions 路由到权限码的声明表，键为 "METHOD 完整路径"，如 "POST /api/v1/roles/:id/menus"
+type RoutePermissions map[string]string
+
+// RouteKey 生成声明表的键
+func RouteKey(method, path string) string {
+	return method + " " + path
+}
+
+// PermissionCode 权限码及其覆盖的路由
+type PermissionCode struct {
+	Code   string   `json:"code"`
+	Routes []string `json:"routes"`
+}
+
+// Codes 列出全部权限码（去重、排序），供菜单/按钮绑定
+func (p RoutePermissions) Codes() []PermissionCode {
+	routes := map[string][]string{}
+	for route, code := range p {
+		if code == PermissionPublic || code == PermissionLogin {
+			continue
+		}
+		routes[code] = append(routes[code], route)
+	}
+
+	codes := make([]PermissionCode, 0, len(routes))
+	for code, rs := range routes {
+		sort.Strings(rs)
+		codes = append(codes, PermissionCode{Code: code, Routes: rs})
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
+
+// Match 查找与请求匹配的声明，path 可以是路由模式（/users/:id）也可以是实际路径（/users/123）。
+// 与 gin 一致，多个模式都能匹配时优先静态段更多的路由
+func (p RoutePermissions) Match(method, path string) (string, string, bool) {
+	if code, ok := p[RouteKey(method, path)]; ok {
+		return RouteKey(method, path), code, true
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	bestKey, bestStatic := "", -1
+	for key := range p {
+		m, pattern, ok := strings.Cut(key, " ")
+		if !ok || m != method {
+			continue
+		}
+		if static, ok := matchRoute(strings.Split(strings.Trim(pattern, "/"), "/"), segments); ok && static > bestStatic {
+			bestKey, bestStatic = key, static
+		}
+	}
+	if bestKey == "" {
+		return "", "", false
+	}
+	return bestKey, p[bestKey], true
+}
+
+// matchRoute 按段匹配路由模式，返回命中的静态段数
+func matchRoute(pattern, segments []string) (int, bool) {
+	static := 0
+	for i, part := range pattern {
+		if strings.HasPrefix(part, "*") {
+			return static, true
+		}
+		if i >= len(segments) {
+			return 0, false
+		}
+		if strings.HasPrefix(part, ":") {
+			if segments[i] == "" {
+				return 0, false
+			}
+			continue
+		}
+		if part != segments[i] {
+			return 0, false
+		}
+		static++
+	}
+	return static, len(pattern) == len(segments)
+}
+
+// Verify 启动时校验：prefix 下的每个路由都必须声明权限，声明表中也不能有不存在的路由
+func (p RoutePermissions) Verify(routes gin.RoutesInfo, prefix string) error {
+	registered := map[string]struct{}{}
+	var missing []string
+	for _, r := range routes {
+		if !strings.HasPrefix(r.Path, prefix) {
+			continue
+		}
+		key := RouteKey(r.Method, r.Path)
+		registered[key] = struct{}{}
+		if code := strings.TrimSpace(p[key]); code == "" {
+			missing = append(missing, key)
+		}
+	}
+
+	var stale []string
+	for key := range p {
+		if _, ok := registered[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+
+	if len(missing) == 0 && len(stale) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	var parts []string
+	if len(missing) > 0 {
+		parts = append(parts, "未声明权限的路由: "+strings.Join(missing, ", "))
+	}
+	if len(stale) > 0 {
+		parts = append(parts, "声明了但不存在的路由: "+strings.Join(stale, ", "))
+	}
+	return fmt.Errorf("路由权限声明不完整：%s", strings.Join(parts, "；"))
+}
+
+// PermissionMiddleware 按声明表校验当前路由所需权限，需挂在 AuthWhitelistMiddleware 之后。
+// 未声明的路由一律拒绝；配置的超级角色跳过校验
+func PermissionMiddleware(perms RoutePermissions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		need, declared := perms[RouteKey(c.Request.Method, c.FullPath())]
+		if !declared {
+			slog.ErrorContext(c.Request.Context(), "权限校验: 路由未声明权限", "method", c.Request.Method, "route", c.FullPath())
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权限访问"})
+			c.Abort()
+			return
+		}
+		if need == PermissionPublic || need == PermissionLogin {
+			c.Next()
+			return
+		}
+
+		snapshot, ok := sessionSnapshot(c)
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权限或会话失效"})
+			c.Abort()
+			return
+		}
+		if decision := Decide(need, snapshot.User, snapshot.Menus); !decision.Allowed {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "无权限访问",
+				"permission": need,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// 权限判定依据
+const (
+	DecisionPublic     = "public"     // 无需登录
+	DecisionLogin      = "login"      // 登录即可访问
+	DecisionSuperRole  = "super_role" // 持有超级角色
+	DecisionMenu       = "menu"       // 菜单/按钮上绑定了该权限标识
+	DecisionDenied     = "denied"     // 没有任何菜单提供该权限
+	DecisionUndeclared = "undeclared" // 路由未声明权限，一律拒绝
+)
+
+// PermissionDecision 一次权限判定的结果
+type PermissionDecision struct {
+	Permission string `json:"permission"`
+	Allowed    bool   `json:"allowed"`
+	Reason     string `json:"reason"`
+	SuperRole  string `json:"super_role,omitempty"` // Reason 为 super_role 时命中的角色编码
+}
+
+// Decide 按用户角色与菜单判定是否拥有权限码 need，与 PermissionMiddleware 使用同一套规则
+func Decide(need string, user *model.User, menus []model.Menu) PermissionDecision {
+	decision := PermissionDecision{Permission: need}
+	switch need {
+	case PermissionPublic:
+		decision.Allowed, decision.Reason = true, DecisionPublic
+		return decision
+	case PermissionLogin:
+		decision.Allowed, decision.Reason = true, DecisionLogin
+		return decision
+	}
+	if role := superRole(user); role != "" {
+		decision.Allowed, decision.Reason, decision.SuperRole = true, DecisionSuperRole, role
+		return decision
+	}
+	if _, ok := MenuPermissions(menus)[need]; ok {
+		decision.Allowed, decision.Reason = true, DecisionMenu
+		return decision
+	}
+	decision.Reason = DecisionDenied
+	return decision
+}
+
+// sessionSnapshot 读取认证中间件写入的会话快照
+func sessionSnapshot(c *gin.Context) (*service.SessionSnapshot, bool) {
+	v, exists := c.Get(SessionSnapshotKey)
+	if !exists {
+		return nil, false
+	}
+	snapshot, ok := v.(*service.SessionSnapshot)
+	return snapshot, ok && snapshot != nil
+}
+
+// MenuPermissions 收集菜单（含子菜单）上的权限标识
+func MenuPermissions(menus []model.Menu) map[string]struct{} {
+	perms := map[string]struct{}{}
+	var walk func(items []model.Menu)
+	walk = func(items []model.Menu) {
+		for _, m := range items {
+			if p := strings.TrimSpace(m.Permission); p != "" {
+				perms[p] = struct{}{}
+			}
+			if len(m.Children) > 0 {
+				walk(m.Children)
+			}
+		}
+	}
+	walk(menus)
+	return perms
+}
+
+// superRole 返回用户持有的第一个超级角色编码，没有时返回空串
+func superRole(user *model.User) string {
+	if user == nil {
+		return ""
+	}
+	superRoles := config.GetConfig().Permission.SuperRoles
+	for _, role := range user.Roles {
+		for _, code := range superRoles {
+			if role.Code == code {
+				return code
+			}
+		}
+	}
+	return ""
+}
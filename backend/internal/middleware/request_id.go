@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"siqian-admin/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDMiddleware 沿用客户端或网关传入的 X-Request-ID，没有或不合法时生成新的；
+// 写入 gin 上下文与请求 context，并在响应头中返回，便于关联控制台日志、访问日志与 SQL 日志
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(utils.RequestIDHeader)
+		if !utils.ValidRequestID(id) {
+			id = utils.NewRequestID()
+		}
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(utils.WithRequestID(c.Request.Context(), id))
+		c.Header(utils.RequestIDHeader, id)
+		// 开启链路追踪时把请求 ID 记到请求 span 上，便于从日志查到对应的 trace
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("request_id", id))
+
+		c.Next()
+	}
+}
@@ -0,0 +1,114 @@
+package router
+
+import "siqian-admin/internal/middleware"
+
+// routePermissions 全部 API 路由的权限声明。
+// 新增路由时必须在此登记，否则启动校验失败；权限码与菜单/按钮上的“权限标识”对应
+var routePermissions = middleware.RoutePermissions{
+	// 认证
+	"POST /api/v1/auth/login":                 middleware.PermissionPublic,
+	"POST /api/v1/auth/login/2fa":             middleware.PermissionPublic,
+	"POST /api/v1/auth/login/change-password": middleware.PermissionPublic,
+	"POST /api/v1/auth/refresh":               middleware.PermissionPublic,
+	"POST /api/v1/auth/forgot-password":       middleware.PermissionPublic,
+	"POST /api/v1/auth/reset-password":        middleware.PermissionPublic,
+	"POST /api/v1/auth/logout":                middleware.PermissionPublic,
+
+	// 用户管理
+	"POST /api/v1/users":                    "user:create",
+	"GET /api/v1/users":                     "user:list",
+	"GET /api/v1/users/:id":                 "user:query",
+	"PUT /api/v1/users/:id":                 "user:update",
+	"DELETE /api/v1/users/:id":              "user:delete",
+	"DELETE /api/v1/users/batch":            "user:delete",
+	"POST /api/v1/users/:id/roles":          "user:assign-role",
+	"POST /api/v1/users/:id/reset-password": "user:reset-password",
+	"POST /api/v1/users/:id/unlock":         "user:unlock",
+	"GET /api/v1/users/:id/sessions":        "user:session",
+	"POST /api/v1/users/:id/force-logout":   "user:force-logout",
+	"GET /api/v1/users/:id/role-grants":     "user:query",
+	"POST /api/v1/users/:id/role-grants":    "user:assign-role",
+	"GET /api/v1/role-grants/expiring":      "user:list",
+
+	// 组织管理
+	"POST /api/v1/organizations":       "org:create",
+	"GET /api/v1/organizations":        "org:list",
+	"GET /api/v1/organizations/tree":   "org:list",
+	"GET /api/v1/organizations/:id":    "org:query",
+	"PUT /api/v1/organizations/:id":    "org:update",
+	"DELETE /api/v1/organizations/:id": "org:delete",
+
+	// 角色管理
+	"POST /api/v1/roles":                "role:create",
+	"GET /api/v1/roles":                 "role:list",
+	"GET /api/v1/roles/:id":             "role:query",
+	"PUT /api/v1/roles/:id":             "role:update",
+	"DELETE /api/v1/roles/:id":          "role:delete",
+	"POST /api/v1/roles/:id/menus":      "role:assign-menu",
+	"POST /api/v1/roles/:id/users":      "role:assign-user",
+	"GET /api/v1/roles/:id/permissions": "role:query",
+
+	// 职责分离约束
+	"POST /api/v1/role-constraints":           "role:constraint",
+	"GET /api/v1/role-constraints":            "role:list",
+	"GET /api/v1/role-constraints/violations": "role:audit",
+	"GET /api/v1/role-constraints/:id":        "role:query",
+	"PUT /api/v1/role-constraints/:id":        "role:constraint",
+	"DELETE /api/v1/role-constraints/:id":     "role:constraint",
+
+	// 菜单管理
+	"POST /api/v1/menus":              "menu:create",
+	"GET /api/v1/menus":               "menu:list",
+	"GET /api/v1/menus/:id":           "menu:query",
+	"PUT /api/v1/menus/:id":           "menu:update",
+	"DELETE /api/v1/menus/:id":        "menu:delete",
+	"GET /api/v1/permissions":         "menu:list",
+	"GET /api/v1/permissions/explain": "permission:explain",
+
+	// 字典管理；字典数据供全部页面渲染使用，登录即可读取
+	"POST /api/v1/dicts":               "dict:create",
+	"GET /api/v1/dicts":                "dict:list",
+	"GET /api/v1/dicts/all-with-items": middleware.PermissionLogin,
+	"GET /api/v1/dicts/code/:code":     middleware.PermissionLogin,
+	"GET /api/v1/dicts/:id":            "dict:query",
+	"PUT /api/v1/dicts/:id":            "dict:update",
+	"DELETE /api/v1/dicts/:id":         "dict:delete",
+	"POST /api/v1/dicts/:id/items":     "dict:update",
+	"GET /api/v1/dicts/:id/items":      "dict:query",
+	"POST /api/v1/dict-items":          "dict:update",
+	"GET /api/v1/dict-items/:id":       "dict:query",
+	"PUT /api/v1/dict-items/:id":       "dict:update",
+	"DELETE /api/v1/dict-items/:id":    "dict:update",
+
+	// 个人资料：仅操作当前用户自己的数据
+	"GET /api/v1/profile":                         middleware.PermissionLogin,
+	"PUT /api/v1/profile":                         middleware.PermissionLogin,
+	"GET /api/v1/profile/menus":                   middleware.PermissionLogin,
+	"POST /api/v1/profile/change-password":        middleware.PermissionLogin,
+	"POST /api/v1/profile/upload-avatar":          middleware.PermissionLogin,
+	"GET /api/v1/profile/2fa":                     middleware.PermissionLogin,
+	"POST /api/v1/profile/2fa/setup":              middleware.PermissionLogin,
+	"POST /api/v1/profile/2fa/confirm":            middleware.PermissionLogin,
+	"POST /api/v1/profile/2fa/disable":            middleware.PermissionLogin,
+	"POST /api/v1/profile/2fa/recovery-codes":     middleware.PermissionLogin,
+	"GET /api/v1/profile/sessions":                middleware.PermissionLogin,
+	"DELETE /api/v1/profile/sessions":             middleware.PermissionLogin,
+	"DELETE /api/v1/profile/sessions/:session_id": middleware.PermissionLogin,
+	"GET /api/v1/profile/logins":                  middleware.PermissionLogin,
+
+	// 访问日志
+	"GET /api/v1/logs":              "log:list",
+	"GET /api/v1/logs/export":       "log:export",
+	"GET /api/v1/logs/stats":        "log:stats",
+	"GET /api/v1/logs/queue-stats":  "log:list",
+	"GET /api/v1/logs/chain/verify": "log:verify",
+	"GET /api/v1/logs/retention":    "log:list",
+	"POST /api/v1/logs/purge":       "log:purge",
+	"DELETE /api/v1/logs/batch":     "log:delete",
+
+	// 登录历史与安全告警
+	"GET /api/v1/login-logs":               "log:login",
+	"GET /api/v1/security-alerts":          "log:security",
+	"POST /api/v1/security-alerts/:id/ack": "log:security",
+	"GET /api/v1/audit-logs":               "log:audit",
+}
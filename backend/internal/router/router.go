@@ -1,26 +1,59 @@
 package router
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"siqian-admin/internal/api"
 	"siqian-admin/internal/config"
+	"siqian-admin/internal/mail"
+	"siqian-admin/internal/metrics"
 	"siqian-admin/internal/middleware"
 	"siqian-admin/internal/service"
 	sysapi "siqian-admin/internal/sys/api"
 	sysservice "siqian-admin/internal/sys/service"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"gorm.io/gorm"
 )
 
-func SetupRouter(cfg *config.Config, db *gorm.DB, rdb *redis.Client) *gin.Engine {
-	r := gin.Default()
+// apiPrefix 该前缀下的路由都必须在 routePermissions 中声明权限
+const apiPrefix = "/api/v1"
+
+// SetupRouter 初始化服务与路由；ctx 控制后台任务的生命周期，由调用方在退出时取消
+func SetupRouter(ctx context.Context, cfg *config.Config, db *gorm.DB, rdb *redis.Client, accessLogWriter *sysservice.AccessLogWriter) (*gin.Engine, error) {
+	gin.SetMode(cfg.Server.Mode)
+	gin.DebugPrintRouteFunc = func(method, path, handler string, handlers int) {
+		slog.Debug("注册路由", "method", method, "path", path, "handler", handler)
+	}
+	r := gin.New()
+
+	// 链路追踪：沿用请求头 traceparent 中的上游 trace，为每个请求创建 span，
+	// 之后的 SQL 与 Redis 命令以请求 context 挂在该 span 下
+	if cfg.Tracing.Enabled {
+		r.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(func(req *http.Request) bool {
+			// 探针请求频繁且无排查价值，不生成 trace
+			return req.URL.Path != "/healthz" && req.URL.Path != "/readyz"
+		})))
+	}
+
+	// 请求 ID 最先设置，之后的请求日志、访问日志与 SQL 日志都带上它
+	r.Use(middleware.RequestIDMiddleware())
+	// 请求指标在 Recovery 外层统计，panic 转成的 500 同样计入
+	if cfg.Metrics.Enabled {
+		r.Use(middleware.MetricsMiddleware())
+	}
+	r.Use(middleware.RequestLoggerMiddleware(), middleware.RecoveryMiddleware())
 
 	// 全局 CORS
 	r.Use(middleware.CORSMiddleware())
 
 	// 全局请求访问日志
-	r.Use(middleware.RequestLogMiddleware(db))
+	r.Use(middleware.RequestLogMiddleware(accessLogWriter, cfg.AccessLog.Capture))
 
 	// 静态文件服务 - 提供上传文件的访问
 	r.Static("/uploads", "./uploads")
@@ -32,45 +65,86 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, rdb *redis.Client) *gin.Engine
 	roleService := sysservice.NewRoleService(db)
 	menuService := sysservice.NewMenuService(db)
 	dictService := sysservice.NewDictService(db)
-	accessLogService := sysservice.NewAccessLogService(db)
+	accessLogService := sysservice.NewAccessLogService(db, accessLogWriter, cfg.AccessLog.DeleteFloorDays, cfg.AccessLog.ChainKey)
+	accessLogChainService := sysservice.NewAccessLogChainService(db, cfg.AccessLog.ChainKey)
+	accessLogRetentionService := sysservice.NewAccessLogRetentionService(db, cfg.AccessLog)
+	auditLogService := sysservice.NewAuditLogService(db)
+	dataScopeService := sysservice.NewDataScopeService(db)
+	roleGrantService := sysservice.NewRoleGrantService(db)
+	roleConstraintService := sysservice.NewRoleConstraintService(db)
+	sessionService := service.NewSessionService(db, rdb, menuService)
+	twoFactorService := service.NewTwoFactorService(db, rdb)
+	loginGuard := service.NewLoginGuardService(rdb)
+	mailer := mail.NewMailer(cfg.Mail)
+	passwordResetService := service.NewPasswordResetService(db, rdb, mailer, userService, sessionService)
+	loginLogService := sysservice.NewLoginLogService(db, mailer, cfg.LoginLog)
+
+	// 后台清理过期的临时角色授权
+	go service.NewRoleGrantSweeper(roleGrantService, sessionService).Run(ctx)
+	// 定期清理过期访问日志并补齐分区
+	go accessLogRetentionService.Run(ctx)
 
 	// 初始化处理器
-	authHandler := api.NewAuthHandler(authService, menuService, rdb)
-	userHandler := sysapi.NewUserHandler(userService)
-	orgHandler := sysapi.NewOrganizationHandler(orgService)
-	roleHandler := sysapi.NewRoleHandler(roleService)
-	menuHandler := sysapi.NewMenuHandler(menuService)
+	authHandler := api.NewAuthHandler(authService, userService, menuService, sessionService, twoFactorService, loginGuard, loginLogService)
+	userHandler := sysapi.NewUserHandler(userService, dataScopeService, loginGuard, sessionService, loginLogService)
+	orgHandler := sysapi.NewOrganizationHandler(orgService, dataScopeService)
+	roleHandler := sysapi.NewRoleHandler(roleService, sessionService)
+	menuHandler := sysapi.NewMenuHandler(menuService, sessionService)
 	dictHandler := sysapi.NewDictHandler(dictService)
-	profileHandler := sysapi.NewProfileHandler(userService)
-	accessLogHandler := sysapi.NewAccessLogHandler(accessLogService)
+	profileHandler := sysapi.NewProfileHandler(userService, twoFactorService, sessionService, loginLogService)
+	accessLogHandler := sysapi.NewAccessLogHandler(accessLogService, accessLogRetentionService, accessLogChainService, dataScopeService)
+	loginLogHandler := sysapi.NewLoginLogHandler(loginLogService, dataScopeService)
+	auditLogHandler := sysapi.NewAuditLogHandler(auditLogService)
+	roleGrantHandler := sysapi.NewRoleGrantHandler(roleGrantService, dataScopeService, sessionService)
+	roleConstraintHandler := sysapi.NewRoleConstraintHandler(roleConstraintService)
+	passwordResetHandler := api.NewPasswordResetHandler(passwordResetService, loginLogService, cfg.PasswordReset.MaxPending)
+	healthHandler := api.NewHealthHandler(db, rdb, cfg.Upload.AvatarPath)
+	permissionHandler := api.NewPermissionHandler(routePermissions, sessionService, roleService, roleGrantService, dataScopeService)
+
+	// 健康检查探针，不需要认证
+	r.GET("/healthz", healthHandler.Healthz)
+	r.GET("/readyz", healthHandler.Readyz)
 
 	// API路由组
-	v1 := r.Group("/api/v1")
+	v1 := r.Group(apiPrefix)
 	{
 		// 认证路由（不需要JWT验证）
 		auth := v1.Group("/auth")
 		{
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/login/2fa", authHandler.LoginTwoFactor)
+			auth.POST("/login/change-password", authHandler.ChangeExpiredPassword)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/forgot-password", passwordResetHandler.ForgotPassword)
+			auth.POST("/reset-password", passwordResetHandler.ResetPassword)
 			auth.POST("/logout", authHandler.Logout)
 		}
 
-		// 需要认证的路由（使用 Redis 白名单认证）
+		// 需要认证的路由（使用 Redis 白名单认证），并按 routePermissions 统一校验权限
 		authorized := v1.Group("/")
-		authorized.Use(middleware.AuthWhitelistMiddleware(rdb))
+		authorized.Use(middleware.AuthWhitelistMiddleware(sessionService), middleware.PermissionMiddleware(routePermissions))
 		{
 			// 用户管理
 			users := authorized.Group("/users")
 			{
 				users.POST("", userHandler.CreateUser)
-				// 权限控制示范
-				users.GET("", middleware.AuthMiddleware(rdb, []string{"user:list"}), userHandler.ListUsers)
+				users.GET("", userHandler.ListUsers)
 				users.GET("/:id", userHandler.GetUser)
 				users.PUT("/:id", userHandler.UpdateUser)
 				users.DELETE("/:id", userHandler.DeleteUser)
 				users.DELETE("/batch", userHandler.BatchDeleteUsers)
 				users.POST("/:id/roles", userHandler.AssignRoles)
+				users.POST("/:id/reset-password", userHandler.ResetPassword)
+				users.POST("/:id/unlock", userHandler.UnlockUser)
+				users.GET("/:id/sessions", userHandler.ListSessions)
+				users.POST("/:id/force-logout", userHandler.ForceLogout)
+				users.GET("/:id/role-grants", roleGrantHandler.ListUserGrants)
+				users.POST("/:id/role-grants", roleGrantHandler.GrantRole)
 			}
 
+			// 即将到期的临时角色授权
+			authorized.GET("/role-grants/expiring", roleGrantHandler.ListExpiring)
+
 			// 组织管理
 			organizations := authorized.Group("/organizations")
 			{
@@ -92,6 +166,18 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, rdb *redis.Client) *gin.Engine
 				roles.DELETE("/:id", roleHandler.DeleteRole)
 				roles.POST("/:id/menus", roleHandler.AssignMenus)
 				roles.POST("/:id/users", roleHandler.AssignUsers)
+				roles.GET("/:id/permissions", roleHandler.GetEffectivePermissions)
+			}
+
+			// 职责分离约束
+			roleConstraints := authorized.Group("/role-constraints")
+			{
+				roleConstraints.POST("", roleConstraintHandler.CreateConstraint)
+				roleConstraints.GET("", roleConstraintHandler.ListConstraints)
+				roleConstraints.GET("/violations", roleConstraintHandler.ListViolations)
+				roleConstraints.GET("/:id", roleConstraintHandler.GetConstraint)
+				roleConstraints.PUT("/:id", roleConstraintHandler.UpdateConstraint)
+				roleConstraints.DELETE("/:id", roleConstraintHandler.DeleteConstraint)
 			}
 
 			// 菜单管理
@@ -105,6 +191,11 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, rdb *redis.Client) *gin.Engine
 				menus.DELETE("/:id", menuHandler.DeleteMenu)
 			}
 
+			// 权限码列表，供菜单/按钮绑定权限标识
+			authorized.GET("/permissions", permissionHandler.List)
+			// 排查某用户对权限码/路由的判定过程
+			authorized.GET("/permissions/explain", permissionHandler.Explain)
+
 			// 字典管理
 			dicts := authorized.Group("/dicts")
 			{
@@ -134,19 +225,68 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, rdb *redis.Client) *gin.Engine
 			profile := authorized.Group("/profile")
 			{
 				profile.GET("", profileHandler.GetProfile)
+				profile.GET("/menus", authHandler.Menus)
 				profile.PUT("", profileHandler.UpdateProfile)
 				profile.POST("/change-password", profileHandler.ChangePassword)
 				profile.POST("/upload-avatar", profileHandler.UploadAvatar)
+
+				// 两步验证
+				profile.GET("/2fa", profileHandler.GetTwoFactorStatus)
+				profile.POST("/2fa/setup", profileHandler.SetupTwoFactor)
+				profile.POST("/2fa/confirm", profileHandler.ConfirmTwoFactor)
+				profile.POST("/2fa/disable", profileHandler.DisableTwoFactor)
+				profile.POST("/2fa/recovery-codes", profileHandler.RegenerateRecoveryCodes)
+
+				// 登录会话
+				profile.GET("/sessions", profileHandler.ListSessions)
+				profile.DELETE("/sessions", profileHandler.RevokeOtherSessions)
+				profile.DELETE("/sessions/:session_id", profileHandler.RevokeSession)
+				profile.GET("/logins", profileHandler.RecentLogins)
 			}
 
 			// 访问日志
 			logs := authorized.Group("/logs")
 			{
 				logs.GET("", accessLogHandler.List)
-				logs.DELETE("/batch", middleware.AuthMiddleware(rdb, []string{"log:delete"}), accessLogHandler.BatchDelete)
+				logs.GET("/export", accessLogHandler.Export)
+				logs.GET("/stats", accessLogHandler.Stats)
+				logs.GET("/queue-stats", accessLogHandler.QueueStats)
+				logs.GET("/chain/verify", accessLogHandler.VerifyChain)
+				logs.GET("/retention", accessLogHandler.Retention)
+				logs.POST("/purge", accessLogHandler.Purge)
+				logs.DELETE("/batch", accessLogHandler.BatchDelete)
 			}
+
+			// 登录历史与安全告警
+			authorized.GET("/login-logs", loginLogHandler.List)
+			authorized.GET("/security-alerts", loginLogHandler.ListAlerts)
+			authorized.POST("/security-alerts/:id/ack", loginLogHandler.AcknowledgeAlert)
+
+			// 数据变更审计日志
+			authorized.GET("/audit-logs", auditLogHandler.List)
 		}
 	}
 
-	return r
+	// Prometheus 指标，不在 API 前缀下，按 IP 白名单或令牌限制访问
+	if cfg.Metrics.Enabled {
+		reg, err := metrics.NewRegistry(db, rdb, sessionService, accessLogWriter)
+		if err != nil {
+			return nil, fmt.Errorf("指标注册失败: %w", err)
+		}
+		metricsAccess, err := middleware.MetricsAccessMiddleware(cfg.Metrics)
+		if err != nil {
+			return nil, err
+		}
+		r.GET(cfg.Metrics.Path, metricsAccess, gin.WrapH(promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+			ErrorLog:      slog.NewLogLogger(slog.Default().Handler(), slog.LevelError),
+			ErrorHandling: promhttp.ContinueOnError,
+		})))
+	}
+
+	// 启动校验：每个 API 路由都必须声明权限
+	if err := routePermissions.Verify(r.Routes(), apiPrefix); err != nil {
+		return nil, fmt.Errorf("路由权限校验失败: %w", err)
+	}
+
+	return r, nil
 }
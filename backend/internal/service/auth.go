@@ -1,13 +1,24 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"siqian-admin/internal/sys/model"
+	sysservice "siqian-admin/internal/sys/service"
 	"siqian-admin/internal/utils"
+	"sync"
 
 	"gorm.io/gorm"
 )
 
+// ErrInvalidCredentials 用户不存在、已禁用或密码错误统一返回该错误，避免枚举用户名
+var ErrInvalidCredentials = errors.New("用户名或密码错误")
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
 type AuthService struct {
 	db *gorm.DB
 }
@@ -16,27 +27,41 @@ func NewAuthService(db *gorm.DB) *AuthService {
 	return &AuthService{db: db}
 }
 
+// WithContext 绑定请求 context，SQL 日志据此带上请求 ID
+func (s *AuthService) WithContext(ctx context.Context) *AuthService {
+	return &AuthService{db: s.db.WithContext(ctx)}
+}
+
 func (s *AuthService) Login(username, password string) (*model.User, error) {
 	// 查找用户
 	var user model.User
 	if err := s.db.Where("username = ? AND status = '1'", username).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("用户不存在或已被禁用")
+			// 用户不存在时同样执行一次哈希比对，使响应耗时与密码错误一致
+			utils.CheckPasswordHash(password, getDummyHash())
+			return nil, ErrInvalidCredentials
 		}
 		return nil, err
 	}
 
 	// 验证密码
 	if !utils.CheckPasswordHash(password, user.Password) {
-		return nil, errors.New("密码错误")
+		return nil, ErrInvalidCredentials
 	}
 
 	// 预加载关联数据
-	s.db.Preload("Roles").Preload("Organizations").First(&user, user.ID)
+	s.db.Preload("Roles", sysservice.ActiveRoles(user.ID)).Preload("Organizations").First(&user, user.ID)
 
 	return &user, nil
 }
 
+func getDummyHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = utils.HashPassword("siqian-admin-dummy-password")
+	})
+	return dummyHash
+}
+
 func CheckUserPermission(userID int64, path, method string) (bool, error) {
 	// 这里实现权限检查逻辑
 	// 可以根据用户的角色和菜单权限来判断
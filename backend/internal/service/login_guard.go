@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"siqian-admin/internal/config"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	loginFailUserPrefix = "login:fail:user:"
+	loginFailIPPrefix   = "login:fail:ip:"
+	loginLockUserPrefix = "login:lock:user:"
+	loginLockIPPrefix   = "login:lock:ip:"
+)
+
+// LoginLockedError 用户名或 IP 处于临时锁定期
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return "登录失败次数过多，请稍后再试"
+}
+
+// RetryAfterSeconds 转换为 Retry-After 响应头的秒数（向上取整）
+func (e *LoginLockedError) RetryAfterSeconds() string {
+	return fmt.Sprint(int64((e.RetryAfter + time.Second - 1) / time.Second))
+}
+
+// LoginGuardService 基于 Redis 的登录失败计数与临时锁定
+type LoginGuardService struct {
+	rdb *redis.Client
+}
+
+func NewLoginGuardService(rdb *redis.Client) *LoginGuardService {
+	return &LoginGuardService{rdb: rdb}
+}
+
+// Check 登录前检查用户名与 IP 是否被锁定
+func (s *LoginGuardService) Check(ctx context.Context, username, ip string) error {
+	pipe := s.rdb.Pipeline()
+	userTTL := pipe.PTTL(ctx, loginLockUserPrefix+normalizeUsername(username))
+	ipTTL := pipe.PTTL(ctx, loginLockIPPrefix+ip)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	retryAfter := userTTL.Val()
+	if ipTTL.Val() > retryAfter {
+		retryAfter = ipTTL.Val()
+	}
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// CheckIP 只检查 IP 是否被锁定，用于尚不知道用户名的两步验证请求
+func (s *LoginGuardService) CheckIP(ctx context.Context, ip string) error {
+	ttl, err := s.rdb.PTTL(ctx, loginLockIPPrefix+ip).Result()
+	if err != nil {
+		return err
+	}
+	if ttl > 0 {
+		return &LoginLockedError{RetryAfter: ttl}
+	}
+	return nil
+}
+
+// RecordFailure 记录一次失败，达到阈值时锁定，返回本次应施加的渐进延迟
+func (s *LoginGuardService) RecordFailure(ctx context.Context, username, ip string) (time.Duration, error) {
+	cfg := config.GetConfig().LoginSecurity
+	window := time.Duration(cfg.FailureWindowMinutes) * time.Minute
+	lockout := time.Duration(cfg.LockoutMinutes) * time.Minute
+	username = normalizeUsername(username)
+
+	userCount, err := s.incr(ctx, loginFailUserPrefix+username, window)
+	if err != nil {
+		return 0, err
+	}
+	ipCount, err := s.incr(ctx, loginFailIPPrefix+ip, window)
+	if err != nil {
+		return 0, err
+	}
+
+	if cfg.MaxFailures > 0 && userCount >= int64(cfg.MaxFailures) {
+		if err := s.rdb.Set(ctx, loginLockUserPrefix+username, userCount, lockout).Err(); err != nil {
+			return 0, err
+		}
+	}
+	if cfg.IPMaxFailures > 0 && ipCount >= int64(cfg.IPMaxFailures) {
+		if err := s.rdb.Set(ctx, loginLockIPPrefix+ip, ipCount, lockout).Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	return progressiveDelay(userCount, cfg), nil
+}
+
+// RecordSuccess 登录成功后清空该用户名的失败计数（IP 计数保留至窗口结束）
+func (s *LoginGuardService) RecordSuccess(ctx context.Context, username string) error {
+	return s.rdb.Del(ctx, loginFailUserPrefix+normalizeUsername(username)).Err()
+}
+
+// Unlock 管理员解除用户名锁定并清空失败计数
+func (s *LoginGuardService) Unlock(ctx context.Context, username string) error {
+	username = normalizeUsername(username)
+	return s.rdb.Del(ctx, loginFailUserPrefix+username, loginLockUserPrefix+username).Err()
+}
+
+func (s *LoginGuardService) incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	n, err := s.rdb.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// 首次失败时开启统计窗口
+	if n == 1 {
+		if err := s.rdb.Expire(ctx, key, window).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// progressiveDelay 第 n 次失败延迟 base*2^(n-1)，不超过上限
+func progressiveDelay(failures int64, cfg config.LoginSecurityConfig) time.Duration {
+	if cfg.DelayBaseMs <= 0 || failures <= 0 {
+		return 0
+	}
+	maxDelay := time.Duration(cfg.MaxDelayMs) * time.Millisecond
+	delay := time.Duration(cfg.DelayBaseMs) * time.Millisecond
+	for i := int64(1); i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
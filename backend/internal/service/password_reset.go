@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/mail"
+	"siqian-admin/internal/sys/model"
+	sysservice "siqian-admin/internal/sys/service"
+	"siqian-admin/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	pwdResetTokenPrefix    = "pwd:reset:"          // 重置令牌摘要 -> 用户ID
+	pwdResetThrottlePrefix = "pwd:reset_throttle:" // 同一用户发送间隔限制
+	pwdResetThrottleTTL    = time.Minute
+	pwdResetIPPrefix       = "pwd:reset_ip:" // 同一 IP 在统计窗口内的请求次数
+)
+
+var ErrResetTokenInvalid = errors.New("重置链接无效或已过期")
+
+// ResetRateLimitedError 同一 IP 请求重置邮件过于频繁
+type ResetRateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ResetRateLimitedError) Error() string {
+	return "请求过于频繁，请稍后再试"
+}
+
+// RetryAfterSeconds 转换为 Retry-After 响应头的秒数（向上取整）
+func (e *ResetRateLimitedError) RetryAfterSeconds() string {
+	return fmt.Sprint(int64((e.RetryAfter + time.Second - 1) / time.Second))
+}
+
+type PasswordResetService struct {
+	db             *gorm.DB
+	rdb            *redis.Client
+	mailer         mail.Mailer
+	userService    *sysservice.UserService
+	sessionService *SessionService
+}
+
+func NewPasswordResetService(db *gorm.DB, rdb *redis.Client, mailer mail.Mailer, userService *sysservice.UserService, sessionService *SessionService) *PasswordResetService {
+	return &PasswordResetService{db: db, rdb: rdb, mailer: mailer, userService: userService, sessionService: sessionService}
+}
+
+// CheckIP 按 IP 限制请求次数，在查询账户之前调用；超出时返回 *ResetRateLimitedError
+func (s *PasswordResetService) CheckIP(ctx context.Context, ip string) error {
+	cfg := config.GetConfig().PasswordReset
+	if cfg.IPLimit <= 0 {
+		return nil
+	}
+	key := pwdResetIPPrefix + ip
+	n, err := s.rdb.Incr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	// 首次请求时开启统计窗口
+	if n == 1 {
+		if err := s.rdb.Expire(ctx, key, time.Duration(cfg.IPWindowMinutes)*time.Minute).Err(); err != nil {
+			return err
+		}
+	}
+	if n <= int64(cfg.IPLimit) {
+		return nil
+	}
+	ttl, err := s.rdb.PTTL(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	return &ResetRateLimitedError{RetryAfter: ttl}
+}
+
+// RequestReset 按用户名或邮箱发送重置邮件。
+// 账户不存在、已禁用或未绑定邮箱时静默返回，调用方始终给出相同提示，避免枚举账户
+func (s *PasswordResetService) RequestReset(ctx context.Context, account string) error {
+	account = strings.TrimSpace(account)
+	var user model.User
+	err := s.db.Where("(username = ? OR email = ?) AND status = '1'", account, account).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Email == nil || *user.Email == "" {
+		return nil
+	}
+
+	// 限制发送频率，防止被用来轰炸邮箱
+	allowed, err := s.rdb.SetNX(ctx, fmt.Sprintf("%s%d", pwdResetThrottlePrefix, user.ID), 1, pwdResetThrottleTTL).Result()
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return nil
+	}
+
+	cfg := config.GetConfig()
+	ttl := time.Duration(cfg.PasswordReset.TokenTTLMinutes) * time.Minute
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	// Redis 中只保存令牌摘要
+	if err := s.rdb.Set(ctx, pwdResetTokenPrefix+utils.HashToken(token), user.ID, ttl).Err(); err != nil {
+		return err
+	}
+
+	link := cfg.PasswordReset.ResetURL
+	if strings.Contains(link, "?") {
+		link += "&token=" + url.QueryEscape(token)
+	} else {
+		link += "?token=" + url.QueryEscape(token)
+	}
+	body := fmt.Sprintf("%s，您好：\n\n我们收到了重置您账户密码的请求。请在 %d 分钟内打开以下链接设置新密码：\n\n%s\n\n该链接仅可使用一次。如果这不是您本人的操作，请忽略本邮件，您的密码不会被修改。\n",
+		displayName(&user), cfg.PasswordReset.TokenTTLMinutes, link)
+	return s.mailer.Send(ctx, mail.Message{
+		To:      []string{*user.Email},
+		Subject: "重置您的密码",
+		Body:    body,
+	})
+}
+
+// ResetPassword 校验一次性令牌并设置新密码，成功后注销该用户的全部会话；
+// 返回令牌所属用户 ID（令牌无效时为 0），用于记录安全事件
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) (int64, error) {
+	key := pwdResetTokenPrefix + utils.HashToken(token)
+	userID, err := s.rdb.Get(ctx, key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// 密码不符合策略时保留令牌，允许用户重新输入
+	if err := s.userService.ValidateNewPassword(userID, newPassword); err != nil {
+		return userID, err
+	}
+
+	// 原子地消费令牌，保证只能使用一次
+	if err := s.rdb.GetDel(ctx, key).Err(); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return userID, ErrResetTokenInvalid
+		}
+		return userID, err
+	}
+	if err := s.userService.ChangePassword(userID, newPassword); err != nil {
+		return userID, err
+	}
+
+	return userID, s.sessionService.RevokeUserSessions(ctx, userID)
+}
+
+func displayName(user *model.User) string {
+	if user.RealName != "" {
+		return user.RealName
+	}
+	return user.Username
+}
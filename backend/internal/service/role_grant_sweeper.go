@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"siqian-admin/internal/config"
+	sysservice "siqian-admin/internal/sys/service"
+	"time"
+)
+
+// RoleGrantSweeper 定期删除已过期的角色授权，并刷新授权到期或开始生效的用户会话
+type RoleGrantSweeper struct {
+	grants   *sysservice.RoleGrantService
+	sessions *SessionService
+}
+
+func NewRoleGrantSweeper(grants *sysservice.RoleGrantService, sessions *SessionService) *RoleGrantSweeper {
+	return &RoleGrantSweeper{grants: grants, sessions: sessions}
+}
+
+// Run 阻塞运行直到 ctx 取消
+func (s *RoleGrantSweeper) Run(ctx context.Context) {
+	interval := time.Duration(config.GetConfig().RoleGrant.SweepIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			if err := s.sweep(ctx, last, now); err != nil {
+				slog.Error("清理过期角色授权失败", "err", err)
+				continue
+			}
+			last = now
+		}
+	}
+}
+
+// sweep 先刷新受影响用户的会话再删除过期授权：会话只按有效期内的授权加载权限，
+// 刷新失败时过期授权仍保留，下一轮会再次找到这些用户重试，不会因授权已删除而漏刷
+func (s *RoleGrantSweeper) sweep(ctx context.Context, since, now time.Time) error {
+	grants := s.grants.WithContext(ctx)
+	expired, err := grants.ExpiredUsers(now)
+	if err != nil {
+		return err
+	}
+	activated, err := grants.ActivatedBetween(since, now)
+	if err != nil {
+		return err
+	}
+	if err := s.sessions.RefreshPermissions(ctx, append(expired, activated...)); err != nil {
+		return err
+	}
+
+	revoked, err := grants.RevokeExpired(now)
+	if err != nil {
+		return err
+	}
+	if len(revoked) > 0 {
+		slog.InfoContext(ctx, "已清理过期角色授权", "count", len(revoked))
+	}
+	return nil
+}
@@ -0,0 +1,574 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/sys/model"
+	sysservice "siqian-admin/internal/sys/service"
+	"siqian-admin/internal/utils"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Redis 键前缀
+const (
+	WhitelistKeyPrefix    = "jwt:whitelist:"      // 访问令牌白名单，值为会话快照
+	refreshKeyPrefix      = "jwt:refresh:"        // 刷新令牌 -> 所属令牌族
+	refreshUsedKeyPrefix  = "jwt:refresh_used:"   // 已轮换的刷新令牌，用于检测重放
+	familyKeyPrefix       = "jwt:family:"         // 令牌族（一次登录）当前状态
+	familyAccessPrefix    = "jwt:family_access:"  // 令牌族签发过的访问令牌集合
+	userSessionsPrefix    = "jwt:user_sessions:"  // 用户 -> 会话ID（令牌族ID）索引
+	sessionActivePrefix   = "jwt:session_active:" // 会话最近活跃时间（Unix 毫秒）
+	menusVersionPrefix    = "jwt:menus_version:"  // 用户菜单权限版本号，绑定变化时递增
+	pwdChangeTicketPrefix = "login:pwd_change:"   // 密码过期时的改密票据
+	activeTokensKey       = "jwt:active_tokens"   // 有效访问令牌，分值为过期时间（Unix 毫秒），供指标统计
+	pwdChangeTicketTTL    = 10 * time.Minute
+)
+
+var (
+	ErrRefreshTokenInvalid   = errors.New("刷新令牌无效或已过期")
+	ErrRefreshTokenReused    = errors.New("刷新令牌已被使用，会话已注销")
+	ErrPasswordTicketInvalid = errors.New("改密票据无效或已过期，请重新登录")
+	ErrSessionNotFound       = errors.New("会话不存在或已失效")
+	ErrPasswordExpired       = errors.New("密码已过期，请修改密码后继续")
+)
+
+// ClientMeta 登录时记录的客户端信息
+type ClientMeta struct {
+	IP        string
+	UserAgent string
+}
+
+// SessionInfo 会话列表展示信息
+type SessionInfo struct {
+	SessionID    string    `json:"session_id"`
+	IP           string    `json:"ip"`
+	UserAgent    string    `json:"user_agent"`
+	LoginAt      time.Time `json:"login_at"`
+	LastActiveAt time.Time `json:"last_active_at"`
+	Current      bool      `json:"current"`
+}
+
+// TokenPair 登录/刷新返回的令牌对
+type TokenPair struct {
+	AccessToken      string `json:"token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+	MenusVersion     int64  `json:"menus_version"`
+	SessionID        string `json:"session_id"`
+
+	UserID   int64  `json:"-"`
+	Username string `json:"-"`
+}
+
+// RefreshReusedError 已轮换的刷新令牌再次出现，携带被注销的会话以便记录安全事件
+type RefreshReusedError struct {
+	UserID    int64
+	SessionID string
+}
+
+func (e *RefreshReusedError) Error() string {
+	return ErrRefreshTokenReused.Error()
+}
+
+func (e *RefreshReusedError) Is(target error) bool {
+	return target == ErrRefreshTokenReused
+}
+
+// PasswordExpiredError 刷新时发现密码已过期，会话已注销，携带用户以便签发改密票据
+type PasswordExpiredError struct {
+	UserID   int64
+	Username string
+}
+
+func (e *PasswordExpiredError) Error() string {
+	return ErrPasswordExpired.Error()
+}
+
+func (e *PasswordExpiredError) Is(target error) bool {
+	return target == ErrPasswordExpired
+}
+
+// SessionSnapshot 写入白名单的会话快照，权限校验从此读取菜单
+type SessionSnapshot struct {
+	SessionID    string       `json:"session_id"`
+	Menus        []model.Menu `json:"menus"`
+	MenusVersion int64        `json:"menus_version"`
+	User         *model.User  `json:"user"`
+}
+
+type refreshRecord struct {
+	UserID   int64  `json:"user_id"`
+	FamilyID string `json:"family_id"`
+}
+
+type tokenFamily struct {
+	UserID       int64     `json:"user_id"`
+	Username     string    `json:"username"`
+	RefreshToken string    `json:"refresh_token"`
+	IP           string    `json:"ip"`
+	UserAgent    string    `json:"user_agent"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type SessionService struct {
+	db          *gorm.DB
+	rdb         *redis.Client
+	menuService *sysservice.MenuService
+}
+
+func NewSessionService(db *gorm.DB, rdb *redis.Client, menuService *sysservice.MenuService) *SessionService {
+	return &SessionService{db: db, rdb: rdb, menuService: menuService}
+}
+
+// CreateSession 登录成功后开启新的令牌族并签发第一对令牌
+func (s *SessionService) CreateSession(ctx context.Context, user *model.User, menus []model.Menu, meta ClientMeta) (*TokenPair, error) {
+	familyID, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	family := tokenFamily{
+		UserID:    user.ID,
+		Username:  user.Username,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+		CreatedAt: time.Now(),
+	}
+	return s.issue(ctx, familyID, &family, user, menus)
+}
+
+// Refresh 使用刷新令牌换取新的令牌对，旧刷新令牌随即作废；
+// 已作废的刷新令牌再次出现时视为泄露，整个令牌族被注销
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	raw, err := s.rdb.Get(ctx, refreshKeyPrefix+refreshToken).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec refreshRecord
+	if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	// 原子地标记为已使用，标记失败说明该令牌此前已被轮换过
+	cfg := config.GetConfig()
+	fresh, err := s.rdb.SetNX(ctx, refreshUsedKeyPrefix+refreshToken, rec.FamilyID, utils.RefreshTokenTTL(cfg)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		if err := s.RevokeFamily(ctx, rec.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, &RefreshReusedError{UserID: rec.UserID, SessionID: rec.FamilyID}
+	}
+
+	family, err := s.getFamily(ctx, rec.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if family == nil || family.RefreshToken != refreshToken {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	// 重新加载用户与菜单，禁用用户不再续期
+	user, menus, err := s.LoadPermissionState(rec.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			_ = s.RevokeFamily(ctx, rec.FamilyID)
+			return nil, ErrRefreshTokenInvalid
+		}
+		return nil, err
+	}
+	// 密码过期后不再续期，须与登录一样先修改密码
+	if sysservice.PasswordExpired(user) {
+		if err := s.RevokeFamily(ctx, rec.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, &PasswordExpiredError{UserID: user.ID, Username: user.Username}
+	}
+
+	return s.issue(ctx, rec.FamilyID, family, user, menus)
+}
+
+// RevokeFamily 注销整个令牌族：当前刷新令牌以及族内所有访问令牌
+func (s *SessionService) RevokeFamily(ctx context.Context, familyID string) error {
+	if familyID == "" {
+		return nil
+	}
+	family, err := s.getFamily(ctx, familyID)
+	if err != nil {
+		return err
+	}
+	accessTokens, err := s.rdb.SMembers(ctx, familyAccessPrefix+familyID).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	keys := []string{familyKeyPrefix + familyID, familyAccessPrefix + familyID, sessionActivePrefix + familyID}
+	if family != nil && family.RefreshToken != "" {
+		keys = append(keys, refreshKeyPrefix+family.RefreshToken)
+	}
+	members := make([]interface{}, 0, len(accessTokens))
+	for _, t := range accessTokens {
+		keys = append(keys, WhitelistKeyPrefix+t)
+		members = append(members, t)
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, keys...)
+	if len(members) > 0 {
+		pipe.ZRem(ctx, activeTokensKey, members...)
+	}
+	if family != nil {
+		pipe.SRem(ctx, userSessionsKey(family.UserID), familyID)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RevokeUserSessions 注销用户的全部会话（强制下线）
+func (s *SessionService) RevokeUserSessions(ctx context.Context, userID int64) error {
+	sessionIDs, err := s.rdb.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, sid := range sessionIDs {
+		if err := s.RevokeFamily(ctx, sid); err != nil {
+			return err
+		}
+	}
+	return s.rdb.Del(ctx, userSessionsKey(userID)).Err()
+}
+
+// RevokeUserSession 注销用户自己的某个会话，不属于该用户时返回 ErrSessionNotFound
+func (s *SessionService) RevokeUserSession(ctx context.Context, userID int64, sessionID string) error {
+	family, err := s.getFamily(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if family == nil || family.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return s.RevokeFamily(ctx, sessionID)
+}
+
+// RevokeOtherSessions 注销除当前会话以外的全部会话
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, userID int64, currentSessionID string) error {
+	sessionIDs, err := s.rdb.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, sid := range sessionIDs {
+		if sid == currentSessionID {
+			continue
+		}
+		if err := s.RevokeFamily(ctx, sid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListUserSessions 列出用户的有效会话，顺带清理索引中已过期的会话
+func (s *SessionService) ListUserSessions(ctx context.Context, userID int64, currentSessionID string) ([]SessionInfo, error) {
+	sessionIDs, err := s.rdb.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]SessionInfo, 0, len(sessionIDs))
+	for _, sid := range sessionIDs {
+		family, err := s.getFamily(ctx, sid)
+		if err != nil {
+			return nil, err
+		}
+		if family == nil {
+			_ = s.rdb.SRem(ctx, userSessionsKey(userID), sid).Err()
+			continue
+		}
+		info := SessionInfo{
+			SessionID:    sid,
+			IP:           family.IP,
+			UserAgent:    family.UserAgent,
+			LoginAt:      family.CreatedAt,
+			LastActiveAt: family.CreatedAt,
+			Current:      sid == currentSessionID,
+		}
+		if ms, err := s.rdb.Get(ctx, sessionActivePrefix+sid).Int64(); err == nil {
+			info.LastActiveAt = time.UnixMilli(ms)
+		}
+		sessions = append(sessions, info)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastActiveAt.After(sessions[j].LastActiveAt)
+	})
+	return sessions, nil
+}
+
+// Touch 记录会话最近活跃时间
+func (s *SessionService) Touch(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	cfg := config.GetConfig()
+	return s.rdb.Set(ctx, sessionActivePrefix+sessionID, time.Now().UnixMilli(), utils.RefreshTokenTTL(cfg)).Err()
+}
+
+// RefreshPermissions 角色、菜单绑定变化后重新计算用户菜单，
+// 原地更新其所有有效访问令牌的快照并递增菜单版本号；已禁用或删除的用户直接注销全部会话
+func (s *SessionService) RefreshPermissions(ctx context.Context, userIDs []int64) error {
+	seen := make(map[int64]struct{}, len(userIDs))
+	for _, userID := range userIDs {
+		if _, ok := seen[userID]; ok {
+			continue
+		}
+		seen[userID] = struct{}{}
+		if err := s.refreshUserPermissions(ctx, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionService) refreshUserPermissions(ctx context.Context, userID int64) error {
+	user, menus, err := s.LoadPermissionState(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.RevokeUserSessions(ctx, userID)
+		}
+		return err
+	}
+
+	version, err := s.rdb.Incr(ctx, menusVersionPrefix+strconv.FormatInt(userID, 10)).Result()
+	if err != nil {
+		return err
+	}
+	sessionIDs, err := s.rdb.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, sid := range sessionIDs {
+		accessTokens, err := s.rdb.SMembers(ctx, familyAccessPrefix+sid).Result()
+		if err != nil {
+			return err
+		}
+		snapshot, err := json.Marshal(SessionSnapshot{SessionID: sid, Menus: menus, MenusVersion: version, User: user})
+		if err != nil {
+			return err
+		}
+		// 仅覆盖仍存在的快照并保留剩余有效期，已过期的令牌不会被复活
+		pipe := s.rdb.Pipeline()
+		for _, t := range accessTokens {
+			pipe.SetArgs(ctx, WhitelistKeyPrefix+t, snapshot, redis.SetArgs{Mode: "XX", KeepTTL: true})
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadPermissionState 从数据库加载会话快照所需的用户（当前有效角色）与菜单；
+// 用户已禁用或删除时返回 gorm.ErrRecordNotFound
+func (s *SessionService) LoadPermissionState(userID int64) (*model.User, []model.Menu, error) {
+	var user model.User
+	if err := s.db.Where("id = ? AND status = '1'", userID).Preload("Roles", sysservice.ActiveRoles(userID)).Preload("Organizations").First(&user).Error; err != nil {
+		return nil, nil, err
+	}
+	menus, err := s.menuService.GetUserMenus(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &user, menus, nil
+}
+
+// UserSnapshots 读取用户全部仍有效的访问令牌快照，同一会话可能有多个未过期的访问令牌
+func (s *SessionService) UserSnapshots(ctx context.Context, userID int64) ([]SessionSnapshot, error) {
+	sessionIDs, err := s.rdb.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(sessionIDs)
+	var snapshots []SessionSnapshot
+	for _, sid := range sessionIDs {
+		accessTokens, err := s.rdb.SMembers(ctx, familyAccessPrefix+sid).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range accessTokens {
+			snapshot, err := s.GetSnapshot(ctx, t)
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			snapshots = append(snapshots, *snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// RevokeByAccessToken 退出登录：移除访问令牌并注销其所属令牌族
+func (s *SessionService) RevokeByAccessToken(ctx context.Context, accessToken string) error {
+	snapshot, err := s.GetSnapshot(ctx, accessToken)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	if snapshot != nil {
+		if err := s.RevokeFamily(ctx, snapshot.SessionID); err != nil {
+			return err
+		}
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, WhitelistKeyPrefix+accessToken)
+	pipe.ZRem(ctx, activeTokensKey, accessToken)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetSnapshot 读取访问令牌对应的会话快照
+func (s *SessionService) GetSnapshot(ctx context.Context, accessToken string) (*SessionSnapshot, error) {
+	raw, err := s.rdb.Get(ctx, WhitelistKeyPrefix+accessToken).Result()
+	if err != nil {
+		return nil, err
+	}
+	var snapshot SessionSnapshot
+	if err := json.Unmarshal([]byte(raw), &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// CreatePasswordChangeTicket 密码已过期：签发仅可用于修改密码的一次性票据，而非完整会话
+func (s *SessionService) CreatePasswordChangeTicket(ctx context.Context, userID int64) (string, error) {
+	ticket, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.rdb.Set(ctx, pwdChangeTicketPrefix+ticket, userID, pwdChangeTicketTTL).Err(); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// PasswordChangeTicketUser 读取改密票据对应的用户
+func (s *SessionService) PasswordChangeTicketUser(ctx context.Context, ticket string) (int64, error) {
+	userID, err := s.rdb.Get(ctx, pwdChangeTicketPrefix+ticket).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrPasswordTicketInvalid
+	}
+	return userID, err
+}
+
+// DeletePasswordChangeTicket 改密成功后作废票据
+func (s *SessionService) DeletePasswordChangeTicket(ctx context.Context, ticket string) error {
+	return s.rdb.Del(ctx, pwdChangeTicketPrefix+ticket).Err()
+}
+
+// issue 在令牌族内签发新的访问令牌与刷新令牌，并写入 Redis
+func (s *SessionService) issue(ctx context.Context, familyID string, family *tokenFamily, user *model.User, menus []model.Menu) (*TokenPair, error) {
+	cfg := config.GetConfig()
+	accessTTL := utils.AccessTokenTTL(cfg)
+	refreshTTL := utils.RefreshTokenTTL(cfg)
+
+	accessToken, err := utils.GenerateJWT(user.ID, user.Username, familyID, cfg)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	menusVersion, err := s.MenusVersion(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := json.Marshal(SessionSnapshot{SessionID: familyID, Menus: menus, MenusVersion: menusVersion, User: user})
+	if err != nil {
+		return nil, err
+	}
+	rec, err := json.Marshal(refreshRecord{UserID: user.ID, FamilyID: familyID})
+	if err != nil {
+		return nil, err
+	}
+	family.RefreshToken = refreshToken
+	familyJSON, err := json.Marshal(family)
+	if err != nil {
+		return nil, err
+	}
+
+	// 旧的访问令牌不主动删除，让其自然过期，避免并发中的请求被中断
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, WhitelistKeyPrefix+accessToken, snapshot, accessTTL)
+	pipe.ZAdd(ctx, activeTokensKey, redis.Z{Score: float64(time.Now().Add(accessTTL).UnixMilli()), Member: accessToken})
+	pipe.Set(ctx, refreshKeyPrefix+refreshToken, rec, refreshTTL)
+	pipe.Set(ctx, familyKeyPrefix+familyID, familyJSON, refreshTTL)
+	pipe.SAdd(ctx, familyAccessPrefix+familyID, accessToken)
+	pipe.Expire(ctx, familyAccessPrefix+familyID, refreshTTL)
+	pipe.SAdd(ctx, userSessionsKey(user.ID), familyID)
+	pipe.Expire(ctx, userSessionsKey(user.ID), refreshTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int64(accessTTL.Seconds()),
+		RefreshExpiresIn: int64(refreshTTL.Seconds()),
+		MenusVersion:     menusVersion,
+		SessionID:        familyID,
+		UserID:           user.ID,
+		Username:         user.Username,
+	}, nil
+}
+
+// MenusVersion 读取用户当前菜单版本号，从未变更过时为 0
+func (s *SessionService) MenusVersion(ctx context.Context, userID int64) (int64, error) {
+	v, err := s.rdb.Get(ctx, menusVersionPrefix+strconv.FormatInt(userID, 10)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return v, err
+}
+
+// CountActiveTokens 统计未过期的访问令牌数。签发与注销时同步维护有序集合，
+// 统计时先移除已过期的成员再取基数，不必遍历白名单键
+func (s *SessionService) CountActiveTokens(ctx context.Context) (int64, error) {
+	pipe := s.rdb.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, activeTokensKey, "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	card := pipe.ZCard(ctx, activeTokensKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return card.Val(), nil
+}
+
+func userSessionsKey(userID int64) string {
+	return userSessionsPrefix + strconv.FormatInt(userID, 10)
+}
+
+func (s *SessionService) getFamily(ctx context.Context, familyID string) (*tokenFamily, error) {
+	raw, err := s.rdb.Get(ctx, familyKeyPrefix+familyID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var family tokenFamily
+	if err := json.Unmarshal([]byte(raw), &family); err != nil {
+		return nil, err
+	}
+	return &family, nil
+}
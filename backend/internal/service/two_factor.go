@@ -0,0 +1,398 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/sys/model"
+	sysservice "siqian-admin/internal/sys/service"
+	"siqian-admin/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	twoFactorTicketPrefix   = "2fa:ticket:"          // 两步登录票据
+	twoFactorAttemptsPrefix = "2fa:ticket_attempts:" // 票据已用的验证次数
+	twoFactorEnrollPrefix   = "2fa:enroll:"          // 个人中心绑定中的待确认密钥
+	twoFactorUsedStepPrefix = "2fa:used:"            // 已使用的时间步，防止验证码重放
+	twoFactorEnrollTTL      = 10 * time.Minute
+	twoFactorUsedStepTTL    = 2 * time.Minute
+	recoveryCodeCount       = 10
+	maxTicketAttempts       = 5
+)
+
+var (
+	ErrTwoFactorTicketInvalid  = errors.New("登录票据无效或已过期")
+	ErrTwoFactorCodeInvalid    = errors.New("验证码错误")
+	ErrTwoFactorNotEnabled     = errors.New("未启用两步验证")
+	ErrTwoFactorAlreadyEnabled = errors.New("已启用两步验证")
+	ErrTwoFactorEnrollExpired  = errors.New("绑定已过期，请重新获取密钥")
+	ErrTwoFactorRequiredByRole = errors.New("所属角色要求启用两步验证，无法关闭")
+)
+
+// LoginChallenge 密码校验通过后返回给客户端的两步验证挑战
+type LoginChallenge struct {
+	Ticket             string `json:"ticket"`
+	ExpiresIn          int64  `json:"expires_in"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	// 角色强制要求但尚未绑定时，随挑战下发密钥，验证通过即完成绑定
+	Secret          string `json:"secret,omitempty"`
+	ProvisioningURI string `json:"otpauth_uri,omitempty"`
+}
+
+// TwoFactorEnrollment 绑定密钥与二维码地址
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"otpauth_uri"`
+}
+
+// TwoFactorStatus 个人中心展示的两步验证状态
+type TwoFactorStatus struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+type twoFactorTicket struct {
+	UserID        int64  `json:"user_id"`
+	PendingSecret string `json:"pending_secret,omitempty"`
+}
+
+// reserveTicketAttempt 校验前先占用一次验证机会，并发的猜测同样逐个计数：
+// 票据不存在返回 -1；计数随票据一同过期；超过上限时删除票据与计数，返回值大于上限
+var reserveTicketAttempt = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+local n = redis.call('INCR', KEYS[2])
+if n == 1 then
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[2], ttl)
+	end
+end
+if n > tonumber(ARGV[1]) then
+	redis.call('DEL', KEYS[1], KEYS[2])
+end
+return n
+`)
+
+type TwoFactorService struct {
+	db  *gorm.DB
+	rdb *redis.Client
+}
+
+func NewTwoFactorService(db *gorm.DB, rdb *redis.Client) *TwoFactorService {
+	return &TwoFactorService{db: db, rdb: rdb}
+}
+
+// RequiredByRole 用户任一启用中的角色要求两步验证（需预加载 Roles）
+func (s *TwoFactorService) RequiredByRole(user *model.User) bool {
+	for _, r := range user.Roles {
+		if r.Require2FA && r.Status == "1" {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsChallenge 登录时是否需要第二步验证
+func (s *TwoFactorService) NeedsChallenge(user *model.User) bool {
+	return user.TwoFactorEnabled || s.RequiredByRole(user)
+}
+
+// CreateChallenge 为已通过密码校验的用户生成登录票据
+func (s *TwoFactorService) CreateChallenge(ctx context.Context, user *model.User) (*LoginChallenge, error) {
+	cfg := config.GetConfig()
+	ticket, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	ttl := time.Duration(cfg.TwoFactor.TicketTTLSeconds) * time.Second
+
+	state := twoFactorTicket{UserID: user.ID}
+	challenge := &LoginChallenge{Ticket: ticket, ExpiresIn: int64(ttl.Seconds())}
+	if !user.TwoFactorEnabled {
+		secret, err := utils.GenerateTOTPSecret()
+		if err != nil {
+			return nil, err
+		}
+		state.PendingSecret = secret
+		challenge.EnrollmentRequired = true
+		challenge.Secret = secret
+		challenge.ProvisioningURI = utils.TOTPProvisioningURI(cfg.TwoFactor.Issuer, user.Username, secret)
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rdb.Set(ctx, twoFactorTicketPrefix+ticket, b, ttl).Err(); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// VerifyChallenge 校验票据与验证码（或恢复码），成功后票据作废。
+// 若本次登录同时完成了强制绑定，返回新生成的恢复码
+func (s *TwoFactorService) VerifyChallenge(ctx context.Context, ticket, code, recoveryCode string) (*model.User, []string, error) {
+	key := twoFactorTicketPrefix + ticket
+	raw, err := s.rdb.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil, ErrTwoFactorTicketInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var state twoFactorTicket
+	if err := json.Unmarshal([]byte(raw), &state); err != nil {
+		return nil, nil, ErrTwoFactorTicketInvalid
+	}
+
+	attemptsKey := twoFactorAttemptsPrefix + ticket
+	attempt, err := reserveTicketAttempt.Run(ctx, s.rdb, []string{key, attemptsKey}, maxTicketAttempts).Int()
+	if err != nil {
+		return nil, nil, err
+	}
+	if attempt < 0 || attempt > maxTicketAttempts {
+		return nil, nil, ErrTwoFactorTicketInvalid
+	}
+
+	var user model.User
+	if err := s.db.Where("id = ? AND status = '1'", state.UserID).Preload("Roles", sysservice.ActiveRoles(state.UserID)).Preload("Organizations").First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			_ = s.rdb.Del(ctx, key, attemptsKey).Err()
+			return nil, nil, ErrTwoFactorTicketInvalid
+		}
+		return nil, nil, err
+	}
+
+	var ok bool
+	var recoveryCodes []string
+	switch {
+	case state.PendingSecret != "":
+		if ok, err = s.checkCode(ctx, user.ID, state.PendingSecret, code); err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			if recoveryCodes, err = s.enable(user.ID, state.PendingSecret); err != nil {
+				return nil, nil, err
+			}
+			user.TwoFactorEnabled = true
+		}
+	case recoveryCode != "":
+		if ok, err = s.consumeRecoveryCode(user.ID, recoveryCode); err != nil {
+			return nil, nil, err
+		}
+	default:
+		if ok, err = s.checkCode(ctx, user.ID, user.TwoFactorSecret, code); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if !ok {
+		// 用完最后一次机会后票据作废，需重新输入密码
+		if attempt >= maxTicketAttempts {
+			_ = s.rdb.Del(ctx, key, attemptsKey).Err()
+		}
+		// 返回用户以便记录登录失败
+		return &user, nil, ErrTwoFactorCodeInvalid
+	}
+
+	if err := s.rdb.Del(ctx, key, attemptsKey).Err(); err != nil {
+		return nil, nil, err
+	}
+	return &user, recoveryCodes, nil
+}
+
+// Status 查询两步验证状态
+func (s *TwoFactorService) Status(userID int64) (*TwoFactorStatus, error) {
+	var user model.User
+	if err := s.db.Preload("Roles", sysservice.ActiveRoles(userID)).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	var remaining int64
+	if err := s.db.Model(&model.UserRecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&remaining).Error; err != nil {
+		return nil, err
+	}
+	return &TwoFactorStatus{
+		Enabled:                user.TwoFactorEnabled,
+		Required:               s.RequiredByRole(&user),
+		RecoveryCodesRemaining: remaining,
+	}, nil
+}
+
+// BeginEnrollment 个人中心发起绑定：生成待确认密钥
+func (s *TwoFactorService) BeginEnrollment(ctx context.Context, userID int64) (*TwoFactorEnrollment, error) {
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rdb.Set(ctx, fmt.Sprintf("%s%d", twoFactorEnrollPrefix, userID), secret, twoFactorEnrollTTL).Err(); err != nil {
+		return nil, err
+	}
+	cfg := config.GetConfig()
+	return &TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(cfg.TwoFactor.Issuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmEnrollment 使用验证器生成的验证码确认绑定，返回恢复码（仅展示一次）
+func (s *TwoFactorService) ConfirmEnrollment(ctx context.Context, userID int64, code string) ([]string, error) {
+	key := fmt.Sprintf("%s%d", twoFactorEnrollPrefix, userID)
+	secret, err := s.rdb.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrTwoFactorEnrollExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.checkCode(ctx, userID, secret, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTwoFactorCodeInvalid
+	}
+	codes, err := s.enable(userID, secret)
+	if err != nil {
+		return nil, err
+	}
+	_ = s.rdb.Del(ctx, key).Err()
+	return codes, nil
+}
+
+// Disable 关闭两步验证，需提供当前验证码或恢复码
+func (s *TwoFactorService) Disable(ctx context.Context, userID int64, code, recoveryCode string) error {
+	user, err := s.verifyEnabledUser(ctx, userID, code, recoveryCode)
+	if err != nil {
+		return err
+	}
+	if s.RequiredByRole(user) {
+		return ErrTwoFactorRequiredByRole
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"two_factor_enabled": false, "two_factor_secret": ""}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.UserRecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧恢复码全部失效
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) ([]string, error) {
+	if _, err := s.verifyEnabledUser(ctx, userID, code, ""); err != nil {
+		return nil, err
+	}
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+func (s *TwoFactorService) verifyEnabledUser(ctx context.Context, userID int64, code, recoveryCode string) (*model.User, error) {
+	var user model.User
+	if err := s.db.Preload("Roles", sysservice.ActiveRoles(userID)).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if !user.TwoFactorEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	var ok bool
+	var err error
+	if recoveryCode != "" {
+		ok, err = s.consumeRecoveryCode(userID, recoveryCode)
+	} else {
+		ok, err = s.checkCode(ctx, userID, user.TwoFactorSecret, code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTwoFactorCodeInvalid
+	}
+	return &user, nil
+}
+
+// checkCode 校验 TOTP 验证码，同一时间步的验证码只能使用一次
+func (s *TwoFactorService) checkCode(ctx context.Context, userID int64, secret, code string) (bool, error) {
+	if secret == "" || code == "" {
+		return false, nil
+	}
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.rdb.SetNX(ctx, fmt.Sprintf("%s%d:%d", twoFactorUsedStepPrefix, userID, step), 1, twoFactorUsedStepTTL).Result()
+}
+
+func (s *TwoFactorService) enable(userID int64, secret string) ([]string, error) {
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"two_factor_enabled": true, "two_factor_secret": secret}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+func (s *TwoFactorService) consumeRecoveryCode(userID int64, recoveryCode string) (bool, error) {
+	now := time.Now()
+	res := s.db.Model(&model.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(normalizeRecoveryCode(recoveryCode))).
+		Update("used_at", &now)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID int64) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.UserRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]model.UserRecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := utils.RandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		rows = append(rows, model.UserRecoveryCode{
+			ID:       utils.GenerateID(),
+			UserID:   userID,
+			CodeHash: utils.HashToken(raw),
+		})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	sysservice "siqian-admin/internal/sys/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditLogHandler struct {
+	svc *sysservice.AuditLogService
+}
+
+func NewAuditLogHandler(svc *sysservice.AuditLogService) *AuditLogHandler {
+	return &AuditLogHandler{svc: svc}
+}
+
+// List 查询业务数据变更审计日志，可按实体（entity_type + entity_id）与操作人过滤
+func (h *AuditLogHandler) List(c *gin.Context) {
+	params := sysservice.ListAuditLogsParams{
+		EntityType: c.Query("entity_type"),
+		EntityID:   c.Query("entity_id"),
+		Operator:   c.Query("operator"),
+		Action:     c.Query("action"),
+		Page:       toIntDefault(c.Query("page"), 1),
+		PageSize:   toIntDefault(c.Query("page_size"), 10),
+	}
+	if idStr := c.Query("operator_id"); idStr != "" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的操作人ID"})
+			return
+		}
+		params.OperatorID = id
+	}
+	if startStr := c.Query("start_time"); startStr != "" {
+		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
+			params.StartTime = &t
+		}
+	}
+	if endStr := c.Query("end_time"); endStr != "" {
+		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
+			params.EndTime = &t
+		}
+	}
+
+	res, err := h.svc.WithContext(c.Request.Context()).List(params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"siqian-admin/internal/sys/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentDataScope 解析当前用户的数据权限，失败时直接写出错误响应
+func currentDataScope(c *gin.Context, dataScopeService *service.DataScopeService) (*service.DataScope, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+	scope, err := dataScopeService.WithContext(c.Request.Context()).Resolve(userID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "解析数据权限失败", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析数据权限失败"})
+		return nil, false
+	}
+	return scope, true
+}
+
+// ensureUserInScope 校验目标用户在当前用户的数据权限内；范围外按不存在处理，避免泄露
+func ensureUserInScope(c *gin.Context, dataScopeService *service.DataScopeService, userID int64) bool {
+	scope, ok := currentDataScope(c, dataScopeService)
+	if !ok {
+		return false
+	}
+	visible, err := dataScopeService.WithContext(c.Request.Context()).ContainsUser(scope, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "校验数据权限失败"})
+		return false
+	}
+	if !visible {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return false
+	}
+	return true
+}
+
+// ensureOrganizationInScope 校验目标组织在当前用户的数据权限内
+func ensureOrganizationInScope(c *gin.Context, dataScopeService *service.DataScopeService, orgID int64) bool {
+	scope, ok := currentDataScope(c, dataScopeService)
+	if !ok {
+		return false
+	}
+	visible, err := dataScopeService.WithContext(c.Request.Context()).ContainsOrganization(scope, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "校验数据权限失败"})
+		return false
+	}
+	if !visible {
+		c.JSON(http.StatusNotFound, gin.H{"error": "组织不存在"})
+		return false
+	}
+	return true
+}
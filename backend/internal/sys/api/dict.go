@@ -61,7 +61,7 @@ func (h *DictHandler) CreateDict(c *gin.Context) {
 		Status:      req.Status,
 	}
 
-	if err := h.dictService.CreateDict(dict); err != nil {
+	if err := h.dictService.WithContext(c.Request.Context()).CreateDict(dict); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -76,7 +76,7 @@ func (h *DictHandler) GetDict(c *gin.Context) {
 		return
 	}
 
-	dict, err := h.dictService.GetDictByID(uint(id))
+	dict, err := h.dictService.WithContext(c.Request.Context()).GetDictByID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "字典不存在"})
 		return
@@ -98,7 +98,7 @@ func (h *DictHandler) UpdateDict(c *gin.Context) {
 		return
 	}
 
-	dict, err := h.dictService.GetDictByID(uint(id))
+	dict, err := h.dictService.WithContext(c.Request.Context()).GetDictByID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "字典不存在"})
 		return
@@ -109,7 +109,7 @@ func (h *DictHandler) UpdateDict(c *gin.Context) {
 	dict.Description = req.Description
 	dict.Status = req.Status
 
-	if err := h.dictService.UpdateDict(dict); err != nil {
+	if err := h.dictService.WithContext(c.Request.Context()).UpdateDict(dict); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
@@ -124,7 +124,7 @@ func (h *DictHandler) DeleteDict(c *gin.Context) {
 		return
 	}
 
-	if err := h.dictService.DeleteDict(uint(id)); err != nil {
+	if err := h.dictService.WithContext(c.Request.Context()).DeleteDict(uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
@@ -133,7 +133,7 @@ func (h *DictHandler) DeleteDict(c *gin.Context) {
 }
 
 func (h *DictHandler) ListDicts(c *gin.Context) {
-	dicts, err := h.dictService.ListDicts()
+	dicts, err := h.dictService.WithContext(c.Request.Context()).ListDicts()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取字典列表失败"})
 		return
@@ -144,7 +144,7 @@ func (h *DictHandler) ListDicts(c *gin.Context) {
 
 func (h *DictHandler) GetDictByCode(c *gin.Context) {
 	code := c.Param("code")
-	dict, err := h.dictService.GetDictByCode(code)
+	dict, err := h.dictService.WithContext(c.Request.Context()).GetDictByCode(code)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "字典不存在"})
 		return
@@ -185,7 +185,7 @@ func (h *DictHandler) CreateDictItem(c *gin.Context) {
 		Status: req.Status,
 	}
 
-	if err := h.dictService.CreateDictItem(item); err != nil {
+	if err := h.dictService.WithContext(c.Request.Context()).CreateDictItem(item); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -200,7 +200,7 @@ func (h *DictHandler) GetDictItem(c *gin.Context) {
 		return
 	}
 
-	item, err := h.dictService.GetDictItemByID(uint(id))
+	item, err := h.dictService.WithContext(c.Request.Context()).GetDictItemByID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "字典项不存在"})
 		return
@@ -222,7 +222,7 @@ func (h *DictHandler) UpdateDictItem(c *gin.Context) {
 		return
 	}
 
-	item, err := h.dictService.GetDictItemByID(uint(id))
+	item, err := h.dictService.WithContext(c.Request.Context()).GetDictItemByID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "字典项不存在"})
 		return
@@ -233,7 +233,7 @@ func (h *DictHandler) UpdateDictItem(c *gin.Context) {
 	item.Sort = req.Sort
 	item.Status = req.Status
 
-	if err := h.dictService.UpdateDictItem(item); err != nil {
+	if err := h.dictService.WithContext(c.Request.Context()).UpdateDictItem(item); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
@@ -248,7 +248,7 @@ func (h *DictHandler) DeleteDictItem(c *gin.Context) {
 		return
 	}
 
-	if err := h.dictService.DeleteDictItem(uint(id)); err != nil {
+	if err := h.dictService.WithContext(c.Request.Context()).DeleteDictItem(uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
@@ -264,7 +264,7 @@ func (h *DictHandler) ListDictItems(c *gin.Context) {
 		return
 	}
 
-	items, err := h.dictService.ListDictItems(uint(dictID))
+	items, err := h.dictService.WithContext(c.Request.Context()).ListDictItems(uint(dictID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取字典项列表失败"})
 		return
@@ -275,7 +275,7 @@ func (h *DictHandler) ListDictItems(c *gin.Context) {
 
 // 获取所有字典及其字典项（一次性查询）
 func (h *DictHandler) GetAllDictsWithItems(c *gin.Context) {
-	dicts, err := h.dictService.GetAllDictsWithItems()
+	dicts, err := h.dictService.WithContext(c.Request.Context()).GetAllDictsWithItems()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取所有字典失败"})
 		return
@@ -1,58 +1,197 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"siqian-admin/internal/sys/model"
 	sysservice "siqian-admin/internal/sys/service"
+	"siqian-admin/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AccessLogHandler struct {
-	svc *sysservice.AccessLogService
+	svc              *sysservice.AccessLogService
+	retentionService *sysservice.AccessLogRetentionService
+	chainService     *sysservice.AccessLogChainService
+	dataScopeService *sysservice.DataScopeService
 }
 
-func NewAccessLogHandler(svc *sysservice.AccessLogService) *AccessLogHandler {
-	return &AccessLogHandler{svc: svc}
+func NewAccessLogHandler(svc *sysservice.AccessLogService, retentionService *sysservice.AccessLogRetentionService, chainService *sysservice.AccessLogChainService, dataScopeService *sysservice.DataScopeService) *AccessLogHandler {
+	return &AccessLogHandler{svc: svc, retentionService: retentionService, chainService: chainService, dataScopeService: dataScopeService}
 }
 
 func (h *AccessLogHandler) List(c *gin.Context) {
-	username := c.Query("username")
-	path := c.Query("path")
-	startStr := c.Query("start_time")
-	endStr := c.Query("end_time")
-	page := toIntDefault(c.Query("page"), 1)
-	pageSize := toIntDefault(c.Query("page_size"), 10)
-
-	var startTime *time.Time
-	var endTime *time.Time
-	if startStr != "" {
+	params, ok := h.listParams(c)
+	if !ok {
+		return
+	}
+	params.Page = toIntDefault(c.Query("page"), 1)
+	params.PageSize = toIntDefault(c.Query("page_size"), 10)
+
+	res, err := h.svc.WithContext(c.Request.Context()).List(params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Export 按列表相同的筛选条件导出全部日志，format=csv（默认）或 xlsx，边查边写
+func (h *AccessLogHandler) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format 仅支持 csv 或 xlsx"})
+		return
+	}
+	params, ok := h.listParams(c)
+	if !ok {
+		return
+	}
+
+	filename := fmt.Sprintf("access_logs_%s.%s", time.Now().Format("20060102150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	var sheet utils.SheetWriter
+	var err error
+	if format == "xlsx" {
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		sheet, err = utils.NewXLSXWriter(c.Writer, "访问日志")
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		sheet, err = utils.NewCSVWriter(c.Writer)
+	}
+	if err == nil {
+		err = sheet.WriteRow("ID", "请求ID", "用户名", "请求方法", "请求路径", "状态码", "IP", "耗时(ms)", "User-Agent", "时间")
+	}
+	if err == nil {
+		err = h.svc.WithContext(c.Request.Context()).Export(params, func(log model.AccessLog) error {
+			return sheet.WriteRow(log.ID, log.RequestID, log.Username, log.Method, log.Path, log.StatusCode,
+				log.IP, log.LatencyMs, log.UserAgent, log.CreatedAt.Format("2006-01-02 15:04:05"))
+		})
+	}
+	if err == nil {
+		err = sheet.Close()
+	}
+	if err != nil {
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "导出访问日志失败: " + err.Error()})
+			return
+		}
+		// 响应已开始写出，无法再返回 JSON 错误
+		slog.ErrorContext(c.Request.Context(), "导出访问日志失败", "err", err)
+	}
+}
+
+// Stats 时间范围内的汇总统计，默认最近 7 天；top 为热门路径/活跃用户条数
+func (h *AccessLogHandler) Stats(c *gin.Context) {
+	end := time.Now()
+	start := end.AddDate(0, 0, -7)
+	if v := c.Query("start_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "开始时间格式错误，应为 RFC3339"})
+			return
+		}
+		start = t
+	}
+	if v := c.Query("end_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "结束时间格式错误，应为 RFC3339"})
+			return
+		}
+		end = t
+	}
+	if !start.Before(end) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "开始时间必须早于结束时间"})
+		return
+	}
+
+	scope, ok := currentDataScope(c, h.dataScopeService)
+	if !ok {
+		return
+	}
+	stats, err := h.svc.WithContext(c.Request.Context()).Stats(sysservice.AccessLogStatsParams{
+		StartTime: start,
+		EndTime:   end,
+		Top:       toIntDefault(c.Query("top"), 10),
+		Scope:     scope,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计访问日志失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// listParams 解析列表与导出共用的筛选条件
+func (h *AccessLogHandler) listParams(c *gin.Context) (sysservice.ListAccessLogsParams, bool) {
+	params := sysservice.ListAccessLogsParams{
+		RequestID: c.Query("request_id"),
+		Username:  c.Query("username"),
+		Path:      c.Query("path"),
+	}
+	if startStr := c.Query("start_time"); startStr != "" {
 		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
-			startTime = &t
+			params.StartTime = &t
 		}
 	}
-	if endStr != "" {
+	if endStr := c.Query("end_time"); endStr != "" {
 		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
-			endTime = &t
+			params.EndTime = &t
 		}
 	}
 
-	res, err := h.svc.List(sysservice.ListAccessLogsParams{
-		Username:  username,
-		Path:      path,
-		StartTime: startTime,
-		EndTime:   endTime,
-		Page:      page,
-		PageSize:  pageSize,
-	})
+	scope, ok := currentDataScope(c, h.dataScopeService)
+	if !ok {
+		return params, false
+	}
+	params.Scope = scope
+	return params, true
+}
+
+// QueueStats 访问日志写入队列状态：积压、丢弃、写入失败等计数
+func (h *AccessLogHandler) QueueStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.svc.QueueStats())
+}
+
+// Retention 保留策略与按月分区情况
+func (h *AccessLogHandler) Retention(c *gin.Context) {
+	status, err := h.retentionService.Status(time.Now())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取保留策略失败: " + err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, status)
+}
 
-	c.JSON(http.StatusOK, res)
+// Purge 立即按保留策略清理过期日志（与定时任务相同）
+func (h *AccessLogHandler) Purge(c *gin.Context) {
+	result, err := h.retentionService.Purge(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清理过期日志失败: " + err.Error(), "result": result})
+		return
+	}
+	if result == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "未配置保留天数，日志永久保留"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// VerifyChain 校验访问日志哈希链，返回第一处断裂；也可使用 go run ./cmd/logchain 离线校验
+func (h *AccessLogHandler) VerifyChain(c *gin.Context) {
+	report, err := h.chainService.WithContext(c.Request.Context()).Verify()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "校验哈希链失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
 }
 
 func (h *AccessLogHandler) BatchDelete(c *gin.Context) {
@@ -64,7 +203,16 @@ func (h *AccessLogHandler) BatchDelete(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.BatchDelete(req.IDs); err != nil {
+	scope, ok := currentDataScope(c, h.dataScopeService)
+	if !ok {
+		return
+	}
+
+	if err := h.svc.WithContext(c.Request.Context()).BatchDelete(req.IDs, scope); err != nil {
+		if errors.Is(err, sysservice.ErrAccessLogProtected) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"siqian-admin/internal/audit"
+	"siqian-admin/internal/sys/model"
+	sysservice "siqian-admin/internal/sys/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LoginLogHandler struct {
+	svc              *sysservice.LoginLogService
+	dataScopeService *sysservice.DataScopeService
+}
+
+func NewLoginLogHandler(svc *sysservice.LoginLogService, dataScopeService *sysservice.DataScopeService) *LoginLogHandler {
+	return &LoginLogHandler{svc: svc, dataScopeService: dataScopeService}
+}
+
+// List 登录历史与安全事件，按数据权限过滤
+func (h *LoginLogHandler) List(c *gin.Context) {
+	params := sysservice.ListLoginLogsParams{
+		Username: c.Query("username"),
+		Event:    c.Query("event"),
+		Result:   c.Query("result"),
+		IP:       c.Query("ip"),
+		Page:     toIntDefault(c.Query("page"), 1),
+		PageSize: toIntDefault(c.Query("page_size"), 10),
+	}
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+			return
+		}
+		params.UserID = id
+	}
+	if v := c.Query("start_time"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			params.StartTime = &t
+		}
+	}
+	if v := c.Query("end_time"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			params.EndTime = &t
+		}
+	}
+
+	scope, ok := currentDataScope(c, h.dataScopeService)
+	if !ok {
+		return
+	}
+	params.Scope = scope
+
+	res, err := h.svc.WithContext(c.Request.Context()).List(params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// ListAlerts 安全告警列表，acknowledged=true/false 过滤处理状态
+func (h *LoginLogHandler) ListAlerts(c *gin.Context) {
+	params := sysservice.ListSecurityAlertsParams{
+		Type:     c.Query("type"),
+		Page:     toIntDefault(c.Query("page"), 1),
+		PageSize: toIntDefault(c.Query("page_size"), 10),
+	}
+	if v := c.Query("acknowledged"); v != "" {
+		acknowledged, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "acknowledged 应为 true 或 false"})
+			return
+		}
+		params.Acknowledged = &acknowledged
+	}
+
+	scope, ok := currentDataScope(c, h.dataScopeService)
+	if !ok {
+		return
+	}
+	params.Scope = scope
+
+	res, err := h.svc.WithContext(c.Request.Context()).ListAlerts(params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// AcknowledgeAlert 确认已处理的安全告警
+func (h *LoginLogHandler) AcknowledgeAlert(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的告警ID"})
+		return
+	}
+
+	operator := audit.OperatorFrom(c.Request.Context()).Username
+	if err := h.svc.WithContext(c.Request.Context()).AcknowledgeAlert(id, operator); err != nil {
+		if errors.Is(err, sysservice.ErrSecurityAlertNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "确认告警失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "告警已确认"})
+}
+
+// recordLoginEvent 补充请求来源后记录安全事件
+func recordLoginEvent(c *gin.Context, svc *sysservice.LoginLogService, entry model.LoginLog) {
+	entry.IP = c.ClientIP()
+	entry.UserAgent = c.Request.UserAgent()
+	entry.SessionID = c.GetString("session_id")
+	svc.Record(c.Request.Context(), entry)
+}
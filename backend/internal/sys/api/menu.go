@@ -1,7 +1,9 @@
 package api
 
 import (
+	"log/slog"
 	"net/http"
+	authservice "siqian-admin/internal/service"
 	"siqian-admin/internal/sys/model"
 	"siqian-admin/internal/sys/service"
 	"strconv"
@@ -10,11 +12,12 @@ import (
 )
 
 type MenuHandler struct {
-	menuService *service.MenuService
+	menuService    *service.MenuService
+	sessionService *authservice.SessionService
 }
 
-func NewMenuHandler(menuService *service.MenuService) *MenuHandler {
-	return &MenuHandler{menuService: menuService}
+func NewMenuHandler(menuService *service.MenuService, sessionService *authservice.SessionService) *MenuHandler {
+	return &MenuHandler{menuService: menuService, sessionService: sessionService}
 }
 
 type CreateMenuRequest struct {
@@ -79,7 +82,7 @@ func (h *MenuHandler) CreateMenu(c *gin.Context) {
 		KeepAlive:  req.KeepAlive,
 	}
 
-	if err := h.menuService.CreateMenu(menu); err != nil {
+	if err := h.menuService.WithContext(c.Request.Context()).CreateMenu(menu); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -94,7 +97,7 @@ func (h *MenuHandler) GetMenu(c *gin.Context) {
 		return
 	}
 
-	menu, err := h.menuService.GetMenuByID(id)
+	menu, err := h.menuService.WithContext(c.Request.Context()).GetMenuByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "菜单不存在"})
 		return
@@ -116,7 +119,7 @@ func (h *MenuHandler) UpdateMenu(c *gin.Context) {
 		return
 	}
 
-	menu, err := h.menuService.GetMenuByID(id)
+	menu, err := h.menuService.WithContext(c.Request.Context()).GetMenuByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "菜单不存在"})
 		return
@@ -146,10 +149,11 @@ func (h *MenuHandler) UpdateMenu(c *gin.Context) {
 	menu.Hidden = req.Hidden
 	menu.KeepAlive = req.KeepAlive
 
-	if err := h.menuService.UpdateMenu(menu); err != nil {
+	if err := h.menuService.WithContext(c.Request.Context()).UpdateMenu(menu); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
+	h.refreshMenuUsers(c, id)
 
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "menu": menu})
 }
@@ -161,16 +165,17 @@ func (h *MenuHandler) DeleteMenu(c *gin.Context) {
 		return
 	}
 
-	if err := h.menuService.DeleteMenu(id); err != nil {
+	if err := h.menuService.WithContext(c.Request.Context()).DeleteMenu(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
+	h.refreshMenuUsers(c, id)
 
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
 
 func (h *MenuHandler) ListMenus(c *gin.Context) {
-	menus, err := h.menuService.ListMenus()
+	menus, err := h.menuService.WithContext(c.Request.Context()).ListMenus()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取菜单列表失败"})
 		return
@@ -183,3 +188,13 @@ func (h *MenuHandler) ListMenus(c *gin.Context) {
 
 // GetUserMenus 获取当前用户的菜单
 // 已废弃：用户菜单改由登录响应返回
+
+// refreshMenuUsers 菜单权限标识、状态等变化后刷新持有该菜单的用户会话
+func (h *MenuHandler) refreshMenuUsers(c *gin.Context, menuID int64) {
+	userIDs, err := h.menuService.WithContext(c.Request.Context()).GetMenuUserIDs(menuID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "查询菜单用户失败", "menu_id", menuID, "err", err)
+		return
+	}
+	refreshPermissions(c, h.sessionService, userIDs)
+}
@@ -1,7 +1,7 @@
 package api
 
 import (
-	"fmt"
+	"log/slog"
 	"net/http"
 	"siqian-admin/internal/sys/model"
 	"siqian-admin/internal/sys/service"
@@ -12,11 +12,12 @@ import (
 )
 
 type OrganizationHandler struct {
-	orgService *service.OrganizationService
+	orgService       *service.OrganizationService
+	dataScopeService *service.DataScopeService
 }
 
-func NewOrganizationHandler(orgService *service.OrganizationService) *OrganizationHandler {
-	return &OrganizationHandler{orgService: orgService}
+func NewOrganizationHandler(orgService *service.OrganizationService, dataScopeService *service.DataScopeService) *OrganizationHandler {
+	return &OrganizationHandler{orgService: orgService, dataScopeService: dataScopeService}
 }
 
 type CreateOrganizationRequest struct {
@@ -58,15 +59,27 @@ func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
 			return
 		}
 		parentID = &parentIDInt
+		if !ensureOrganizationInScope(c, h.dataScopeService, parentIDInt) {
+			return
+		}
 
 		// 获取父组织的路径
-		parentOrg, err := h.orgService.GetOrganizationByID(parentIDInt)
+		parentOrg, err := h.orgService.WithContext(c.Request.Context()).GetOrganizationByID(parentIDInt)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "父组织不存在，请检查父组织ID是否正确"})
 			return
 		}
 		path = parentOrg.Path + "/" + strconv.FormatInt(id, 10)
 	} else {
+		// 顶级组织只能由拥有全部数据权限的用户创建
+		scope, ok := currentDataScope(c, h.dataScopeService)
+		if !ok {
+			return
+		}
+		if !scope.All {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权创建顶级组织"})
+			return
+		}
 		path = strconv.FormatInt(id, 10)
 	}
 
@@ -85,7 +98,7 @@ func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
 		UpdatedBy:   operatorID.(int64),
 	}
 
-	if err := h.orgService.CreateOrganization(org); err != nil {
+	if err := h.orgService.WithContext(c.Request.Context()).CreateOrganization(org); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -99,8 +112,11 @@ func (h *OrganizationHandler) GetOrganization(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的组织ID"})
 		return
 	}
+	if !ensureOrganizationInScope(c, h.dataScopeService, id) {
+		return
+	}
 
-	org, err := h.orgService.GetOrganizationByID(id)
+	org, err := h.orgService.WithContext(c.Request.Context()).GetOrganizationByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "组织不存在"})
 		return
@@ -115,6 +131,9 @@ func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的组织ID"})
 		return
 	}
+	if !ensureOrganizationInScope(c, h.dataScopeService, id) {
+		return
+	}
 
 	var req UpdateOrganizationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -122,7 +141,7 @@ func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
 		return
 	}
 
-	org, err := h.orgService.GetOrganizationByID(id)
+	org, err := h.orgService.WithContext(c.Request.Context()).GetOrganizationByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "组织不存在"})
 		return
@@ -139,14 +158,26 @@ func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
 			return
 		}
 		newParentID = &parentIDInt
+		if !ensureOrganizationInScope(c, h.dataScopeService, parentIDInt) {
+			return
+		}
 
-		parentOrg, err := h.orgService.GetOrganizationByID(parentIDInt)
+		parentOrg, err := h.orgService.WithContext(c.Request.Context()).GetOrganizationByID(parentIDInt)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "父组织不存在"})
 			return
 		}
 		newPath = parentOrg.Path + "/" + strconv.FormatInt(id, 10)
 	} else {
+		// 移动为顶级组织同样需要全部数据权限
+		scope, ok := currentDataScope(c, h.dataScopeService)
+		if !ok {
+			return
+		}
+		if !scope.All && org.ParentID != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权创建顶级组织"})
+			return
+		}
 		newParentID = nil
 		newPath = strconv.FormatInt(id, 10)
 	}
@@ -160,13 +191,13 @@ func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
 	org.Description = req.Description
 
 	// 调试日志
-	fmt.Printf("更新组织 ID=%d, ParentID=%v, Path=%s\n", org.ID, org.ParentID, org.Path)
+	slog.DebugContext(c.Request.Context(), "更新组织", "id", org.ID, "parent_id", org.ParentID, "path", org.Path)
 	// 设置操作人
 	if operatorID, ok := c.Get("user_id"); ok {
 		org.UpdatedBy = operatorID.(int64)
 	}
 
-	if err := h.orgService.UpdateOrganization(org); err != nil {
+	if err := h.orgService.WithContext(c.Request.Context()).UpdateOrganization(org); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
@@ -180,16 +211,19 @@ func (h *OrganizationHandler) DeleteOrganization(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的组织ID"})
 		return
 	}
+	if !ensureOrganizationInScope(c, h.dataScopeService, id) {
+		return
+	}
 
 	if operatorID, ok := c.Get("user_id"); ok {
-		if err := h.orgService.SoftDeleteOrganization(id, operatorID.(int64)); err != nil {
+		if err := h.orgService.WithContext(c.Request.Context()).SoftDeleteOrganization(id, operatorID.(int64)); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 		return
 	}
-	if err := h.orgService.DeleteOrganization(id); err != nil {
+	if err := h.orgService.WithContext(c.Request.Context()).DeleteOrganization(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
@@ -198,7 +232,12 @@ func (h *OrganizationHandler) DeleteOrganization(c *gin.Context) {
 }
 
 func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
-	orgs, err := h.orgService.ListOrganizations()
+	scope, ok := currentDataScope(c, h.dataScopeService)
+	if !ok {
+		return
+	}
+
+	orgs, err := h.orgService.WithContext(c.Request.Context()).ListOrganizations(scope)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取组织列表失败"})
 		return
@@ -208,7 +247,12 @@ func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
 }
 
 func (h *OrganizationHandler) GetOrganizationTree(c *gin.Context) {
-	orgs, err := h.orgService.GetOrganizationTree()
+	scope, ok := currentDataScope(c, h.dataScopeService)
+	if !ok {
+		return
+	}
+
+	orgs, err := h.orgService.WithContext(c.Request.Context()).GetOrganizationTree(scope)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取组织树失败"})
 		return
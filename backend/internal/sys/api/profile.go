@@ -1,8 +1,12 @@
 package api
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
 	"siqian-admin/internal/config"
+	authservice "siqian-admin/internal/service"
+	"siqian-admin/internal/sys/model"
 	"siqian-admin/internal/sys/service"
 	"siqian-admin/internal/utils"
 	"strconv"
@@ -12,11 +16,14 @@ import (
 )
 
 type ProfileHandler struct {
-	userService *service.UserService
+	userService      *service.UserService
+	twoFactorService *authservice.TwoFactorService
+	sessionService   *authservice.SessionService
+	loginLogService  *service.LoginLogService
 }
 
-func NewProfileHandler(userService *service.UserService) *ProfileHandler {
-	return &ProfileHandler{userService: userService}
+func NewProfileHandler(userService *service.UserService, twoFactorService *authservice.TwoFactorService, sessionService *authservice.SessionService, loginLogService *service.LoginLogService) *ProfileHandler {
+	return &ProfileHandler{userService: userService, twoFactorService: twoFactorService, sessionService: sessionService, loginLogService: loginLogService}
 }
 
 type UpdateProfileRequest struct {
@@ -31,6 +38,16 @@ type ChangePasswordRequest struct {
 	NewPassword string `json:"new_password" binding:"required"`
 }
 
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
 // GetProfile 获取当前用户资料
 func (h *ProfileHandler) GetProfile(c *gin.Context) {
 	userID, exists := c.Get("user_id")
@@ -45,7 +62,7 @@ func (h *ProfileHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetUserByID(userIDInt)
+	user, err := h.userService.WithContext(c.Request.Context()).GetUserByID(userIDInt)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
@@ -75,7 +92,7 @@ func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetUserByID(userIDInt)
+	user, err := h.userService.WithContext(c.Request.Context()).GetUserByID(userIDInt)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
@@ -92,13 +109,13 @@ func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
 		user.Email = nil
 	}
 
-	if err := h.userService.UpdateUser(user); err != nil {
+	if err := h.userService.WithContext(c.Request.Context()).UpdateUser(user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
 
 	// 重新查询用户信息，确保返回最新数据
-	updatedUser, err := h.userService.GetUserByID(userIDInt)
+	updatedUser, err := h.userService.WithContext(c.Request.Context()).GetUserByID(userIDInt)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取更新后的用户信息失败"})
 		return
@@ -130,7 +147,7 @@ func (h *ProfileHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetUserByID(userIDInt)
+	user, err := h.userService.WithContext(c.Request.Context()).GetUserByID(userIDInt)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
@@ -138,6 +155,7 @@ func (h *ProfileHandler) ChangePassword(c *gin.Context) {
 
 	// 验证旧密码
 	if !utils.CheckPasswordHash(req.OldPassword, user.Password) {
+		recordLoginEvent(c, h.loginLogService, model.LoginLog{UserID: user.ID, Username: user.Username, Event: model.LoginEventPasswordChange, Result: model.LoginResultFailure, Reason: "原密码错误"})
 		c.JSON(http.StatusOK, gin.H{
 			"code":    400,
 			"success": false,
@@ -146,19 +164,19 @@ func (h *ProfileHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	// 加密新密码
-	hashedPassword, err := utils.HashPassword(req.NewPassword)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"code":    500,
-			"success": false,
-			"message": "密码加密失败",
-		})
-		return
-	}
-
-	user.Password = hashedPassword
-	if err := h.userService.UpdateUser(user); err != nil {
+	// 按密码策略修改（长度、字符类别、黑名单、历史密码）
+	if err := h.userService.WithContext(c.Request.Context()).ChangePassword(userIDInt, req.NewPassword); err != nil {
+		recordLoginEvent(c, h.loginLogService, model.LoginLog{UserID: user.ID, Username: user.Username, Event: model.LoginEventPasswordChange, Result: model.LoginResultFailure, Reason: err.Error()})
+		var policyErr *service.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusOK, gin.H{
+				"code":       400,
+				"success":    false,
+				"message":    policyErr.Error(),
+				"violations": policyErr.Violations,
+			})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"code":    500,
 			"success": false,
@@ -167,6 +185,8 @@ func (h *ProfileHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
+	recordLoginEvent(c, h.loginLogService, model.LoginLog{UserID: user.ID, Username: user.Username, Event: model.LoginEventPasswordChange, Result: model.LoginResultSuccess})
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"success": true,
@@ -231,7 +251,7 @@ func (h *ProfileHandler) UploadAvatar(c *gin.Context) {
 	}
 
 	// 更新用户头像路径
-	user, err := h.userService.GetUserByID(userIDInt)
+	user, err := h.userService.WithContext(c.Request.Context()).GetUserByID(userIDInt)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
@@ -239,7 +259,7 @@ func (h *ProfileHandler) UploadAvatar(c *gin.Context) {
 
 	// 保存相对路径到数据库
 	user.Avatar = "/" + uploadPath + fileName
-	if err := h.userService.UpdateUser(user); err != nil {
+	if err := h.userService.WithContext(c.Request.Context()).UpdateUser(user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "头像更新失败"})
 		return
 	}
@@ -251,3 +271,219 @@ func (h *ProfileHandler) UploadAvatar(c *gin.Context) {
 		"avatar":  avatarURL,
 	})
 }
+
+// GetTwoFactorStatus 查询两步验证状态
+func (h *ProfileHandler) GetTwoFactorStatus(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	status, err := h.twoFactorService.Status(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// SetupTwoFactor 生成待确认的 TOTP 密钥与二维码地址
+func (h *ProfileHandler) SetupTwoFactor(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.twoFactorService.BeginEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, authservice.ErrTwoFactorAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "两步验证绑定失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTwoFactor 校验验证码完成绑定，返回恢复码
+func (h *ProfileHandler) ConfirmTwoFactor(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.twoFactorService.ConfirmEnrollment(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		if errors.Is(err, authservice.ErrTwoFactorCodeInvalid) || errors.Is(err, authservice.ErrTwoFactorEnrollExpired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "两步验证确认失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "启用两步验证失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已启用", "recovery_codes": codes})
+}
+
+// DisableTwoFactor 关闭两步验证，需同时提供密码与验证码（或恢复码）
+func (h *ProfileHandler) DisableTwoFactor(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.WithContext(c.Request.Context()).GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !utils.CheckPasswordHash(req.Password, user.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密码错误"})
+		return
+	}
+
+	if err := h.twoFactorService.Disable(c.Request.Context(), userID, req.Code, req.RecoveryCode); err != nil {
+		switch {
+		case errors.Is(err, authservice.ErrTwoFactorCodeInvalid), errors.Is(err, authservice.ErrTwoFactorNotEnabled):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, authservice.ErrTwoFactorRequiredByRole):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			slog.ErrorContext(c.Request.Context(), "关闭两步验证失败", "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "关闭两步验证失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已关闭"})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+func (h *ProfileHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.twoFactorService.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		if errors.Is(err, authservice.ErrTwoFactorCodeInvalid) || errors.Is(err, authservice.ErrTwoFactorNotEnabled) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "生成恢复码失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成恢复码失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// ListSessions 列出当前用户的登录会话，标记本次请求所属会话
+func (h *ProfileHandler) ListSessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessionService.ListUserSessions(c.Request.Context(), userID, c.GetString("session_id"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "查询登录会话失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询登录会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession 注销当前用户的指定会话
+func (h *ProfileHandler) RevokeSession(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.sessionService.RevokeUserSession(c.Request.Context(), userID, c.Param("session_id")); err != nil {
+		if errors.Is(err, authservice.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "注销会话失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "会话已注销"})
+}
+
+// RevokeOtherSessions 注销除当前会话外的全部会话
+func (h *ProfileHandler) RevokeOtherSessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.sessionService.RevokeOtherSessions(c.Request.Context(), userID, c.GetString("session_id")); err != nil {
+		slog.ErrorContext(c.Request.Context(), "注销其他会话失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销其他会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "其他会话已全部注销"})
+}
+
+// RecentLogins 当前用户最近的登录记录，便于发现异常登录
+func (h *ProfileHandler) RecentLogins(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	logins, err := h.loginLogService.WithContext(c.Request.Context()).Recent(userID, toIntDefault(c.Query("limit"), 20))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "查询登录记录失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询登录记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"logins": logins})
+}
+
+// currentUserID 读取认证中间件写入的当前用户ID，失败时直接写出错误响应
+func currentUserID(c *gin.Context) (int64, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return 0, false
+	}
+
+	userIDInt, ok := userID.(int64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "用户ID格式错误"})
+		return 0, false
+	}
+	return userIDInt, true
+}
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
+	authservice "siqian-admin/internal/service"
 	"siqian-admin/internal/sys/model"
 	"siqian-admin/internal/sys/service"
 	"strconv"
@@ -10,27 +13,40 @@ import (
 )
 
 type RoleHandler struct {
-	roleService *service.RoleService
+	roleService    *service.RoleService
+	sessionService *authservice.SessionService
 }
 
-func NewRoleHandler(roleService *service.RoleService) *RoleHandler {
-	return &RoleHandler{roleService: roleService}
+func NewRoleHandler(roleService *service.RoleService, sessionService *authservice.SessionService) *RoleHandler {
+	return &RoleHandler{roleService: roleService, sessionService: sessionService}
 }
 
 type CreateRoleRequest struct {
 	Name        string `json:"name" binding:"required"`
 	Code        string `json:"code" binding:"required"`
+	ParentID    string `json:"parent_id"` // 上级角色ID，为空表示顶级角色
 	Description string `json:"description"`
 	Status      string `json:"status"`
 	Sort        int    `json:"sort"`
+	Require2FA  bool   `json:"require_2fa"`
+	MaxUsers    int    `json:"max_users"` // 最多可授予的用户数，0 表示不限制
+	// 数据权限：all | org | org_and_child | custom | self，custom 时使用 DataScopeOrgIDs
+	DataScope       string   `json:"data_scope"`
+	DataScopeOrgIDs []string `json:"data_scope_org_ids"`
 }
 
 type UpdateRoleRequest struct {
-	Name        string `json:"name"`
-	Code        string `json:"code"`
-	Description string `json:"description"`
-	Status      string `json:"status"`
-	Sort        int    `json:"sort"`
+	Name        string  `json:"name"`
+	Code        string  `json:"code"`
+	ParentID    *string `json:"parent_id"` // 不传保持不变，传空串改为顶级角色
+	Description string  `json:"description"`
+	Status      string  `json:"status"`
+	Sort        int     `json:"sort"`
+	Require2FA  bool    `json:"require_2fa"`
+	MaxUsers    int     `json:"max_users"` // 降低上限不会回收已有授权，超出部分见约束审计报告
+	// 数据权限：all | org | org_and_child | custom | self，custom 时使用 DataScopeOrgIDs
+	DataScope       string   `json:"data_scope"`
+	DataScopeOrgIDs []string `json:"data_scope_org_ids"`
 }
 
 func (h *RoleHandler) CreateRole(c *gin.Context) {
@@ -40,18 +56,36 @@ func (h *RoleHandler) CreateRole(c *gin.Context) {
 		return
 	}
 
+	dataScope, orgIDs, ok := parseDataScope(c, req.DataScope, req.DataScopeOrgIDs)
+	if !ok {
+		return
+	}
+
+	parentID, ok := parseParentRoleID(c, req.ParentID)
+	if !ok {
+		return
+	}
+
 	role := &model.Role{
 		Name:        req.Name,
 		Code:        req.Code,
+		ParentID:    parentID,
 		Description: req.Description,
 		Status:      req.Status,
 		Sort:        req.Sort,
+		Require2FA:  req.Require2FA,
+		MaxUsers:    req.MaxUsers,
+		DataScope:   dataScope,
 	}
 
-	if err := h.roleService.CreateRole(role); err != nil {
+	if err := h.roleService.WithContext(c.Request.Context()).CreateRole(role); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := h.roleService.WithContext(c.Request.Context()).SetDataScopeOrgs(role.ID, orgIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置数据权限失败"})
+		return
+	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "角色创建成功", "role": role})
 }
@@ -63,7 +97,7 @@ func (h *RoleHandler) GetRole(c *gin.Context) {
 		return
 	}
 
-	role, err := h.roleService.GetRoleByID(id)
+	role, err := h.roleService.WithContext(c.Request.Context()).GetRoleByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
 		return
@@ -85,22 +119,60 @@ func (h *RoleHandler) UpdateRole(c *gin.Context) {
 		return
 	}
 
-	role, err := h.roleService.GetRoleByID(id)
+	role, err := h.roleService.WithContext(c.Request.Context()).GetRoleByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
 		return
 	}
 
+	// 未传数据权限时保持原设置
+	dataScope := role.DataScope
+	var orgIDs []int64
+	if req.DataScope != "" {
+		var ok bool
+		if dataScope, orgIDs, ok = parseDataScope(c, req.DataScope, req.DataScopeOrgIDs); !ok {
+			return
+		}
+	}
+
+	parentChanged := false
+	if req.ParentID != nil {
+		parentID, ok := parseParentRoleID(c, *req.ParentID)
+		if !ok {
+			return
+		}
+		parentChanged = !sameRoleID(role.ParentID, parentID)
+		role.ParentID = parentID
+	}
+
 	role.Name = req.Name
 	role.Code = req.Code
 	role.Description = req.Description
 	role.Status = req.Status
 	role.Sort = req.Sort
+	role.Require2FA = req.Require2FA
+	role.MaxUsers = req.MaxUsers
+	role.DataScope = dataScope
 
-	if err := h.roleService.UpdateRole(role); err != nil {
+	if err := h.roleService.WithContext(c.Request.Context()).UpdateRole(role); err != nil {
+		if errors.Is(err, service.ErrRoleCycle) || errors.Is(err, service.ErrParentRoleNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
+	if req.DataScope != "" {
+		if err := h.roleService.WithContext(c.Request.Context()).SetDataScopeOrgs(role.ID, orgIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "设置数据权限失败"})
+			return
+		}
+	}
+
+	// 上级变化后，本角色及下级角色用户继承的权限随之变化
+	if parentChanged {
+		h.refreshRoleUsers(c, id)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "role": role})
 }
@@ -112,16 +184,28 @@ func (h *RoleHandler) DeleteRole(c *gin.Context) {
 		return
 	}
 
-	if err := h.roleService.DeleteRole(id); err != nil {
+	// 删除前记录角色下的用户，删除后刷新其权限
+	userIDs, err := h.roleService.WithContext(c.Request.Context()).GetRoleUserIDs(id)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
 
+	if err := h.roleService.WithContext(c.Request.Context()).DeleteRole(id); err != nil {
+		if errors.Is(err, service.ErrRoleHasChildren) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	refreshPermissions(c, h.sessionService, userIDs)
+
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
 
 func (h *RoleHandler) ListRoles(c *gin.Context) {
-	roles, err := h.roleService.ListRoles()
+	roles, err := h.roleService.WithContext(c.Request.Context()).ListRoles()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取角色列表失败"})
 		return
@@ -157,10 +241,11 @@ func (h *RoleHandler) AssignMenus(c *gin.Context) {
 		menuIDs[i] = menuID
 	}
 
-	if err := h.roleService.AssignMenus(id, menuIDs); err != nil {
+	if err := h.roleService.WithContext(c.Request.Context()).AssignMenus(id, menuIDs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "分配菜单失败: " + err.Error()})
 		return
 	}
+	h.refreshRoleUsers(c, id)
 
 	c.JSON(http.StatusOK, gin.H{"message": "菜单分配成功"})
 }
@@ -192,10 +277,93 @@ func (h *RoleHandler) AssignUsers(c *gin.Context) {
 		userIDs[i] = userID
 	}
 
-	if err := h.roleService.AssignUsers(id, userIDs); err != nil {
+	// 原有用户与新用户都可能受影响
+	previousIDs, err := h.roleService.WithContext(c.Request.Context()).GetRoleUserIDs(id)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "分配用户失败: " + err.Error()})
 		return
 	}
 
+	if err := h.roleService.WithContext(c.Request.Context()).AssignUsers(id, userIDs); err != nil {
+		if writeRoleConstraintError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "分配用户失败: " + err.Error()})
+		return
+	}
+	refreshPermissions(c, h.sessionService, append(previousIDs, userIDs...))
+
 	c.JSON(http.StatusOK, gin.H{"message": "用户分配成功"})
 }
+
+// GetEffectivePermissions 查看角色的有效权限集合（含继承）及每项权限的来源角色
+func (h *RoleHandler) GetEffectivePermissions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID"})
+		return
+	}
+
+	perms, err := h.roleService.WithContext(c.Request.Context()).GetEffectivePermissions(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, perms)
+}
+
+// refreshRoleUsers 刷新拥有该角色的全部用户的会话权限
+func (h *RoleHandler) refreshRoleUsers(c *gin.Context, roleID int64) {
+	userIDs, err := h.roleService.WithContext(c.Request.Context()).GetRoleUserIDs(roleID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "查询角色用户失败", "role_id", roleID, "err", err)
+		return
+	}
+	refreshPermissions(c, h.sessionService, userIDs)
+}
+
+// parseDataScope 校验数据权限参数；未指定时默认为全部数据，非 custom 时忽略组织集合
+func parseDataScope(c *gin.Context, scope string, orgIDStrs []string) (string, []int64, bool) {
+	if scope == "" {
+		scope = service.DataScopeAll
+	}
+	if !service.ValidDataScope(scope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的数据权限: " + scope})
+		return "", nil, false
+	}
+	if scope != service.DataScopeCustom {
+		return scope, nil, true
+	}
+
+	orgIDs := make([]int64, 0, len(orgIDStrs))
+	for _, idStr := range orgIDStrs {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的组织ID: " + idStr})
+			return "", nil, false
+		}
+		orgIDs = append(orgIDs, id)
+	}
+	return scope, orgIDs, true
+}
+
+// parseParentRoleID 解析上级角色ID，空串表示顶级角色
+func parseParentRoleID(c *gin.Context, raw string) (*int64, bool) {
+	if raw == "" {
+		return nil, true
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "上级角色ID格式错误"})
+		return nil, false
+	}
+	return &id, true
+}
+
+func sameRoleID(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"siqian-admin/internal/sys/model"
+	"siqian-admin/internal/sys/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleConstraintHandler struct {
+	constraintService *service.RoleConstraintService
+}
+
+func NewRoleConstraintHandler(constraintService *service.RoleConstraintService) *RoleConstraintHandler {
+	return &RoleConstraintHandler{constraintService: constraintService}
+}
+
+// RoleConstraintRequest 职责分离约束：同一用户最多持有 RoleIDs 中的 MaxRoles 个角色
+type RoleConstraintRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	MaxRoles    int      `json:"max_roles"` // 不传默认为 1，即集合内角色两两互斥
+	RoleIDs     []string `json:"role_ids" binding:"required"`
+}
+
+func (h *RoleConstraintHandler) CreateConstraint(c *gin.Context) {
+	var req RoleConstraintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	roleIDs, ok := parseConstraintRoleIDs(c, req.RoleIDs)
+	if !ok {
+		return
+	}
+
+	constraint := &model.RoleConstraint{
+		Name:        req.Name,
+		Description: req.Description,
+		MaxRoles:    maxRolesOrDefault(req.MaxRoles),
+	}
+	if err := h.constraintService.WithContext(c.Request.Context()).CreateConstraint(constraint, roleIDs); err != nil {
+		if errors.Is(err, service.ErrInvalidRoleConstraint) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建约束失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "约束创建成功", "constraint": constraint})
+}
+
+func (h *RoleConstraintHandler) ListConstraints(c *gin.Context) {
+	constraints, err := h.constraintService.WithContext(c.Request.Context()).ListConstraints()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取约束列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"constraints": constraints})
+}
+
+func (h *RoleConstraintHandler) GetConstraint(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的约束ID"})
+		return
+	}
+
+	constraint, err := h.constraintService.WithContext(c.Request.Context()).GetConstraintByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "约束不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, constraint)
+}
+
+func (h *RoleConstraintHandler) UpdateConstraint(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的约束ID"})
+		return
+	}
+
+	var req RoleConstraintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	roleIDs, ok := parseConstraintRoleIDs(c, req.RoleIDs)
+	if !ok {
+		return
+	}
+
+	constraint, err := h.constraintService.WithContext(c.Request.Context()).GetConstraintByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "约束不存在"})
+		return
+	}
+	constraint.Name = req.Name
+	constraint.Description = req.Description
+	constraint.MaxRoles = maxRolesOrDefault(req.MaxRoles)
+
+	if err := h.constraintService.WithContext(c.Request.Context()).UpdateConstraint(constraint, roleIDs); err != nil {
+		if errors.Is(err, service.ErrInvalidRoleConstraint) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
+}
+
+func (h *RoleConstraintHandler) DeleteConstraint(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的约束ID"})
+		return
+	}
+
+	if err := h.constraintService.WithContext(c.Request.Context()).DeleteConstraint(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// ListViolations 审计报告：列出现有授权中违反职责分离约束或人数上限的情况
+func (h *RoleConstraintHandler) ListViolations(c *gin.Context) {
+	violations, err := h.constraintService.WithContext(c.Request.Context()).Violations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成审计报告失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"violations": violations, "total": len(violations)})
+}
+
+// writeRoleConstraintError 分配角色违反约束时返回 409 及违规明细
+func writeRoleConstraintError(c *gin.Context, err error) bool {
+	var constraintErr *service.RoleConstraintError
+	if !errors.As(err, &constraintErr) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": constraintErr.Error(), "violations": constraintErr.Violations})
+	return true
+}
+
+func parseConstraintRoleIDs(c *gin.Context, roleIDStrs []string) ([]int64, bool) {
+	roleIDs := make([]int64, len(roleIDStrs))
+	for i, roleIDStr := range roleIDStrs {
+		roleID, err := strconv.ParseInt(roleIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID: " + roleIDStr})
+			return nil, false
+		}
+		roleIDs[i] = roleID
+	}
+	return roleIDs, true
+}
+
+func maxRolesOrDefault(maxRoles int) int {
+	if maxRoles == 0 {
+		return 1
+	}
+	return maxRoles
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	authservice "siqian-admin/internal/service"
+	"siqian-admin/internal/sys/service"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RoleGrantHandler struct {
+	roleGrantService *service.RoleGrantService
+	dataScopeService *service.DataScopeService
+	sessionService   *authservice.SessionService
+}
+
+func NewRoleGrantHandler(roleGrantService *service.RoleGrantService, dataScopeService *service.DataScopeService, sessionService *authservice.SessionService) *RoleGrantHandler {
+	return &RoleGrantHandler{roleGrantService: roleGrantService, dataScopeService: dataScopeService, sessionService: sessionService}
+}
+
+// GrantRoleRequest 授予角色，时间为 RFC3339 格式，留空表示不限制
+type GrantRoleRequest struct {
+	RoleID     string `json:"role_id" binding:"required"`
+	ValidFrom  string `json:"valid_from"`
+	ValidUntil string `json:"valid_until"`
+}
+
+// ListUserGrants 查看用户的角色授权及有效期
+func (h *RoleGrantHandler) ListUserGrants(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	if !ensureUserInScope(c, h.dataScopeService, id) {
+		return
+	}
+
+	grants, err := h.roleGrantService.WithContext(c.Request.Context()).ListUserGrants(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取角色授权失败"})
+		return
+	}
+	c.JSON(http.StatusOK, grants)
+}
+
+// GrantRole 授予用户角色，可设置生效和失效时间；已有授权时更新其有效期
+func (h *RoleGrantHandler) GrantRole(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	if !ensureUserInScope(c, h.dataScopeService, id) {
+		return
+	}
+
+	var req GrantRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	roleID, err := strconv.ParseInt(req.RoleID, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID: " + req.RoleID})
+		return
+	}
+	validFrom, err := parseGrantTime(req.ValidFrom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "生效时间格式错误，应为 RFC3339"})
+		return
+	}
+	validUntil, err := parseGrantTime(req.ValidUntil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "失效时间格式错误，应为 RFC3339"})
+		return
+	}
+
+	if err := h.roleGrantService.WithContext(c.Request.Context()).Grant(id, roleID, validFrom, validUntil); err != nil {
+		if writeRoleConstraintError(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrInvalidGrantWindow):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户或角色不存在"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "授予角色失败: " + err.Error()})
+		}
+		return
+	}
+	refreshPermissions(c, h.sessionService, []int64{id})
+
+	c.JSON(http.StatusOK, gin.H{"message": "角色授予成功"})
+}
+
+// ListExpiring 列出即将到期的角色授权，hours 为查询窗口（默认 72 小时）
+func (h *RoleGrantHandler) ListExpiring(c *gin.Context) {
+	hours := toIntDefault(c.Query("hours"), 72)
+	if hours <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hours 必须大于 0"})
+		return
+	}
+
+	scope, ok := currentDataScope(c, h.dataScopeService)
+	if !ok {
+		return
+	}
+	grants, err := h.roleGrantService.WithContext(c.Request.Context()).ListExpiring(time.Duration(hours)*time.Hour, scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取即将到期的授权失败"})
+		return
+	}
+	c.JSON(http.StatusOK, grants)
+}
+
+func parseGrantTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -1,7 +1,11 @@
 package api
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
+	"siqian-admin/internal/audit"
+	authservice "siqian-admin/internal/service"
 	"siqian-admin/internal/sys/model"
 	"siqian-admin/internal/sys/service"
 	"strconv"
@@ -10,11 +14,15 @@ import (
 )
 
 type UserHandler struct {
-	userService *service.UserService
+	userService      *service.UserService
+	dataScopeService *service.DataScopeService
+	loginGuard       *authservice.LoginGuardService
+	sessionService   *authservice.SessionService
+	loginLogService  *service.LoginLogService
 }
 
-func NewUserHandler(userService *service.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService *service.UserService, dataScopeService *service.DataScopeService, loginGuard *authservice.LoginGuardService, sessionService *authservice.SessionService, loginLogService *service.LoginLogService) *UserHandler {
+	return &UserHandler{userService: userService, dataScopeService: dataScopeService, loginGuard: loginGuard, sessionService: sessionService, loginLogService: loginLogService}
 }
 
 type CreateUserRequest struct {
@@ -27,6 +35,10 @@ type CreateUserRequest struct {
 	Status         string `json:"status"`
 }
 
+type ResetPasswordRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
 type UpdateUserRequest struct {
 	Email    string `json:"email"`
 	Phone    string `json:"phone"`
@@ -59,20 +71,33 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		user.Email = &req.Email
 	}
 
-	if err := h.userService.CreateUser(user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// 如果提供了组织ID，则关联用户到组织
+	// 新用户只能归属到数据权限范围内的组织
+	var orgID int64
 	if req.OrganizationID != "" {
-		orgID, err := strconv.ParseInt(req.OrganizationID, 10, 64)
+		parsed, err := strconv.ParseInt(req.OrganizationID, 10, 64)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的组织ID"})
 			return
 		}
+		if !ensureOrganizationInScope(c, h.dataScopeService, parsed) {
+			return
+		}
+		orgID = parsed
+	}
 
-		if err := h.userService.AssignOrganizations(user.ID, []int64{orgID}); err != nil {
+	if err := h.userService.WithContext(c.Request.Context()).CreateUser(user); err != nil {
+		var policyErr *service.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Error(), "violations": policyErr.Violations})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 如果提供了组织ID，则关联用户到组织
+	if orgID != 0 {
+		if err := h.userService.WithContext(c.Request.Context()).AssignOrganizations(user.ID, []int64{orgID}); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "关联组织失败"})
 			return
 		}
@@ -87,8 +112,11 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
 		return
 	}
+	if !ensureUserInScope(c, h.dataScopeService, id) {
+		return
+	}
 
-	user, err := h.userService.GetUserByID(id)
+	user, err := h.userService.WithContext(c.Request.Context()).GetUserByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
@@ -103,6 +131,9 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
 		return
 	}
+	if !ensureUserInScope(c, h.dataScopeService, id) {
+		return
+	}
 
 	var req UpdateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -110,7 +141,7 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetUserByID(id)
+	user, err := h.userService.WithContext(c.Request.Context()).GetUserByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
@@ -131,11 +162,16 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		user.Email = nil
 	}
 
-	if err := h.userService.UpdateUser(user); err != nil {
+	if err := h.userService.WithContext(c.Request.Context()).UpdateUser(user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
 
+	// 禁用用户时立即注销其全部会话
+	if user.Status != "1" {
+		h.revokeSessions(c, user.ID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "user": user})
 }
 
@@ -145,14 +181,18 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
 		return
 	}
+	if !ensureUserInScope(c, h.dataScopeService, id) {
+		return
+	}
 
 	// 操作人
 	operatorID, _ := c.Get("user_id")
 
-	if err := h.userService.SoftDeleteUser(id, operatorID.(int64)); err != nil {
+	if err := h.userService.WithContext(c.Request.Context()).SoftDeleteUser(id, operatorID.(int64)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
+	h.revokeSessions(c, id)
 
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
@@ -178,12 +218,20 @@ func (h *UserHandler) BatchDeleteUsers(c *gin.Context) {
 		ids = append(ids, id)
 	}
 
+	// 任一用户超出数据权限时整批拒绝
+	for _, id := range ids {
+		if !ensureUserInScope(c, h.dataScopeService, id) {
+			return
+		}
+	}
+
 	// 批量删除用户
 	for _, id := range ids {
-		if err := h.userService.DeleteUser(id); err != nil {
+		if err := h.userService.WithContext(c.Request.Context()).DeleteUser(id); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除用户失败"})
 			return
 		}
+		h.revokeSessions(c, id)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "批量删除成功"})
@@ -198,18 +246,19 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 	phone := c.Query("phone")                        // 手机号（模糊）
 	statusStr := c.Query("status")                   // 状态（精确）
 
-	var filters *service.UserFilters
-	if username != "" || phone != "" || statusStr != "" {
-		filters = &service.UserFilters{}
-		if username != "" {
-			filters.Username = username
-		}
-		if phone != "" {
-			filters.Phone = phone
-		}
-		if statusStr != "" {
-			filters.Status = &statusStr
-		}
+	scope, ok := currentDataScope(c, h.dataScopeService)
+	if !ok {
+		return
+	}
+	filters := &service.UserFilters{Scope: scope}
+	if username != "" {
+		filters.Username = username
+	}
+	if phone != "" {
+		filters.Phone = phone
+	}
+	if statusStr != "" {
+		filters.Status = &statusStr
 	}
 
 	var users []model.User
@@ -218,7 +267,7 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 
 	if organizationPath != "" {
 		// 按组织路径查询用户（包含子组织）
-		users, total, err = h.userService.ListUsersByOrganizationPath(organizationPath, page, pageSize, filters)
+		users, total, err = h.userService.WithContext(c.Request.Context()).ListUsersByOrganizationPath(organizationPath, page, pageSize, filters)
 	} else if organizationID != "" {
 		// 按组织ID查询用户（仅当前组织）
 		orgID, parseErr := strconv.ParseInt(organizationID, 10, 64)
@@ -226,11 +275,10 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的组织ID"})
 			return
 		}
-		// ListUsersByOrganization 暂不支持 filters，保持原行为
-		users, total, err = h.userService.ListUsersByOrganization(orgID, page, pageSize)
+		users, total, err = h.userService.WithContext(c.Request.Context()).ListUsersByOrganization(orgID, page, pageSize, filters)
 	} else {
 		// 查询所有用户
-		users, total, err = h.userService.ListUsers(page, pageSize, filters)
+		users, total, err = h.userService.WithContext(c.Request.Context()).ListUsers(page, pageSize, filters)
 	}
 
 	if err != nil {
@@ -252,6 +300,9 @@ func (h *UserHandler) AssignRoles(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
 		return
 	}
+	if !ensureUserInScope(c, h.dataScopeService, id) {
+		return
+	}
 
 	var req struct {
 		RoleIDs []string `json:"role_ids" binding:"required"`
@@ -273,10 +324,136 @@ func (h *UserHandler) AssignRoles(c *gin.Context) {
 		roleIDs[i] = roleID
 	}
 
-	if err := h.userService.AssignRoles(id, roleIDs); err != nil {
+	if err := h.userService.WithContext(c.Request.Context()).AssignRoles(id, roleIDs); err != nil {
+		if writeRoleConstraintError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "分配角色失败: " + err.Error()})
 		return
 	}
+	refreshPermissions(c, h.sessionService, []int64{id})
 
 	c.JSON(http.StatusOK, gin.H{"message": "角色分配成功"})
 }
+
+// ResetPassword 管理员重置用户密码，同样受密码策略约束
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	if !ensureUserInScope(c, h.dataScopeService, id) {
+		return
+	}
+
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.userService.WithContext(c.Request.Context()).ChangePassword(id, req.Password); err != nil {
+		var policyErr *service.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Error(), "violations": policyErr.Violations})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		return
+	}
+	h.loginLogService.Record(c.Request.Context(), model.LoginLog{
+		UserID:    id,
+		Event:     model.LoginEventPasswordReset,
+		Result:    model.LoginResultSuccess,
+		Reason:    "管理员 " + audit.OperatorFrom(c.Request.Context()).Username + " 重置",
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码重置成功"})
+}
+
+// UnlockUser 解除因登录失败过多导致的临时锁定
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	if !ensureUserInScope(c, h.dataScopeService, id) {
+		return
+	}
+
+	user, err := h.userService.WithContext(c.Request.Context()).GetUserByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if err := h.loginGuard.Unlock(c.Request.Context(), user.Username); err != nil {
+		slog.ErrorContext(c.Request.Context(), "解除登录锁定失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解锁失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "解锁成功"})
+}
+
+// ListSessions 管理员查看指定用户的登录会话
+func (h *UserHandler) ListSessions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	if !ensureUserInScope(c, h.dataScopeService, id) {
+		return
+	}
+
+	sessions, err := h.sessionService.ListUserSessions(c.Request.Context(), id, "")
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "查询登录会话失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询登录会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// ForceLogout 强制注销指定用户的全部会话
+func (h *UserHandler) ForceLogout(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	if !ensureUserInScope(c, h.dataScopeService, id) {
+		return
+	}
+
+	if err := h.sessionService.RevokeUserSessions(c.Request.Context(), id); err != nil {
+		slog.ErrorContext(c.Request.Context(), "强制下线失败", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "强制下线失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已强制下线"})
+}
+
+// revokeSessions 注销用户全部会话；失败只记录日志，不影响主操作结果
+func (h *UserHandler) revokeSessions(c *gin.Context, userID int64) {
+	if err := h.sessionService.RevokeUserSessions(c.Request.Context(), userID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "注销用户会话失败", "user_id", userID, "err", err)
+	}
+}
+
+// refreshPermissions 角色、菜单绑定变化后刷新受影响用户的会话权限；失败只记录日志
+func refreshPermissions(c *gin.Context, sessionService *authservice.SessionService, userIDs []int64) {
+	if len(userIDs) == 0 {
+		return
+	}
+	if err := sessionService.RefreshPermissions(c.Request.Context(), userIDs); err != nil {
+		slog.ErrorContext(c.Request.Context(), "刷新会话权限失败", "user_ids", userIDs, "err", err)
+	}
+}
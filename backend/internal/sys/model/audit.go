@@ -0,0 +1,59 @@
+package model
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// 审计操作类型
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// AuditLog 业务数据变更审计：谁在何时对哪条数据做了什么，以及字段级的前后差异
+type AuditLog struct {
+	ID         int64     `json:"id,string" gorm:"primaryKey"`
+	OperatorID int64     `json:"operator_id,string" gorm:"index"` // 0 表示系统任务
+	Operator   string    `json:"operator" gorm:"index;size:128"`
+	IP         string    `json:"ip" gorm:"size:64"`
+	EntityType string    `json:"entity_type" gorm:"index:idx_audit_entity;size:64"`
+	EntityID   string    `json:"entity_id" gorm:"index:idx_audit_entity;size:128"`
+	Action     string    `json:"action" gorm:"size:16"`
+	Changes    JSONText  `json:"changes" gorm:"type:jsonb"` // {"字段": {"old": ..., "new": ...}}
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+func (AuditLog) TableName() string {
+	return "sys_audit_logs"
+}
+
+// JSONText 以文本存储的 JSON，输出时原样嵌入而非作为字符串
+type JSONText string
+
+func (j JSONText) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+func (j JSONText) Value() (driver.Value, error) {
+	if j == "" {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+func (j *JSONText) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*j = ""
+	case []byte:
+		*j = JSONText(v)
+	case string:
+		*j = JSONText(v)
+	}
+	return nil
+}
@@ -6,17 +6,48 @@ import (
 
 // AccessLog 记录每次请求的关键审计信息
 type AccessLog struct {
-	ID         int64     `json:"id,string" gorm:"primaryKey"`
-	Username   string    `json:"username" gorm:"index;size:128"`
-	Path       string    `json:"path" gorm:"index;size:512"`
-	Method     string    `json:"method" gorm:"size:16"`
-	IP         string    `json:"ip" gorm:"size:64"`
-	StatusCode int       `json:"status_code" gorm:"index"`
-	UserAgent  string    `json:"user_agent" gorm:"size:512"`
-	LatencyMs  int64     `json:"latency_ms"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID         int64  `json:"id,string" gorm:"primaryKey"`
+	RequestID  string `json:"request_id" gorm:"index;size:64"`
+	Username   string `json:"username" gorm:"index;size:128"`
+	Path       string `json:"path" gorm:"index;size:512"`
+	Method     string `json:"method" gorm:"size:16"`
+	IP         string `json:"ip" gorm:"size:64"`
+	StatusCode int    `json:"status_code" gorm:"index"`
+	UserAgent  string `json:"user_agent" gorm:"size:512"`
+	LatencyMs  int64  `json:"latency_ms"`
+	// 以下内容仅在开启采集的路由上按采样记录，敏感字段已脱敏
+	Query        string    `json:"query" gorm:"type:text"`
+	RequestBody  string    `json:"request_body" gorm:"type:text"`
+	ResponseBody string    `json:"response_body" gorm:"type:text"`
+	CreatedAt    time.Time `json:"created_at"`
+	// 哈希链：Hash 覆盖本条内容与 PrevHash，PrevHash 为按 ID 顺序上一条记录的 Hash
+	PrevHash string `json:"prev_hash" gorm:"size:64"`
+	Hash     string `json:"hash" gorm:"size:64"`
 }
 
 func (AccessLog) TableName() string {
 	return "sys_access_logs"
 }
+
+// 访问日志被合规删除的原因
+const (
+	AccessLogTombstoneDelete = "delete" // 管理员批量删除
+	AccessLogTombstonePurge  = "purge"  // 保留期限清理，只记录被清理的最后一条，作为剩余链条的起点
+)
+
+// AccessLogTombstone 被删除访问日志在哈希链中的位置，校验时代替原记录衔接前后两条
+type AccessLogTombstone struct {
+	LogID     int64     `json:"log_id,string" gorm:"primaryKey;autoIncrement:false"`
+	PrevHash  string    `json:"prev_hash" gorm:"size:64"`
+	Hash      string    `json:"hash" gorm:"size:64"`
+	Legacy    bool      `json:"legacy"` // 被删除记录的哈希是启用密钥前的旧算法
+	Reason    string    `json:"reason" gorm:"size:16;index"`
+	Operator  string    `json:"operator" gorm:"size:128"`
+	DeletedAt time.Time `json:"deleted_at"`
+	// Signature 以 access_log.chain_key 计算的 HMAC，启用密钥前留下的墓碑为空
+	Signature string `json:"signature" gorm:"size:64"`
+}
+
+func (AccessLogTombstone) TableName() string {
+	return "sys_access_log_tombstones"
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+)
+
+// 安全事件类型
+const (
+	LoginEventLogin          = "login"           // 登录（含两步验证、过期改密后登录）
+	LoginEventLogout         = "logout"          // 主动退出
+	LoginEventRefresh        = "refresh"         // 刷新令牌
+	LoginEventPasswordChange = "password_change" // 本人修改密码（含过期改密、邮件重置）
+	LoginEventPasswordReset  = "password_reset"  // 管理员重置密码
+)
+
+// 安全事件结果
+const (
+	LoginResultSuccess = "success"
+	LoginResultFailure = "failure"
+)
+
+// LoginLog 登录历史与账户安全事件
+type LoginLog struct {
+	ID        int64     `json:"id,string" gorm:"primaryKey"`
+	UserID    int64     `json:"user_id,string" gorm:"index"` // 用户名不存在时为 0
+	Username  string    `json:"username" gorm:"index;size:128"`
+	Event     string    `json:"event" gorm:"index;size:32"`
+	Result    string    `json:"result" gorm:"size:16"`
+	Reason    string    `json:"reason" gorm:"size:255"` // 失败原因或补充说明
+	IP        string    `json:"ip" gorm:"index;size:64"`
+	UserAgent string    `json:"user_agent" gorm:"size:512"`
+	SessionID string    `json:"session_id" gorm:"index;size:64"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+func (LoginLog) TableName() string {
+	return "sys_login_logs"
+}
+
+// 安全告警类型
+const (
+	SecurityAlertMultiIPLogin = "multi_ip_login" // 同一账户短时间内从多个 IP 登录
+)
+
+// SecurityAlert 需要管理员关注的账户安全告警
+type SecurityAlert struct {
+	ID             int64      `json:"id,string" gorm:"primaryKey"`
+	Type           string     `json:"type" gorm:"index;size:32"`
+	UserID         int64      `json:"user_id,string" gorm:"index"`
+	Username       string     `json:"username" gorm:"size:128"`
+	Detail         string     `json:"detail" gorm:"size:1024"`
+	IPs            JSONText   `json:"ips" gorm:"type:jsonb"`
+	Acknowledged   bool       `json:"acknowledged" gorm:"index"`
+	AcknowledgedBy string     `json:"acknowledged_by" gorm:"size:128"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"index"`
+}
+
+func (SecurityAlert) TableName() string {
+	return "sys_security_alerts"
+}
@@ -10,9 +10,13 @@ type Role struct {
 	ID          int64          `json:"id,string" gorm:"primaryKey"`
 	Name        string         `json:"name" gorm:"not null" binding:"required"`
 	Code        string         `json:"code" gorm:"uniqueIndex;not null" binding:"required"`
+	ParentID    *int64         `json:"parent_id,string" gorm:"index"` // 上级角色，继承其全部菜单权限
 	Description string         `json:"description"`
 	Status      string         `json:"status" gorm:"default:'1'"` // 1:正常 0:禁用
 	Sort        int            `json:"sort" gorm:"default:0"`
+	Require2FA  bool           `json:"require_2fa" gorm:"column:require_2fa;default:false"` // 持有该角色的用户必须启用两步验证
+	DataScope   string         `json:"data_scope" gorm:"size:16;default:'all'"`             // 数据权限：all | org | org_and_child | custom | self
+	MaxUsers    int            `json:"max_users" gorm:"default:0"`                          // 最多可授予的用户数，0 表示不限制
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
@@ -20,6 +24,8 @@ type Role struct {
 	// 关联关系
 	Users []User `json:"users" gorm:"many2many:sys_user_roles;"`
 	Menus []Menu `json:"menus" gorm:"many2many:sys_role_menus;"`
+	// 数据权限为 custom 时可访问的组织
+	DataScopeOrgs []Organization `json:"data_scope_orgs" gorm:"many2many:sys_role_data_scopes;"`
 }
 
 type RoleMenu struct {
@@ -36,3 +42,14 @@ func (Role) TableName() string {
 func (RoleMenu) TableName() string {
 	return "sys_role_menus"
 }
+
+// RoleDataScope 角色自定义数据权限的组织集合
+type RoleDataScope struct {
+	RoleID         int64 `json:"role_id,string" gorm:"primaryKey"`
+	OrganizationID int64 `json:"organization_id,string" gorm:"primaryKey"`
+}
+
+// TableName 指定表名
+func (RoleDataScope) TableName() string {
+	return "sys_role_data_scopes"
+}
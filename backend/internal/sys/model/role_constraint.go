@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RoleConstraint 职责分离约束：同一用户最多只能持有集合中的 MaxRoles 个角色（含继承的上级角色）
+type RoleConstraint struct {
+	ID          int64          `json:"id,string" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"not null" binding:"required"`
+	Description string         `json:"description"`
+	MaxRoles    int            `json:"max_roles" gorm:"not null;default:1"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// 互斥的角色集合
+	Roles []Role `json:"roles" gorm:"many2many:sys_role_constraint_roles;"`
+}
+
+// RoleConstraintRole 约束与角色的关联
+type RoleConstraintRole struct {
+	RoleConstraintID int64 `json:"role_constraint_id,string" gorm:"primaryKey"`
+	RoleID           int64 `json:"role_id,string" gorm:"primaryKey"`
+}
+
+// TableName 指定表名
+func (RoleConstraint) TableName() string {
+	return "sys_role_constraints"
+}
+
+// TableName 指定表名
+func (RoleConstraintRole) TableName() string {
+	return "sys_role_constraint_roles"
+}
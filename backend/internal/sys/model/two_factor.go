@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// UserRecoveryCode 两步验证恢复码，仅保存摘要，每个恢复码只能使用一次
+type UserRecoveryCode struct {
+	ID        int64      `json:"id,string" gorm:"primaryKey"`
+	UserID    int64      `json:"user_id,string" gorm:"index;not null"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (UserRecoveryCode) TableName() string {
+	return "sys_user_recovery_codes"
+}
@@ -7,21 +7,26 @@ import (
 )
 
 type User struct {
-	ID          int64          `json:"id,string" gorm:"primaryKey"`
-	Username    string         `json:"username" gorm:"uniqueIndex;not null" binding:"required"`
-	Password    string         `json:"-" gorm:"not null" binding:"required"`
-	Email       *string        `json:"email" gorm:"uniqueIndex"`
-	Phone       string         `json:"phone"`
-	RealName    string         `json:"real_name"`
-	Avatar      string         `json:"avatar"`
-	Status      string         `json:"status" gorm:"default:'1'"` // 1:正常 0:禁用
-	CreatedBy   int64          `json:"created_by,string" gorm:"index"`
-	UpdatedBy   int64          `json:"updated_by,string" gorm:"index"`
-	DeletedBy   *int64         `json:"deleted_by,string" gorm:"index"`
-	LastLoginAt *time.Time     `json:"last_login_at"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID          int64      `json:"id,string" gorm:"primaryKey"`
+	Username    string     `json:"username" gorm:"uniqueIndex;not null" binding:"required"`
+	Password    string     `json:"-" gorm:"not null" binding:"required"`
+	Email       *string    `json:"email" gorm:"uniqueIndex"`
+	Phone       string     `json:"phone"`
+	RealName    string     `json:"real_name"`
+	Avatar      string     `json:"avatar"`
+	Status      string     `json:"status" gorm:"default:'1'"` // 1:正常 0:禁用
+	CreatedBy   int64      `json:"created_by,string" gorm:"index"`
+	UpdatedBy   int64      `json:"updated_by,string" gorm:"index"`
+	DeletedBy   *int64     `json:"deleted_by,string" gorm:"index"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	// 最近一次修改密码的时间，用于密码有效期校验
+	PasswordChangedAt *time.Time `json:"password_changed_at"`
+	// 两步验证（TOTP）
+	TwoFactorEnabled bool           `json:"two_factor_enabled" gorm:"default:false"`
+	TwoFactorSecret  string         `json:"-" gorm:"size:64"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// 关联关系
 	Organizations []Organization `json:"organizations" gorm:"many2many:sys_user_organizations;"`
@@ -34,8 +39,10 @@ func (User) TableName() string {
 }
 
 type UserRole struct {
-	UserID int64 `json:"user_id,string" gorm:"primaryKey"`
-	RoleID int64 `json:"role_id,string" gorm:"primaryKey"`
+	UserID     int64      `json:"user_id,string" gorm:"primaryKey"`
+	RoleID     int64      `json:"role_id,string" gorm:"primaryKey"`
+	ValidFrom  *time.Time `json:"valid_from"`               // 生效时间，为空表示立即生效
+	ValidUntil *time.Time `json:"valid_until" gorm:"index"` // 失效时间，为空表示长期有效
 }
 
 // TableName 指定表名
@@ -52,3 +59,16 @@ type UserOrganization struct {
 func (UserOrganization) TableName() string {
 	return "sys_user_organizations"
 }
+
+// PasswordHistory 历史密码摘要，用于禁止重复使用最近的密码
+type PasswordHistory struct {
+	ID           int64     `json:"id,string" gorm:"primaryKey"`
+	UserID       int64     `json:"user_id,string" gorm:"index;not null"`
+	PasswordHash string    `json:"-" gorm:"not null"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (PasswordHistory) TableName() string {
+	return "sys_password_histories"
+}
@@ -0,0 +1,388 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strconv"
+	"time"
+
+	"siqian-admin/internal/sys/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// accessLogChainLock 写入访问日志时持有的事务级咨询锁，多个实例写入时保证链条按 ID 顺序衔接
+const accessLogChainLock = 0x5a4c4f47 // "ZLOG"
+
+// 哈希版本计入哈希内容；调整参与哈希的字段时应更换版本，并保留旧算法校验历史记录。
+// v1/v2 为不带密钥的 SHA-256（v2 增加请求 ID），只用于校验启用密钥前写入的历史记录；
+// v3 为以 access_log.chain_key 为密钥的 HMAC-SHA256，并覆盖记录 ID，能接触数据库但拿不到密钥的人无法重算
+const (
+	accessLogHashV1 = "v1"
+	accessLogHashV2 = "v2"
+	accessLogHashV3 = "v3"
+)
+
+// accessLogHash 计算记录内容、ID 与上一条哈希的 HMAC，字段逐个带长度前缀，避免拼接歧义
+func accessLogHash(key []byte, log *model.AccessLog) string {
+	h := hmac.New(sha256.New, key)
+	fields := append([]string{accessLogHashV3, strconv.FormatInt(log.ID, 10)}, accessLogContent(log)...)
+	writeHashFields(h, append(fields, log.RequestID))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// legacyAccessLogHash 启用密钥前的 v1/v2 哈希，没有请求 ID 的记录按 v1 计算
+func legacyAccessLogHash(log *model.AccessLog) string {
+	fields := append([]string{accessLogHashV1}, accessLogContent(log)...)
+	if log.RequestID != "" {
+		fields[0] = accessLogHashV2
+		fields = append(fields, log.RequestID)
+	}
+	h := sha256.New()
+	writeHashFields(h, fields)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// accessLogContent 参与哈希的记录内容（不含版本、ID 与请求 ID），顺序与 v1 保持一致
+func accessLogContent(log *model.AccessLog) []string {
+	return []string{
+		log.PrevHash,
+		log.Username,
+		log.Path,
+		log.Method,
+		log.IP,
+		strconv.Itoa(log.StatusCode),
+		log.UserAgent,
+		strconv.FormatInt(log.LatencyMs, 10),
+		log.Query,
+		log.RequestBody,
+		log.ResponseBody,
+		log.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// tombstoneSignature 墓碑的 HMAC，覆盖被删除记录的位置、哈希与删除原因，防止伪造墓碑跳过记录
+func tombstoneSignature(key []byte, t *model.AccessLogTombstone) string {
+	h := hmac.New(sha256.New, key)
+	writeHashFields(h, []string{
+		"tombstone",
+		strconv.FormatInt(t.LogID, 10),
+		t.PrevHash,
+		t.Hash,
+		t.Reason,
+		t.Operator,
+		t.DeletedAt.UTC().Format(time.RFC3339Nano),
+		strconv.FormatBool(t.Legacy),
+	})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeHashFields(h hash.Hash, fields []string) {
+	for _, field := range fields {
+		fmt.Fprintf(h, "%d:%s;", len(field), field)
+	}
+}
+
+// chainAccessLogs 在 tx 中加锁并读取链尾，从序列预取 ID 后依次为 logs 计算 PrevHash 与 Hash；
+// 调用方须在同一事务中按顺序插入
+func chainAccessLogs(tx *gorm.DB, key []byte, logs []model.AccessLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", accessLogChainLock).Error; err != nil {
+		return err
+	}
+	prev, err := lastAccessLogHash(tx)
+	if err != nil {
+		return err
+	}
+	// 哈希覆盖记录 ID，须在插入前确定；持锁期间取号，保证 ID 顺序与链条顺序一致
+	var ids []int64
+	if err := tx.Raw("SELECT nextval(pg_get_serial_sequence(?, 'id')) FROM generate_series(1, ?)",
+		model.AccessLog{}.TableName(), len(logs)).Scan(&ids).Error; err != nil {
+		return err
+	}
+	if len(ids) != len(logs) {
+		return fmt.Errorf("访问日志 ID 预取数量不符: %d/%d", len(ids), len(logs))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i := range logs {
+		logs[i].ID = ids[i]
+		// 数据库只保存到微秒，先截断，保证读回后哈希一致
+		logs[i].CreatedAt = logs[i].CreatedAt.Truncate(time.Microsecond)
+		logs[i].PrevHash = prev
+		logs[i].Hash = accessLogHash(key, &logs[i])
+		prev = logs[i].Hash
+	}
+	return nil
+}
+
+// lastAccessLogHash 链尾哈希：ID 最大的记录或墓碑（末尾记录可能已被删除或清理）
+func lastAccessLogHash(tx *gorm.DB) (string, error) {
+	var tail struct {
+		Hash string
+	}
+	err := tx.Raw(`SELECT hash FROM (
+			(SELECT id, hash FROM sys_access_logs ORDER BY id DESC LIMIT 1)
+			UNION ALL
+			(SELECT log_id AS id, hash FROM sys_access_log_tombstones ORDER BY log_id DESC LIMIT 1)
+		) t ORDER BY id DESC LIMIT 1`).Scan(&tail).Error
+	return tail.Hash, err
+}
+
+// recordTombstones 记录被删除的访问日志并签名，须与删除在同一事务中执行；logs 须包含完整内容，
+// 用于判断被删除记录是否为启用密钥前写入的旧记录
+func recordTombstones(tx *gorm.DB, key []byte, logs []model.AccessLog, reason, operator string) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	tombstones := make([]model.AccessLogTombstone, 0, len(logs))
+	for i := range logs {
+		tombstones = append(tombstones, newTombstone(key, &logs[i], reason, operator, now))
+	}
+	// 上次清理中途失败时锚点可能已存在，覆盖即可
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(tombstones, 500).Error
+}
+
+// newTombstone 生成已签名的墓碑
+func newTombstone(key []byte, log *model.AccessLog, reason, operator string, now time.Time) model.AccessLogTombstone {
+	t := model.AccessLogTombstone{
+		LogID:     log.ID,
+		PrevHash:  log.PrevHash,
+		Hash:      log.Hash,
+		Legacy:    log.Hash != accessLogHash(key, log),
+		Reason:    reason,
+		Operator:  operator,
+		DeletedAt: now.Truncate(time.Microsecond), // 与数据库精度一致，保证读回后签名一致
+	}
+	t.Signature = tombstoneSignature(key, &t)
+	return t
+}
+
+// AccessLogChainBreak 哈希链第一处断裂
+type AccessLogChainBreak struct {
+	LogID            int64  `json:"log_id,string"`
+	Tombstone        bool   `json:"tombstone"` // 断在已删除记录的墓碑上
+	Reason           string `json:"reason"`
+	ExpectedPrevHash string `json:"expected_prev_hash"`
+	PrevHash         string `json:"prev_hash"`
+	ExpectedHash     string `json:"expected_hash,omitempty"`
+	Hash             string `json:"hash"`
+}
+
+// AccessLogChainReport 哈希链校验结果
+type AccessLogChainReport struct {
+	Valid      bool                 `json:"valid"`
+	Checked    int64                `json:"checked"`    // 校验的记录数
+	Tombstones int64                `json:"tombstones"` // 经由墓碑衔接的已删除记录数
+	Legacy     int64                `json:"legacy"`     // 启用哈希链之前写入、未签名的历史记录
+	AnchorID   int64                `json:"anchor_id,string"`
+	LastID     int64                `json:"last_id,string"`
+	LastHash   string               `json:"last_hash"`
+	Broken     *AccessLogChainBreak `json:"broken"`
+}
+
+type AccessLogChainService struct {
+	db  *gorm.DB
+	key []byte
+}
+
+func NewAccessLogChainService(db *gorm.DB, chainKey string) *AccessLogChainService {
+	return &AccessLogChainService{db: db, key: []byte(chainKey)}
+}
+
+// WithContext 绑定请求 context，SQL 日志据此带上请求 ID
+func (s *AccessLogChainService) WithContext(ctx context.Context) *AccessLogChainService {
+	return &AccessLogChainService{db: s.db.WithContext(ctx), key: s.key}
+}
+
+// Verify 从最近一次清理留下的锚点开始按 ID 顺序遍历访问日志，重算每条记录的哈希并核对链接，
+// 报告第一处断裂：内容被修改、记录被直接删除或插入、墓碑或锚点被伪造都会导致断裂
+func (s *AccessLogChainService) Verify() (*AccessLogChainReport, error) {
+	var report *AccessLogChainReport
+	// 可重复读：墓碑与日志来自同一快照，避免校验期间的删除被误判为断裂
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		report, err = verifyAccessLogChain(tx, s.key)
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	return report, err
+}
+
+// chainNode 链上的一个节点：记录或墓碑
+type chainNode struct {
+	id           int64
+	prevHash     string
+	hash         string
+	expectedHash string
+	tombstone    bool
+	legacy       bool // 启用密钥前的旧算法哈希或未签名的墓碑
+	valid        bool // 哈希或签名校验通过
+}
+
+func rowNode(key []byte, log *model.AccessLog) chainNode {
+	n := chainNode{id: log.ID, prevHash: log.PrevHash, hash: log.Hash, expectedHash: accessLogHash(key, log)}
+	switch {
+	case hmac.Equal([]byte(n.hash), []byte(n.expectedHash)):
+		n.valid = true
+	case n.hash != "" && n.hash == legacyAccessLogHash(log):
+		n.valid, n.legacy = true, true
+	}
+	return n
+}
+
+func tombstoneNode(key []byte, t *model.AccessLogTombstone) chainNode {
+	n := chainNode{id: t.LogID, prevHash: t.PrevHash, hash: t.Hash, tombstone: true}
+	if t.Signature == "" {
+		n.valid, n.legacy = true, true
+		return n
+	}
+	n.valid = hmac.Equal([]byte(t.Signature), []byte(tombstoneSignature(key, t)))
+	n.legacy = t.Legacy
+	return n
+}
+
+func verifyAccessLogChain(db *gorm.DB, key []byte) (*AccessLogChainReport, error) {
+	var anchor model.AccessLogTombstone
+	err := db.Where("reason = ?", model.AccessLogTombstonePurge).Order("log_id DESC").Limit(1).Find(&anchor).Error
+	if err != nil {
+		return nil, err
+	}
+	v := newChainVerifier(key, &anchor)
+	report := v.report
+	if report.Broken != nil {
+		return report, nil
+	}
+	if anchor.LogID > 0 {
+		// 清理时锚点及之前的记录在同一事务中删除，仍有残留说明锚点是伪造的
+		var leftover model.AccessLog
+		if err := db.Select("id", "prev_hash", "hash").Where("id <= ?", anchor.LogID).Order("id ASC").Limit(1).Find(&leftover).Error; err != nil {
+			return nil, err
+		}
+		if leftover.ID > 0 {
+			report.Broken = &AccessLogChainBreak{LogID: leftover.ID, Reason: "清理锚点之前仍有未清理的记录，锚点可能是伪造的",
+				PrevHash: leftover.PrevHash, Hash: leftover.Hash}
+			return report, nil
+		}
+	}
+
+	var tombstones []model.AccessLogTombstone
+	if err := db.Where("reason = ? AND log_id > ?", model.AccessLogTombstoneDelete, report.AnchorID).
+		Order("log_id ASC").Find(&tombstones).Error; err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Model(&model.AccessLog{}).Where("id > ?", report.AnchorID).Order("id ASC").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	next := 0
+	for rows.Next() {
+		var log model.AccessLog
+		if err := db.ScanRows(rows, &log); err != nil {
+			return nil, err
+		}
+		for ; next < len(tombstones) && tombstones[next].LogID < log.ID; next++ {
+			if !v.check(tombstoneNode(key, &tombstones[next])) {
+				return report, nil
+			}
+		}
+		if !v.check(rowNode(key, &log)) {
+			return report, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for ; next < len(tombstones); next++ {
+		if !v.check(tombstoneNode(key, &tombstones[next])) {
+			return report, nil
+		}
+	}
+
+	report.Valid = true
+	return report, nil
+}
+
+// chainVerifier 按 ID 顺序逐个核对链上节点
+type chainVerifier struct {
+	report       *AccessLogChainReport
+	expectedPrev string
+	started      bool
+	// keyed 链上已出现密钥签名的节点，之后不再接受旧算法的记录与未签名的墓碑
+	keyed bool
+	// requireLegacy 锚点未签名（启用密钥前的清理）时，其后第一个节点也必须是旧记录，否则锚点可能是伪造的
+	requireLegacy bool
+}
+
+// newChainVerifier 从清理锚点开始校验，anchor 为空（LogID 为 0）表示从头校验；锚点签名无效时 report.Broken 非空
+func newChainVerifier(key []byte, anchor *model.AccessLogTombstone) *chainVerifier {
+	v := &chainVerifier{report: &AccessLogChainReport{}}
+	if anchor.LogID == 0 {
+		return v
+	}
+	v.report.AnchorID, v.expectedPrev, v.started = anchor.LogID, anchor.Hash, true
+	node := tombstoneNode(key, anchor)
+	if !node.valid {
+		v.report.Broken = &AccessLogChainBreak{LogID: anchor.LogID, Tombstone: true, Reason: "清理锚点签名无效，锚点可能是伪造的",
+			PrevHash: anchor.PrevHash, Hash: anchor.Hash}
+		return v
+	}
+	v.keyed, v.requireLegacy = !node.legacy, node.legacy
+	return v
+}
+
+// check 核对一个链上节点，返回 false 表示已断裂
+func (v *chainVerifier) check(n chainNode) bool {
+	report := v.report
+	if n.hash == "" && !v.started {
+		report.Legacy++
+		report.LastID, report.LastHash, v.expectedPrev = n.id, "", ""
+		return true
+	}
+	v.started = true
+	broken := &AccessLogChainBreak{
+		LogID:            n.id,
+		Tombstone:        n.tombstone,
+		ExpectedPrevHash: v.expectedPrev,
+		PrevHash:         n.prevHash,
+		ExpectedHash:     n.expectedHash,
+		Hash:             n.hash,
+	}
+	switch {
+	case n.hash == "":
+		broken.Reason = "哈希链中出现未签名的记录"
+	case n.prevHash != v.expectedPrev:
+		broken.Reason = "与上一条记录不衔接，上一条记录可能被删除或篡改"
+	case !n.valid && n.tombstone:
+		broken.Reason = "墓碑签名无效，墓碑可能是伪造的"
+	case !n.valid:
+		broken.Reason = "记录内容与哈希不一致，内容可能被篡改"
+	case n.legacy && v.keyed:
+		broken.Reason = "密钥签名的记录之后出现旧算法哈希或未签名的墓碑，记录可能被伪造"
+	case v.requireLegacy && !n.legacy:
+		broken.Reason = "清理锚点未签名，其后却是密钥签名的记录，锚点可能是伪造的"
+	default:
+		if n.tombstone {
+			report.Tombstones++
+		} else {
+			report.Checked++
+		}
+		v.keyed = v.keyed || !n.legacy
+		v.requireLegacy = false
+		report.LastID, report.LastHash, v.expectedPrev = n.id, n.hash, n.hash
+		return true
+	}
+	report.Broken = broken
+	return false
+}
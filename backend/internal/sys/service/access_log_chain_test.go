@@ -0,0 +1,196 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"siqian-admin/internal/sys/model"
+)
+
+var testChainKey = []byte("test-chain-key")
+
+// buildChain 生成 n 条首尾相接的记录，legacy 条使用启用密钥前的旧算法，其余使用密钥签名
+func buildChain(key []byte, prev string, firstID int64, legacy, n int) []model.AccessLog {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	logs := make([]model.AccessLog, n)
+	for i := range logs {
+		log := &logs[i]
+		log.ID = firstID + int64(i)
+		log.Username = "admin"
+		log.Path = "/api/v1/users"
+		log.Method = "POST"
+		log.IP = "10.0.0.1"
+		log.StatusCode = 200
+		log.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		log.PrevHash = prev
+		if i < legacy {
+			log.Hash = legacyAccessLogHash(log)
+		} else {
+			log.Hash = accessLogHash(key, log)
+		}
+		prev = log.Hash
+	}
+	return logs
+}
+
+func rowNodes(key []byte, logs []model.AccessLog) []chainNode {
+	nodes := make([]chainNode, 0, len(logs))
+	for i := range logs {
+		nodes = append(nodes, rowNode(key, &logs[i]))
+	}
+	return nodes
+}
+
+func TestAccessLogHash(t *testing.T) {
+	log := buildChain(testChainKey, "", 1, 0, 1)[0]
+	hash := accessLogHash(testChainKey, &log)
+
+	tests := []struct {
+		name   string
+		key    []byte
+		mutate func(*model.AccessLog)
+		same   bool
+	}{
+		{"相同内容", testChainKey, func(*model.AccessLog) {}, true},
+		{"不同密钥", []byte("other-key"), func(*model.AccessLog) {}, false},
+		{"修改 ID", testChainKey, func(l *model.AccessLog) { l.ID++ }, false},
+		{"修改内容", testChainKey, func(l *model.AccessLog) { l.StatusCode = 500 }, false},
+		{"修改上一条哈希", testChainKey, func(l *model.AccessLog) { l.PrevHash = "x" }, false},
+		{"修改请求 ID", testChainKey, func(l *model.AccessLog) { l.RequestID = "req-1" }, false},
+		{"字段边界移动", testChainKey, func(l *model.AccessLog) { l.Username, l.Path = "admin/api/v1", "/users" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := log
+			tt.mutate(&l)
+			if got := accessLogHash(tt.key, &l) == hash; got != tt.same {
+				t.Errorf("哈希相同 = %v，期望 %v", got, tt.same)
+			}
+		})
+	}
+
+	if legacy := legacyAccessLogHash(&log); legacy == hash {
+		t.Error("旧算法哈希不应与密钥哈希相同")
+	}
+}
+
+func TestChainVerifier(t *testing.T) {
+	now := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	keyed := buildChain(testChainKey, "", 1, 0, 4)
+	upgraded := buildChain(testChainKey, "", 1, 2, 4)
+
+	tests := []struct {
+		name   string
+		anchor model.AccessLogTombstone
+		nodes  func() []chainNode
+		broken string // 为空表示链条完整，否则为期望的断裂原因片段
+		at     int64
+	}{
+		{
+			name:  "完整的密钥链",
+			nodes: func() []chainNode { return rowNodes(testChainKey, keyed) },
+		},
+		{
+			name:  "启用密钥前后的记录衔接",
+			nodes: func() []chainNode { return rowNodes(testChainKey, upgraded) },
+		},
+		{
+			name: "内容被篡改",
+			nodes: func() []chainNode {
+				logs := append([]model.AccessLog(nil), keyed...)
+				logs[2].Path = "/api/v1/roles"
+				return rowNodes(testChainKey, logs)
+			},
+			broken: "内容可能被篡改", at: 3,
+		},
+		{
+			name: "密钥不一致",
+			nodes: func() []chainNode {
+				return rowNodes([]byte("other-key"), keyed)
+			},
+			broken: "内容可能被篡改", at: 1,
+		},
+		{
+			name: "记录被直接删除",
+			nodes: func() []chainNode {
+				return rowNodes(testChainKey, []model.AccessLog{keyed[0], keyed[2], keyed[3]})
+			},
+			broken: "不衔接", at: 3,
+		},
+		{
+			name: "删除后留有签名墓碑",
+			nodes: func() []chainNode {
+				t := newTombstone(testChainKey, &keyed[1], model.AccessLogTombstoneDelete, "admin", now)
+				return []chainNode{rowNode(testChainKey, &keyed[0]), tombstoneNode(testChainKey, &t), rowNode(testChainKey, &keyed[2])}
+			},
+		},
+		{
+			name: "伪造签名的墓碑",
+			nodes: func() []chainNode {
+				t := newTombstone([]byte("forged"), &keyed[1], model.AccessLogTombstoneDelete, "admin", now)
+				return []chainNode{rowNode(testChainKey, &keyed[0]), tombstoneNode(testChainKey, &t), rowNode(testChainKey, &keyed[2])}
+			},
+			broken: "墓碑签名无效", at: 2,
+		},
+		{
+			name: "密钥记录之后出现未签名的墓碑",
+			nodes: func() []chainNode {
+				t := model.AccessLogTombstone{LogID: 2, PrevHash: keyed[1].PrevHash, Hash: keyed[1].Hash, Reason: model.AccessLogTombstoneDelete}
+				return []chainNode{rowNode(testChainKey, &keyed[0]), tombstoneNode(testChainKey, &t), rowNode(testChainKey, &keyed[2])}
+			},
+			broken: "未签名的墓碑", at: 2,
+		},
+		{
+			name:   "签名的清理锚点",
+			anchor: newTombstone(testChainKey, &keyed[1], model.AccessLogTombstonePurge, "system", now),
+			nodes:  func() []chainNode { return rowNodes(testChainKey, keyed[2:]) },
+		},
+		{
+			name: "伪造的清理锚点",
+			anchor: func() model.AccessLogTombstone {
+				t := newTombstone(testChainKey, &keyed[1], model.AccessLogTombstonePurge, "system", now)
+				t.LogID = 3
+				return t
+			}(),
+			nodes:  func() []chainNode { return rowNodes(testChainKey, keyed[3:]) },
+			broken: "锚点签名无效", at: 3,
+		},
+		{
+			name:   "未签名锚点之后是密钥记录",
+			anchor: model.AccessLogTombstone{LogID: 2, PrevHash: keyed[1].PrevHash, Hash: keyed[1].Hash, Reason: model.AccessLogTombstonePurge},
+			nodes:  func() []chainNode { return rowNodes(testChainKey, keyed[2:]) },
+			broken: "锚点可能是伪造的", at: 3,
+		},
+		{
+			name:   "启用密钥前的清理锚点",
+			anchor: model.AccessLogTombstone{LogID: 1, PrevHash: upgraded[0].PrevHash, Hash: upgraded[0].Hash, Reason: model.AccessLogTombstonePurge},
+			nodes:  func() []chainNode { return rowNodes(testChainKey, upgraded[1:]) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newChainVerifier(testChainKey, &tt.anchor)
+			if v.report.Broken == nil {
+				for _, n := range tt.nodes() {
+					if !v.check(n) {
+						break
+					}
+				}
+			}
+			broken := v.report.Broken
+			if tt.broken == "" {
+				if broken != nil {
+					t.Fatalf("期望链条完整，实际断裂于 %d：%s", broken.LogID, broken.Reason)
+				}
+				return
+			}
+			if broken == nil {
+				t.Fatalf("期望断裂（%s），实际链条完整", tt.broken)
+			}
+			if broken.LogID != tt.at || !strings.Contains(broken.Reason, tt.broken) {
+				t.Errorf("断裂于 %d：%s，期望 %d：%s", broken.LogID, broken.Reason, tt.at, tt.broken)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/database"
+	"siqian-admin/internal/sys/model"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccessLogRetentionPolicy 访问日志保留策略
+type AccessLogRetentionPolicy struct {
+	RetentionDays        int    `json:"retention_days"` // 0 表示永久保留
+	PurgeIntervalMinutes int    `json:"purge_interval_minutes"`
+	Archive              bool   `json:"archive"`
+	ArchiveDir           string `json:"archive_dir"`
+	PartitionMonthsAhead int    `json:"partition_months_ahead"`
+	DeleteFloorDays      int    `json:"delete_floor_days"` // 保护期，清理与手动删除都不会触及更新的日志
+}
+
+// AccessLogRetentionStatus 保留策略与当前分区情况
+type AccessLogRetentionStatus struct {
+	Policy      AccessLogRetentionPolicy      `json:"policy"`
+	Partitioned bool                          `json:"partitioned"`
+	Cutoff      *time.Time                    `json:"cutoff"` // 早于此时间的日志会被清理
+	Partitions  []database.AccessLogPartition `json:"partitions"`
+}
+
+// AccessLogPurgeResult 一次清理的结果
+type AccessLogPurgeResult struct {
+	Cutoff            time.Time `json:"cutoff"`
+	DroppedPartitions []string  `json:"dropped_partitions"` // 整月过期、直接删除的分区
+	DeletedRows       int64     `json:"deleted_rows"`       // 按行删除的记录数（跨越截止时间的分区）
+	ArchiveFiles      []string  `json:"archive_files"`
+}
+
+// AccessLogRetentionService 按保留天数清理访问日志：整月过期的分区直接删除，其余按行删除，删除前可归档。
+// 清理按 ID 前缀进行，并记录清理锚点，剩余日志的哈希链仍可校验。
+type AccessLogRetentionService struct {
+	db       *gorm.DB
+	policy   AccessLogRetentionPolicy
+	chainKey []byte     // 为清理锚点签名
+	mu       sync.Mutex // 定时清理与手动清理互斥
+}
+
+func NewAccessLogRetentionService(db *gorm.DB, cfg config.AccessLogConfig) *AccessLogRetentionService {
+	policy := AccessLogRetentionPolicy{
+		RetentionDays:        cfg.RetentionDays,
+		PurgeIntervalMinutes: cfg.PurgeIntervalMinutes,
+		Archive:              cfg.Archive,
+		ArchiveDir:           cfg.ArchiveDir,
+		PartitionMonthsAhead: cfg.PartitionMonthsAhead,
+		DeleteFloorDays:      cfg.DeleteFloorDays,
+	}
+	if policy.PurgeIntervalMinutes <= 0 {
+		policy.PurgeIntervalMinutes = 60
+	}
+	if policy.ArchiveDir == "" {
+		policy.ArchiveDir = "archives/access_logs/"
+	}
+	return &AccessLogRetentionService{db: db, policy: policy, chainKey: []byte(cfg.ChainKey)}
+}
+
+// Run 定期补齐后续月份的分区并清理过期日志，阻塞运行直到 ctx 取消
+func (s *AccessLogRetentionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.policy.PurgeIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := s.Purge(time.Now())
+			if err != nil {
+				slog.Error("清理过期访问日志失败", "err", err)
+				continue
+			}
+			if result != nil && (len(result.DroppedPartitions) > 0 || result.DeletedRows > 0) {
+				slog.Info("已清理过期访问日志", "partitions", result.DroppedPartitions, "rows", result.DeletedRows)
+			}
+		}
+	}
+}
+
+// Status 当前保留策略与分区列表
+func (s *AccessLogRetentionService) Status(now time.Time) (*AccessLogRetentionStatus, error) {
+	partitioned, err := database.IsAccessLogPartitioned(s.db)
+	if err != nil {
+		return nil, err
+	}
+	status := &AccessLogRetentionStatus{Policy: s.policy, Partitioned: partitioned, Partitions: []database.AccessLogPartition{}}
+	if s.policy.RetentionDays > 0 {
+		cutoff := s.cutoff(now)
+		status.Cutoff = &cutoff
+	}
+	if partitioned {
+		if status.Partitions, err = database.ListAccessLogPartitions(s.db); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Purge 清理早于保留期限的访问日志；未配置保留天数时只补齐分区，返回 nil 结果
+func (s *AccessLogRetentionService) Purge(now time.Time) (*AccessLogPurgeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	partitioned, err := database.IsAccessLogPartitioned(s.db)
+	if err != nil {
+		return nil, err
+	}
+	if partitioned {
+		if err := database.EnsureAccessLogPartitions(s.db, now, s.policy.PartitionMonthsAhead); err != nil {
+			return nil, err
+		}
+	}
+	if s.policy.RetentionDays <= 0 {
+		return nil, nil
+	}
+
+	result := &AccessLogPurgeResult{Cutoff: s.cutoff(now), DroppedPartitions: []string{}, ArchiveFiles: []string{}}
+
+	// 按 ID 前缀清理，保证剩余记录仍是一条连续的哈希链：
+	// boundary 为截止时间之后第一条记录的 ID，只清理 ID 小于它的记录
+	var boundary struct{ ID *int64 }
+	if err := s.db.Model(&model.AccessLog{}).Select("MIN(id) AS id").
+		Where("created_at >= ?", result.Cutoff).Scan(&boundary).Error; err != nil {
+		return nil, err
+	}
+	var anchor model.AccessLog
+	q := s.db.Order("id DESC").Limit(1)
+	if boundary.ID != nil {
+		q = q.Where("id < ?", *boundary.ID)
+	}
+	if err := q.Find(&anchor).Error; err != nil {
+		return nil, err
+	}
+	if anchor.ID == 0 {
+		return result, nil
+	}
+
+	// 整月过期的分区直接删除；分区内有边界之后写入的记录（写入时间早于截止时间但 ID 更大）时停止，改为按行删除
+	var dropped []database.AccessLogPartition
+	if partitioned {
+		partitions, err := database.ListAccessLogPartitions(s.db)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range partitions {
+			if p.To.After(result.Cutoff) {
+				break
+			}
+			var maxID struct{ ID *int64 }
+			if err := s.db.Table(p.Name).Select("MAX(id) AS id").Scan(&maxID).Error; err != nil {
+				return nil, err
+			}
+			if maxID.ID != nil && *maxID.ID > anchor.ID {
+				break
+			}
+			dropped = append(dropped, p)
+		}
+	}
+
+	// 剩余的待清理记录（截止时间所在的分区、兜底分区或未分区的表）按行删除
+	// boundary 之前的记录都早于截止时间，附带时间条件以便只扫描相关分区
+	expired := func(db *gorm.DB) *gorm.DB {
+		return db.Where("id <= ? AND created_at < ?", anchor.ID, result.Cutoff)
+	}
+
+	// 先归档，再在同一事务中删除分区与记录并写入清理锚点：
+	// 锚点及之前的记录要么全部删除，要么都未删除，校验时锚点之前残留记录即视为锚点伪造
+	if s.policy.Archive {
+		for _, p := range dropped {
+			file, err := s.archive(p.Name, p.Name, nil)
+			if err != nil {
+				return nil, err
+			}
+			if file != "" {
+				result.ArchiveFiles = append(result.ArchiveFiles, file)
+			}
+		}
+		// 已按分区归档的记录不再重复归档
+		rest := expired
+		if len(dropped) > 0 {
+			names := make([]string, 0, len(dropped))
+			for _, p := range dropped {
+				names = append(names, p.Name)
+			}
+			rest = func(db *gorm.DB) *gorm.DB {
+				return expired(db).Where("tableoid::regclass::text NOT IN ?", names)
+			}
+		}
+		name := fmt.Sprintf("%s_before_%s", database.AccessLogTable, result.Cutoff.UTC().Format("20060102T150405Z"))
+		file, err := s.archive(database.AccessLogTable, name, rest)
+		if err != nil {
+			return nil, err
+		}
+		if file != "" {
+			result.ArchiveFiles = append(result.ArchiveFiles, file)
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, p := range dropped {
+			if err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", p.Name)).Error; err != nil {
+				return fmt.Errorf("删除分区 %s 失败: %w", p.Name, err)
+			}
+			result.DroppedPartitions = append(result.DroppedPartitions, p.Name)
+		}
+		res := tx.Scopes(expired).Delete(&model.AccessLog{})
+		if res.Error != nil {
+			return res.Error
+		}
+		result.DeletedRows = res.RowsAffected
+
+		// 清理的最后一条作为剩余链条的起点
+		if err := recordTombstones(tx, s.chainKey, []model.AccessLog{anchor}, model.AccessLogTombstonePurge, "system"); err != nil {
+			return err
+		}
+		return tx.Where("log_id < ?", anchor.ID).Delete(&model.AccessLogTombstone{}).Error
+	})
+	if err != nil {
+		result.DroppedPartitions, result.DeletedRows = []string{}, 0
+		return result, err
+	}
+	return result, nil
+}
+
+// cutoff 清理截止时间，保留天数不会短于删除保护期
+func (s *AccessLogRetentionService) cutoff(now time.Time) time.Time {
+	days := s.policy.RetentionDays
+	if days < s.policy.DeleteFloorDays {
+		days = s.policy.DeleteFloorDays
+	}
+	return now.AddDate(0, 0, -days)
+}
+
+// archive 将表中（可选过滤后）的记录写入 <name>.ndjson.gz，没有记录时不生成文件。
+// 先写临时文件再改名，写入失败不会留下不完整的归档。
+func (s *AccessLogRetentionService) archive(table, name string, filter func(*gorm.DB) *gorm.DB) (string, error) {
+	query := func() *gorm.DB {
+		q := s.db.Table(table)
+		if filter != nil {
+			q = q.Scopes(filter)
+		}
+		return q
+	}
+	var count int64
+	if err := query().Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(s.policy.ArchiveDir, 0755); err != nil {
+		return "", fmt.Errorf("创建归档目录失败: %w", err)
+	}
+	path := filepath.Join(s.policy.ArchiveDir, name+".ndjson.gz")
+	tmp := path + ".tmp"
+	if err := writeAccessLogArchive(query(), tmp); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("归档访问日志失败: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("归档访问日志失败: %w", err)
+	}
+	return path, nil
+}
+
+func writeAccessLogArchive(q *gorm.DB, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	enc := json.NewEncoder(zw)
+	var batch []model.AccessLog
+	err = q.FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := enc.Encode(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"time"
+
+	"siqian-admin/internal/sys/model"
+
+	"gorm.io/gorm"
+)
+
+type AccessLogStatsParams struct {
+	StartTime time.Time
+	EndTime   time.Time
+	Top       int        // 热门路径、活跃用户的条数
+	Scope     *DataScope // 数据权限范围，nil 表示不限制
+}
+
+// AccessLogStats 一段时间内访问日志的汇总统计，状态码 >= 400 视为错误
+type AccessLogStats struct {
+	StartTime   time.Time         `json:"start_time"`
+	EndTime     time.Time         `json:"end_time"`
+	Total       int64             `json:"total"`
+	Errors      int64             `json:"errors"`
+	ErrorRate   float64           `json:"error_rate"`
+	Latency     LatencyStats      `json:"latency"`
+	Daily       []DailyAccessStat `json:"daily"`
+	TopPaths    []PathAccessStat  `json:"top_paths"`
+	TopUsers    []UserAccessStat  `json:"top_users"`
+	StatusCodes []StatusCodeStat  `json:"status_codes"`
+}
+
+// LatencyStats 请求耗时分布（毫秒）
+type LatencyStats struct {
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max int64   `json:"max"`
+}
+
+type DailyAccessStat struct {
+	Date     string `json:"date"` // YYYY-MM-DD，按数据库会话时区
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"`
+}
+
+type PathAccessStat struct {
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	AvgMs     float64 `json:"avg_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+type UserAccessStat struct {
+	Username string `json:"username"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"`
+}
+
+type StatusCodeStat struct {
+	StatusCode int     `json:"status_code"`
+	Requests   int64   `json:"requests"`
+	Rate       float64 `json:"rate"` // 占全部请求的比例
+}
+
+// Stats 统计时间范围内的请求量、错误率与耗时分位数，按月分区时只扫描范围内的分区
+func (s *AccessLogService) Stats(params AccessLogStatsParams) (*AccessLogStats, error) {
+	if params.Top <= 0 || params.Top > 100 {
+		params.Top = 10
+	}
+	q := func() *gorm.DB {
+		return s.db.Model(&model.AccessLog{}).
+			Scopes(AccessLogScope(params.Scope)).
+			Where("created_at >= ? AND created_at < ?", params.StartTime, params.EndTime)
+	}
+	const errorCount = "COUNT(*) FILTER (WHERE status_code >= 400)"
+
+	stats := &AccessLogStats{StartTime: params.StartTime, EndTime: params.EndTime}
+
+	var summary struct {
+		Total  int64
+		Errors int64
+		Avg    float64
+		P50    float64
+		P95    float64
+		P99    float64
+		Max    int64
+	}
+	err := q().Select(`COUNT(*) AS total, ` + errorCount + ` AS errors,
+		COALESCE(AVG(latency_ms), 0) AS avg,
+		COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY latency_ms), 0) AS p50,
+		COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY latency_ms), 0) AS p95,
+		COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY latency_ms), 0) AS p99,
+		COALESCE(MAX(latency_ms), 0) AS max`).
+		Scan(&summary).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.Total, stats.Errors = summary.Total, summary.Errors
+	stats.ErrorRate = ratio(summary.Errors, summary.Total)
+	stats.Latency = LatencyStats{Avg: summary.Avg, P50: summary.P50, P95: summary.P95, P99: summary.P99, Max: summary.Max}
+
+	stats.Daily = []DailyAccessStat{}
+	if err := q().Select(`to_char(created_at, 'YYYY-MM-DD') AS date, COUNT(*) AS requests, ` + errorCount + ` AS errors`).
+		Group("date").Order("date ASC").
+		Scan(&stats.Daily).Error; err != nil {
+		return nil, err
+	}
+
+	stats.TopPaths = []PathAccessStat{}
+	if err := q().Select(`method, path, COUNT(*) AS requests, ` + errorCount + ` AS errors,
+		AVG(latency_ms) AS avg_ms, percentile_cont(0.95) WITHIN GROUP (ORDER BY latency_ms) AS p95_ms`).
+		Group("method, path").Order("requests DESC, path ASC").Limit(params.Top).
+		Scan(&stats.TopPaths).Error; err != nil {
+		return nil, err
+	}
+	for i := range stats.TopPaths {
+		stats.TopPaths[i].ErrorRate = ratio(stats.TopPaths[i].Errors, stats.TopPaths[i].Requests)
+	}
+
+	stats.TopUsers = []UserAccessStat{}
+	if err := q().Select(`username, COUNT(*) AS requests, ` + errorCount + ` AS errors`).
+		Where("username <> ''").
+		Group("username").Order("requests DESC, username ASC").Limit(params.Top).
+		Scan(&stats.TopUsers).Error; err != nil {
+		return nil, err
+	}
+
+	stats.StatusCodes = []StatusCodeStat{}
+	if err := q().Select(`status_code, COUNT(*) AS requests`).
+		Group("status_code").Order("status_code ASC").
+		Scan(&stats.StatusCodes).Error; err != nil {
+		return nil, err
+	}
+	for i := range stats.StatusCodes {
+		stats.StatusCodes[i].Rate = ratio(stats.StatusCodes[i].Requests, stats.Total)
+	}
+
+	return stats, nil
+}
+
+func ratio(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/sys/model"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 队列满时的处理策略
+const (
+	OverflowDropNewest = "drop_newest" // 丢弃新日志（默认），不影响请求延迟
+	OverflowDropOldest = "drop_oldest" // 丢弃队列中最早的日志，为新日志腾出位置
+	OverflowBlock      = "block"       // 阻塞请求最多 block_timeout_ms，仍无空位则丢弃
+)
+
+// AccessLogQueueStats 访问日志写入队列的运行状态
+type AccessLogQueueStats struct {
+	Capacity int    `json:"capacity"`
+	Length   int    `json:"length"`
+	Policy   string `json:"policy"`
+	Enqueued int64  `json:"enqueued"` // 成功入队
+	Written  int64  `json:"written"`  // 已写入数据库
+	Dropped  int64  `json:"dropped"`  // 因队列满或已关闭被丢弃
+	Failed   int64  `json:"failed"`   // 写入数据库失败
+	Batches  int64  `json:"batches"`  // 批量写入次数
+}
+
+// AccessLogWriter 有界内存队列 + 后台批量写入，避免每个请求一次 INSERT
+type AccessLogWriter struct {
+	db           *gorm.DB
+	chainKey     []byte
+	queue        chan model.AccessLog
+	batchSize    int
+	interval     time.Duration
+	policy       string
+	blockTimeout time.Duration
+
+	mu      sync.RWMutex // 保护 closed，关闭后不再接受新日志
+	closed  bool
+	done    chan struct{}
+	stopped chan struct{}
+
+	enqueued atomic.Int64
+	written  atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+	batches  atomic.Int64
+}
+
+func NewAccessLogWriter(db *gorm.DB, cfg config.AccessLogConfig) *AccessLogWriter {
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 10000
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 200
+	}
+	interval := time.Duration(cfg.FlushIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+	policy := cfg.OverflowPolicy
+	if policy != OverflowDropOldest && policy != OverflowBlock {
+		policy = OverflowDropNewest
+	}
+	return &AccessLogWriter{
+		db:           db,
+		chainKey:     []byte(cfg.ChainKey),
+		queue:        make(chan model.AccessLog, queueSize),
+		batchSize:    batchSize,
+		interval:     interval,
+		policy:       policy,
+		blockTimeout: time.Duration(cfg.BlockTimeoutMs) * time.Millisecond,
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+}
+
+// Enqueue 提交一条访问日志，返回是否入队成功
+func (w *AccessLogWriter) Enqueue(log model.AccessLog) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		w.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case w.queue <- log:
+		w.enqueued.Add(1)
+		return true
+	default:
+	}
+
+	switch w.policy {
+	case OverflowDropOldest:
+		select {
+		case <-w.queue:
+			w.dropped.Add(1)
+		default:
+		}
+		select {
+		case w.queue <- log:
+			w.enqueued.Add(1)
+			return true
+		default:
+		}
+	case OverflowBlock:
+		timer := time.NewTimer(w.blockTimeout)
+		defer timer.Stop()
+		select {
+		case w.queue <- log:
+			w.enqueued.Add(1)
+			return true
+		case <-timer.C:
+		}
+	}
+	w.dropped.Add(1)
+	return false
+}
+
+// Run 后台写入循环，攒够 batch_size 条或到达 flush_interval_ms 时写入；Close 后写完剩余日志再退出
+func (w *AccessLogWriter) Run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]model.AccessLog, 0, w.batchSize)
+	for {
+		select {
+		case log := <-w.queue:
+			batch = append(batch, log)
+			if len(batch) >= w.batchSize {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		case <-w.done:
+			for {
+				select {
+				case log := <-w.queue:
+					batch = append(batch, log)
+					if len(batch) >= w.batchSize {
+						batch = w.flush(batch)
+					}
+				default:
+					w.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close 停止接收新日志并等待队列写完，ctx 到期时放弃等待
+func (w *AccessLogWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+	w.mu.Unlock()
+
+	select {
+	case <-w.stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("访问日志未写完，剩余 %d 条: %w", len(w.queue), ctx.Err())
+	}
+}
+
+// Stats 队列状态与累计计数
+func (w *AccessLogWriter) Stats() AccessLogQueueStats {
+	return AccessLogQueueStats{
+		Capacity: cap(w.queue),
+		Length:   len(w.queue),
+		Policy:   w.policy,
+		Enqueued: w.enqueued.Load(),
+		Written:  w.written.Load(),
+		Dropped:  w.dropped.Load(),
+		Failed:   w.failed.Load(),
+		Batches:  w.batches.Load(),
+	}
+}
+
+func (w *AccessLogWriter) flush(batch []model.AccessLog) []model.AccessLog {
+	if len(batch) == 0 {
+		return batch
+	}
+	w.batches.Add(1)
+	err := w.db.Transaction(func(tx *gorm.DB) error {
+		if err := chainAccessLogs(tx, w.chainKey, batch); err != nil {
+			return err
+		}
+		return tx.CreateInBatches(batch, w.batchSize).Error
+	})
+	if err != nil {
+		w.failed.Add(int64(len(batch)))
+		slog.Error("访问日志批量写入失败", "count", len(batch), "err", err)
+	} else {
+		w.written.Add(int64(len(batch)))
+	}
+	return batch[:0]
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"siqian-admin/internal/sys/model"
+
+	"gorm.io/gorm"
+)
+
+type AuditLogService struct {
+	db *gorm.DB
+}
+
+func NewAuditLogService(db *gorm.DB) *AuditLogService {
+	return &AuditLogService{db: db}
+}
+
+// WithContext 绑定请求 context，SQL 日志据此带上请求 ID
+func (s *AuditLogService) WithContext(ctx context.Context) *AuditLogService {
+	return &AuditLogService{db: s.db.WithContext(ctx)}
+}
+
+type ListAuditLogsParams struct {
+	EntityType string
+	EntityID   string
+	OperatorID int64
+	Operator   string
+	Action     string
+	StartTime  *time.Time
+	EndTime    *time.Time
+	Page       int
+	PageSize   int
+}
+
+type PagedAuditLogs struct {
+	Total int64            `json:"total"`
+	Items []model.AuditLog `json:"items"`
+}
+
+func (s *AuditLogService) List(params ListAuditLogsParams) (PagedAuditLogs, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 || params.PageSize > 200 {
+		params.PageSize = 10
+	}
+
+	q := s.db.Model(&model.AuditLog{})
+	if params.EntityType != "" {
+		q = q.Where("entity_type = ?", params.EntityType)
+	}
+	if params.EntityID != "" {
+		q = q.Where("entity_id = ?", params.EntityID)
+	}
+	if params.OperatorID != 0 {
+		q = q.Where("operator_id = ?", params.OperatorID)
+	}
+	if params.Operator != "" {
+		q = q.Where("operator ILIKE ?", "%"+params.Operator+"%")
+	}
+	if params.Action != "" {
+		q = q.Where("action = ?", params.Action)
+	}
+	if params.StartTime != nil {
+		q = q.Where("created_at >= ?", *params.StartTime)
+	}
+	if params.EndTime != nil {
+		q = q.Where("created_at <= ?", *params.EndTime)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return PagedAuditLogs{}, err
+	}
+
+	var items []model.AuditLog
+	if err := q.Order("created_at DESC, id DESC").Offset((params.Page - 1) * params.PageSize).Limit(params.PageSize).Find(&items).Error; err != nil {
+		return PagedAuditLogs{}, err
+	}
+
+	return PagedAuditLogs{Total: total, Items: items}, nil
+}
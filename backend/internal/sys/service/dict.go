@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"siqian-admin/internal/sys/model"
 
 	"gorm.io/gorm"
@@ -14,6 +15,11 @@ func NewDictService(db *gorm.DB) *DictService {
 	return &DictService{db: db}
 }
 
+// WithContext 绑定请求 context，写操作的审计日志据此记录操作人
+func (s *DictService) WithContext(ctx context.Context) *DictService {
+	return &DictService{db: s.db.WithContext(ctx)}
+}
+
 func (s *DictService) CreateDict(dict *model.Dict) error {
 	return s.db.Create(dict).Error
 }
@@ -1,28 +1,53 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"time"
 
+	"siqian-admin/internal/audit"
 	"siqian-admin/internal/sys/model"
 
 	"gorm.io/gorm"
 )
 
+// ErrAccessLogProtected 要删除的日志尚未超过保护期
+var ErrAccessLogProtected = errors.New("访问日志未超过保护期，不允许删除")
+
 type AccessLogService struct {
-	db *gorm.DB
+	db              *gorm.DB
+	writer          *AccessLogWriter
+	deleteFloorDays int    // 保护期：写入未满该天数的日志不允许删除，0 表示不限制
+	chainKey        []byte // 删除时为墓碑签名
+}
+
+func NewAccessLogService(db *gorm.DB, writer *AccessLogWriter, deleteFloorDays int, chainKey string) *AccessLogService {
+	return &AccessLogService{db: db, writer: writer, deleteFloorDays: deleteFloorDays, chainKey: []byte(chainKey)}
+}
+
+// WithContext 返回绑定 ctx 的服务，删除记录的操作人取自 ctx
+func (s *AccessLogService) WithContext(ctx context.Context) *AccessLogService {
+	return &AccessLogService{db: s.db.WithContext(ctx), writer: s.writer, deleteFloorDays: s.deleteFloorDays, chainKey: s.chainKey}
 }
 
-func NewAccessLogService(db *gorm.DB) *AccessLogService {
-	return &AccessLogService{db: db}
+// QueueStats 访问日志写入队列的状态
+func (s *AccessLogService) QueueStats() AccessLogQueueStats {
+	if s.writer == nil {
+		return AccessLogQueueStats{}
+	}
+	return s.writer.Stats()
 }
 
 type ListAccessLogsParams struct {
+	RequestID string
 	Username  string
 	Path      string
 	StartTime *time.Time
 	EndTime   *time.Time
 	Page      int
 	PageSize  int
+	Scope     *DataScope // 数据权限范围，nil 表示不限制
 }
 
 type PagedAccessLogs struct {
@@ -38,8 +63,28 @@ func (s *AccessLogService) List(params ListAccessLogsParams) (PagedAccessLogs, e
 		params.PageSize = 10
 	}
 
-	q := s.db.Model(&model.AccessLog{})
+	q := s.filter(params)
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return PagedAccessLogs{}, err
+	}
+
+	var items []model.AccessLog
+	if err := q.Order("created_at DESC").Offset((params.Page - 1) * params.PageSize).Limit(params.PageSize).Find(&items).Error; err != nil {
+		return PagedAccessLogs{}, err
+	}
+
+	return PagedAccessLogs{Total: total, Items: items}, nil
+}
+
+// filter 按查询条件与数据权限过滤，List、Export 共用
+func (s *AccessLogService) filter(params ListAccessLogsParams) *gorm.DB {
+	q := s.db.Model(&model.AccessLog{}).Scopes(AccessLogScope(params.Scope))
 
+	if params.RequestID != "" {
+		q = q.Where("request_id = ?", params.RequestID)
+	}
 	if params.Username != "" {
 		q = q.Where("username ILIKE ?", "%"+params.Username+"%")
 	}
@@ -52,23 +97,65 @@ func (s *AccessLogService) List(params ListAccessLogsParams) (PagedAccessLogs, e
 	if params.EndTime != nil {
 		q = q.Where("created_at <= ?", *params.EndTime)
 	}
+	return q
+}
 
-	var total int64
-	if err := q.Count(&total).Error; err != nil {
-		return PagedAccessLogs{}, err
+// Export 按 List 相同的条件逐行读取全部日志（忽略分页），通过游标流式交给 fn，不会一次性载入内存
+func (s *AccessLogService) Export(params ListAccessLogsParams, fn func(model.AccessLog) error) error {
+	rows, err := s.filter(params).Order("created_at DESC").Rows()
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
 
-	var items []model.AccessLog
-	if err := q.Order("created_at DESC").Offset((params.Page - 1) * params.PageSize).Limit(params.PageSize).Find(&items).Error; err != nil {
-		return PagedAccessLogs{}, err
+	for rows.Next() {
+		var log model.AccessLog
+		if err := s.db.ScanRows(rows, &log); err != nil {
+			return err
+		}
+		if err := fn(log); err != nil {
+			return err
+		}
 	}
-
-	return PagedAccessLogs{Total: total, Items: items}, nil
+	return rows.Err()
 }
 
-func (s *AccessLogService) BatchDelete(ids []int64) error {
+// BatchDelete 批量删除日志，只删除数据权限范围内的记录；任一记录仍在保护期内则全部不删除。
+// 被删除记录的哈希以墓碑保留，哈希链校验时用于衔接前后记录。
+func (s *AccessLogService) BatchDelete(ids []int64, scope *DataScope) error {
 	if len(ids) == 0 {
 		return nil
 	}
-	return s.db.Where("id IN ?", ids).Delete(&model.AccessLog{}).Error
+	operator := audit.OperatorFrom(s.db.Statement.Context).Username
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var logs []model.AccessLog
+		if err := tx.Scopes(AccessLogScope(scope)).Where("id IN ?", ids).Find(&logs).Error; err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+
+		if s.deleteFloorDays > 0 {
+			floor := time.Now().AddDate(0, 0, -s.deleteFloorDays)
+			protected := 0
+			for _, log := range logs {
+				if log.CreatedAt.After(floor) {
+					protected++
+				}
+			}
+			if protected > 0 {
+				return fmt.Errorf("%w：%d 条记录写入未满 %d 天", ErrAccessLogProtected, protected, s.deleteFloorDays)
+			}
+		}
+
+		if err := recordTombstones(tx, s.chainKey, logs, model.AccessLogTombstoneDelete, operator); err != nil {
+			return err
+		}
+		found := make([]int64, 0, len(logs))
+		for _, log := range logs {
+			found = append(found, log.ID)
+		}
+		return tx.Where("id IN ?", found).Delete(&model.AccessLog{}).Error
+	})
 }
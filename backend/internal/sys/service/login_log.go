@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/mail"
+	"siqian-admin/internal/sys/model"
+	"siqian-admin/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// alertMailTimeout 后台发送安全告警邮件的超时
+const alertMailTimeout = 30 * time.Second
+
+// ErrSecurityAlertNotFound 告警不存在或已确认
+var ErrSecurityAlertNotFound = errors.New("告警不存在或已确认")
+
+type LoginLogService struct {
+	db     *gorm.DB
+	mailer mail.Mailer
+	cfg    config.LoginLogConfig
+}
+
+func NewLoginLogService(db *gorm.DB, mailer mail.Mailer, cfg config.LoginLogConfig) *LoginLogService {
+	return &LoginLogService{db: db, mailer: mailer, cfg: cfg}
+}
+
+// WithContext 绑定请求 context，SQL 日志据此带上请求 ID
+func (s *LoginLogService) WithContext(ctx context.Context) *LoginLogService {
+	return &LoginLogService{db: s.db.WithContext(ctx), mailer: s.mailer, cfg: s.cfg}
+}
+
+// Record 写入一条安全事件，写入失败只输出日志，不影响登录流程；
+// 登录成功时检查该账户近期的登录 IP 数，超过阈值则生成告警
+func (s *LoginLogService) Record(ctx context.Context, entry model.LoginLog) {
+	db := s.db.WithContext(ctx)
+	// 登录失败、刷新令牌失败时调用方只知道用户名或用户 ID 之一，补全另一项以便按用户与数据权限查询
+	if entry.UserID == 0 && entry.Username != "" {
+		var user model.User
+		if err := db.Select("id").Where("username = ?", entry.Username).Limit(1).Find(&user).Error; err == nil {
+			entry.UserID = user.ID
+		}
+	} else if entry.Username == "" && entry.UserID != 0 {
+		var user model.User
+		if err := db.Select("username").Where("id = ?", entry.UserID).Limit(1).Find(&user).Error; err == nil {
+			entry.Username = user.Username
+		}
+	}
+
+	entry.ID = utils.GenerateID()
+	entry.CreatedAt = time.Now()
+	if err := db.Create(&entry).Error; err != nil {
+		slog.ErrorContext(ctx, "登录日志写入失败", "event", entry.Event, "username", entry.Username, "err", err)
+		return
+	}
+	if entry.Event == model.LoginEventLogin && entry.Result == model.LoginResultSuccess && entry.UserID != 0 {
+		if err := s.checkMultiIPLogin(ctx, entry); err != nil {
+			slog.ErrorContext(ctx, "多 IP 登录检查失败", "username", entry.Username, "err", err)
+		}
+	}
+}
+
+type ListLoginLogsParams struct {
+	UserID    int64
+	Username  string
+	Event     string
+	Result    string
+	IP        string
+	StartTime *time.Time
+	EndTime   *time.Time
+	Page      int
+	PageSize  int
+	Scope     *DataScope // 数据权限范围，nil 表示不限制
+}
+
+type PagedLoginLogs struct {
+	Total int64            `json:"total"`
+	Items []model.LoginLog `json:"items"`
+}
+
+func (s *LoginLogService) List(params ListLoginLogsParams) (PagedLoginLogs, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 || params.PageSize > 200 {
+		params.PageSize = 10
+	}
+
+	q := s.db.Model(&model.LoginLog{}).Scopes(LoginLogScope(params.Scope))
+	if params.UserID != 0 {
+		q = q.Where("user_id = ?", params.UserID)
+	}
+	if params.Username != "" {
+		q = q.Where("username ILIKE ?", "%"+params.Username+"%")
+	}
+	if params.Event != "" {
+		q = q.Where("event = ?", params.Event)
+	}
+	if params.Result != "" {
+		q = q.Where("result = ?", params.Result)
+	}
+	if params.IP != "" {
+		q = q.Where("ip = ?", params.IP)
+	}
+	if params.StartTime != nil {
+		q = q.Where("created_at >= ?", *params.StartTime)
+	}
+	if params.EndTime != nil {
+		q = q.Where("created_at <= ?", *params.EndTime)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return PagedLoginLogs{}, err
+	}
+
+	var items []model.LoginLog
+	if err := q.Order("created_at DESC").Offset((params.Page - 1) * params.PageSize).Limit(params.PageSize).Find(&items).Error; err != nil {
+		return PagedLoginLogs{}, err
+	}
+	return PagedLoginLogs{Total: total, Items: items}, nil
+}
+
+// Recent 用户最近的登录记录（含失败），供个人中心展示
+func (s *LoginLogService) Recent(userID int64, limit int) ([]model.LoginLog, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	items := []model.LoginLog{}
+	err := s.db.Where("user_id = ? AND event = ?", userID, model.LoginEventLogin).
+		Order("created_at DESC").Limit(limit).Find(&items).Error
+	return items, err
+}
+
+type ListSecurityAlertsParams struct {
+	Type         string
+	Acknowledged *bool
+	Page         int
+	PageSize     int
+	Scope        *DataScope
+}
+
+type PagedSecurityAlerts struct {
+	Total int64                 `json:"total"`
+	Items []model.SecurityAlert `json:"items"`
+}
+
+func (s *LoginLogService) ListAlerts(params ListSecurityAlertsParams) (PagedSecurityAlerts, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 || params.PageSize > 200 {
+		params.PageSize = 10
+	}
+
+	q := s.db.Model(&model.SecurityAlert{}).
+		Where("user_id IN (?)", s.db.Model(&model.User{}).Select("sys_users.id").Scopes(UserScope(params.Scope)))
+	if params.Type != "" {
+		q = q.Where("type = ?", params.Type)
+	}
+	if params.Acknowledged != nil {
+		q = q.Where("acknowledged = ?", *params.Acknowledged)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return PagedSecurityAlerts{}, err
+	}
+	var items []model.SecurityAlert
+	if err := q.Order("created_at DESC").Offset((params.Page - 1) * params.PageSize).Limit(params.PageSize).Find(&items).Error; err != nil {
+		return PagedSecurityAlerts{}, err
+	}
+	return PagedSecurityAlerts{Total: total, Items: items}, nil
+}
+
+// AcknowledgeAlert 确认告警，已确认的告警不会重复确认
+func (s *LoginLogService) AcknowledgeAlert(id int64, operator string) error {
+	now := time.Now()
+	res := s.db.Model(&model.SecurityAlert{}).Where("id = ? AND acknowledged = ?", id, false).Updates(map[string]interface{}{
+		"acknowledged":    true,
+		"acknowledged_by": operator,
+		"acknowledged_at": now,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrSecurityAlertNotFound
+	}
+	return nil
+}
+
+// checkMultiIPLogin 统计窗口内该账户成功登录的不同 IP 数，达到阈值时告警；
+// 同一窗口内已告警过的账户不重复告警
+func (s *LoginLogService) checkMultiIPLogin(ctx context.Context, entry model.LoginLog) error {
+	threshold := s.cfg.AlertIPThreshold
+	if threshold <= 0 {
+		return nil
+	}
+	window := time.Duration(s.cfg.AlertWindowMinutes) * time.Minute
+	if window <= 0 {
+		window = time.Hour
+	}
+	since := entry.CreatedAt.Add(-window)
+	db := s.db.WithContext(ctx)
+
+	var ips []string
+	if err := db.Model(&model.LoginLog{}).
+		Where("user_id = ? AND event = ? AND result = ? AND created_at >= ?", entry.UserID, model.LoginEventLogin, model.LoginResultSuccess, since).
+		Distinct("ip").Order("ip").Pluck("ip", &ips).Error; err != nil {
+		return err
+	}
+	if len(ips) < threshold {
+		return nil
+	}
+
+	var alerted int64
+	if err := db.Model(&model.SecurityAlert{}).
+		Where("type = ? AND user_id = ? AND created_at >= ?", model.SecurityAlertMultiIPLogin, entry.UserID, since).
+		Count(&alerted).Error; err != nil {
+		return err
+	}
+	if alerted > 0 {
+		return nil
+	}
+
+	ipsJSON, err := json.Marshal(ips)
+	if err != nil {
+		return err
+	}
+	alert := model.SecurityAlert{
+		ID:        utils.GenerateID(),
+		Type:      model.SecurityAlertMultiIPLogin,
+		UserID:    entry.UserID,
+		Username:  entry.Username,
+		Detail:    fmt.Sprintf("账户 %s 在 %d 分钟内从 %d 个不同 IP 登录", entry.Username, int(window.Minutes()), len(ips)),
+		IPs:       model.JSONText(ipsJSON),
+		CreatedAt: entry.CreatedAt,
+	}
+	if err := db.Create(&alert).Error; err != nil {
+		return err
+	}
+	slog.WarnContext(ctx, "安全告警", "type", alert.Type, "username", alert.Username, "detail", alert.Detail, "ips", ips)
+
+	if len(s.cfg.AlertEmails) > 0 && s.mailer != nil {
+		msg := mail.Message{
+			To:      s.cfg.AlertEmails,
+			Subject: "[安全告警] 账户多 IP 登录: " + entry.Username,
+			Body: fmt.Sprintf("%s。\n\n登录 IP：\n%s\n\n最近一次登录：%s，IP %s，%s\n\n请在系统“安全告警”中确认处理。",
+				alert.Detail, strings.Join(ips, "\n"), entry.CreatedAt.Format("2006-01-02 15:04:05"), entry.IP, entry.UserAgent),
+		}
+		// 发信可能较慢，放到后台进行，不拖慢登录响应；沿用请求 ID 等值但不随请求结束取消
+		mailCtx := context.WithoutCancel(ctx)
+		go func() {
+			mailCtx, cancel := context.WithTimeout(mailCtx, alertMailTimeout)
+			defer cancel()
+			if err := s.mailer.Send(mailCtx, msg); err != nil {
+				slog.ErrorContext(mailCtx, "安全告警邮件发送失败", "err", err)
+			}
+		}()
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"siqian-admin/internal/sys/model"
 	"siqian-admin/internal/utils"
 	"strconv"
@@ -16,6 +17,11 @@ func NewMenuService(db *gorm.DB) *MenuService {
 	return &MenuService{db: db}
 }
 
+// WithContext 绑定请求 context，写操作的审计日志据此记录操作人
+func (s *MenuService) WithContext(ctx context.Context) *MenuService {
+	return &MenuService{db: s.db.WithContext(ctx)}
+}
+
 func (s *MenuService) CreateMenu(menu *model.Menu) error {
 	// 生成雪花ID
 	menu.ID = utils.GenerateID()
@@ -91,18 +97,17 @@ func (s *MenuService) ListMenus() ([]model.Menu, error) {
 
 // 已删除：菜单树在前端由平铺列表转换
 
-// GetUserMenus 根据用户ID获取用户有权限的菜单（去重）
+// GetUserMenus 根据用户ID获取用户有权限的菜单（去重），包含从上级角色继承的菜单
 func (s *MenuService) GetUserMenus(userID int64) ([]model.Menu, error) {
 	var menus []model.Menu
 
-	// 通过用户角色关联查询菜单，并去重
-	err := s.db.Table("sys_menus").
-		Select("DISTINCT sys_menus.*").
-		Joins("JOIN sys_role_menus ON sys_menus.id = sys_role_menus.menu_id").
-		Joins("JOIN sys_user_roles ON sys_role_menus.role_id = sys_user_roles.role_id").
-		Where("sys_user_roles.user_id = ? AND sys_menus.status = '1' AND sys_menus.hidden = false", userID).
-		Order("sys_menus.sort ASC, sys_menus.id ASC").
-		Find(&menus).Error
+	err := s.db.Raw(userRoleTreeSQL+`
+		SELECT DISTINCT m.* FROM sys_menus m
+		JOIN sys_role_menus rm ON rm.menu_id = m.id
+		WHERE rm.role_id IN (SELECT id FROM role_tree)
+		  AND m.deleted_at IS NULL AND m.status = '1' AND m.hidden = false
+		ORDER BY m.sort ASC, m.id ASC`, userID).
+		Scan(&menus).Error
 
 	if err != nil {
 		return nil, err
@@ -111,3 +116,8 @@ func (s *MenuService) GetUserMenus(userID int64) ([]model.Menu, error) {
 	// 直接返回菜单数据，不处理树形结构
 	return menus, nil
 }
+
+// GetMenuUserIDs 查询通过角色（含继承）获得该菜单的用户ID，用于菜单变化后刷新会话权限
+func (s *MenuService) GetMenuUserIDs(menuID int64) ([]int64, error) {
+	return inheritingUserIDs(s.db, "id IN (SELECT role_id FROM sys_role_menus WHERE menu_id = ?)", menuID)
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"siqian-admin/internal/sys/model"
 
@@ -15,6 +16,11 @@ func NewOrganizationService(db *gorm.DB) *OrganizationService {
 	return &OrganizationService{db: db}
 }
 
+// WithContext 绑定请求 context，写操作的审计日志据此记录操作人
+func (s *OrganizationService) WithContext(ctx context.Context) *OrganizationService {
+	return &OrganizationService{db: s.db.WithContext(ctx)}
+}
+
 func (s *OrganizationService) CreateOrganization(org *model.Organization) error {
 	// 验证父组织是否存在（应用层数据完整性检查）
 	if org.ParentID != nil {
@@ -106,14 +112,51 @@ func (s *OrganizationService) SoftDeleteOrganization(id int64, operatorID int64)
 	return s.DeleteOrganization(id)
 }
 
-func (s *OrganizationService) ListOrganizations() ([]model.Organization, error) {
+func (s *OrganizationService) ListOrganizations(scope *DataScope) ([]model.Organization, error) {
 	var orgs []model.Organization
-	err := s.db.Preload("Parent").Preload("Children").Order("sort ASC, id ASC").Find(&orgs).Error
+	err := s.db.Scopes(OrganizationScope(scope)).
+		Preload("Parent").Preload("Children", OrganizationScope(scope)).
+		Order("sort ASC, id ASC").Find(&orgs).Error
 	return orgs, err
 }
 
-func (s *OrganizationService) GetOrganizationTree() ([]model.Organization, error) {
+func (s *OrganizationService) GetOrganizationTree(scope *DataScope) ([]model.Organization, error) {
+	if scope == nil || scope.All {
+		var orgs []model.Organization
+		err := s.db.Where("parent_id IS NULL").Preload("Children").Order("sort ASC, id ASC").Find(&orgs).Error
+		return orgs, err
+	}
+
+	// 受数据权限限制时，以可见组织中上级不可见的节点作为根
 	var orgs []model.Organization
-	err := s.db.Where("parent_id IS NULL").Preload("Children").Order("sort ASC, id ASC").Find(&orgs).Error
-	return orgs, err
+	if err := s.db.Scopes(OrganizationScope(scope)).Order("sort ASC, id ASC").Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	return buildOrganizationTree(orgs), nil
+}
+
+// buildOrganizationTree 将平铺的组织列表组装为树，保持原有顺序
+func buildOrganizationTree(orgs []model.Organization) []model.Organization {
+	visible := make(map[int64]bool, len(orgs))
+	children := make(map[int64][]model.Organization, len(orgs))
+	for _, org := range orgs {
+		visible[org.ID] = true
+	}
+	var roots []model.Organization
+	for _, org := range orgs {
+		if org.ParentID != nil && visible[*org.ParentID] {
+			children[*org.ParentID] = append(children[*org.ParentID], org)
+		} else {
+			roots = append(roots, org)
+		}
+	}
+
+	var attach func(nodes []model.Organization) []model.Organization
+	attach = func(nodes []model.Organization) []model.Organization {
+		for i := range nodes {
+			nodes[i].Children = attach(children[nodes[i].ID])
+		}
+		return nodes
+	}
+	return attach(roots)
 }
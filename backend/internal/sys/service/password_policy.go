@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"siqian-admin/internal/config"
+	"siqian-admin/internal/sys/model"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicyError 密码不满足安全策略，Violations 列出每一条未通过的规则
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "密码不符合安全策略：" + strings.Join(e.Violations, "；")
+}
+
+// ValidatePasswordStrength 按配置校验密码长度、字符类别与弱密码黑名单
+func ValidatePasswordStrength(username, password string) error {
+	policy := config.GetConfig().PasswordPolicy
+	var violations []string
+
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		violations = append(violations, fmt.Sprintf("长度不能少于%d位", policy.MinLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if policy.RequireUpper && !hasUpper {
+		violations = append(violations, "需包含大写字母")
+	}
+	if policy.RequireLower && !hasLower {
+		violations = append(violations, "需包含小写字母")
+	}
+	if policy.RequireDigit && !hasDigit {
+		violations = append(violations, "需包含数字")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		violations = append(violations, "需包含特殊字符")
+	}
+
+	lower := strings.ToLower(password)
+	for _, blocked := range policy.Blocklist {
+		if lower == strings.ToLower(blocked) {
+			violations = append(violations, "密码过于常见")
+			break
+		}
+	}
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		violations = append(violations, "不能包含用户名")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// PasswordExpired 密码是否超过最长使用期限
+func PasswordExpired(user *model.User) bool {
+	return passwordExpired(user, config.GetConfig().PasswordPolicy.MaxAgeDays, time.Now())
+}
+
+// passwordExpired 没有修改时间的账户视为未过期，迁移时会补为迁移时间，避免启用有效期后老账户全部立即过期
+func passwordExpired(user *model.User, maxAgeDays int, now time.Time) bool {
+	if maxAgeDays <= 0 || user.PasswordChangedAt == nil {
+		return false
+	}
+	return now.Sub(*user.PasswordChangedAt) > time.Duration(maxAgeDays)*24*time.Hour
+}
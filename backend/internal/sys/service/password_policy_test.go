@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"siqian-admin/internal/sys/model"
+)
+
+func TestPasswordExpired(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days float64) *time.Time {
+		at := now.Add(-time.Duration(days * float64(24*time.Hour)))
+		return &at
+	}
+
+	tests := []struct {
+		name      string
+		changedAt *time.Time
+		maxAge    int
+		want      bool
+	}{
+		{"未启用有效期", daysAgo(1000), 0, false},
+		{"有效期为负数", daysAgo(1000), -1, false},
+		{"未记录修改时间", nil, 90, false},
+		{"刚修改", daysAgo(0), 90, false},
+		{"未到期", daysAgo(89.9), 90, false},
+		{"恰好到期", daysAgo(90), 90, false},
+		{"已过期", daysAgo(90.1), 90, true},
+		{"修改时间晚于当前", daysAgo(-1), 90, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &model.User{PasswordChangedAt: tt.changedAt}
+			if got := passwordExpired(user, tt.maxAge, now); got != tt.want {
+				t.Errorf("passwordExpired() = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
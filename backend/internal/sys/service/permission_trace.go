@@ -0,0 +1,92 @@
+package service
+
+import (
+	"siqian-admin/internal/sys/model"
+)
+
+// PermissionTrace 用户某项权限在角色、菜单层面的来源，用于排查“无权限访问”
+type PermissionTrace struct {
+	Roles []TraceRole `json:"roles"` // 用户当前有效的角色（含继承的上级角色）
+	Menus []TraceMenu `json:"menus"` // 系统中全部带有该权限标识的菜单/按钮
+}
+
+// TraceRole 用户持有的一个角色
+type TraceRole struct {
+	RoleID    int64   `json:"role_id,string"`
+	Name      string  `json:"name"`
+	Code      string  `json:"code"`
+	Status    string  `json:"status"`
+	Inherited bool    `json:"inherited"` // 由下级角色继承而来，并非直接授予
+	Grants    bool    `json:"grants"`    // 是否通过可用菜单提供了该权限
+	MenuIDs   []int64 `json:"menu_ids"`  // 该角色直接绑定的、带有该权限标识的菜单
+}
+
+// TraceMenu 带有该权限标识的菜单及绑定它的角色
+type TraceMenu struct {
+	MenuID int64           `json:"menu_id,string"`
+	Name   string          `json:"name"`
+	Type   int             `json:"type"`
+	Status string          `json:"status"`
+	Hidden bool            `json:"hidden"`
+	Usable bool            `json:"usable"` // 启用且未隐藏，才会进入用户菜单
+	Roles  []TraceMenuRole `json:"roles"`
+}
+
+// TraceMenuRole 绑定了菜单的角色
+type TraceMenuRole struct {
+	RoleID int64  `json:"role_id,string"`
+	Name   string `json:"name"`
+	Code   string `json:"code"`
+	Held   bool   `json:"held"` // 用户是否持有（含继承）
+}
+
+// TracePermission 按 GetUserMenus 相同的规则（有效授权 + 角色继承 + 菜单启用且未隐藏）追溯权限来源
+func (s *RoleService) TracePermission(userID int64, permission string) (*PermissionTrace, error) {
+	var roles []TraceRole
+	err := s.db.Raw(userRoleTreeSQL+`
+		SELECT r.id AS role_id, r.name, r.code, r.status,
+		       r.id NOT IN (SELECT ur.role_id FROM sys_user_roles ur WHERE ur.user_id = ? AND `+activeGrantConditionOn("ur")+`) AS inherited
+		FROM sys_roles r
+		WHERE r.id IN (SELECT id FROM role_tree)
+		ORDER BY r.sort ASC, r.id ASC`, userID, userID).
+		Scan(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var menus []model.Menu
+	if err := s.db.Preload("Roles").Where("permission = ?", permission).Order("sort ASC, id ASC").Find(&menus).Error; err != nil {
+		return nil, err
+	}
+
+	held := make(map[int64]*TraceRole, len(roles))
+	for i := range roles {
+		held[roles[i].RoleID] = &roles[i]
+	}
+	trace := &PermissionTrace{Menus: make([]TraceMenu, 0, len(menus))}
+	for _, m := range menus {
+		item := TraceMenu{
+			MenuID: m.ID,
+			Name:   m.Name,
+			Type:   m.Type,
+			Status: m.Status,
+			Hidden: m.Hidden,
+			Usable: m.Status == "1" && !m.Hidden,
+			Roles:  make([]TraceMenuRole, 0, len(m.Roles)),
+		}
+		for _, r := range m.Roles {
+			role, ok := held[r.ID]
+			item.Roles = append(item.Roles, TraceMenuRole{RoleID: r.ID, Name: r.Name, Code: r.Code, Held: ok})
+			if !ok {
+				continue
+			}
+			role.MenuIDs = append(role.MenuIDs, m.ID)
+			if item.Usable {
+				role.Grants = true
+			}
+		}
+		trace.Menus = append(trace.Menus, item)
+	}
+	trace.Roles = roles
+	return trace, nil
+}
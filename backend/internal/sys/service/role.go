@@ -1,6 +1,8 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"siqian-admin/internal/sys/model"
 	"siqian-admin/internal/utils"
 
@@ -15,23 +17,48 @@ func NewRoleService(db *gorm.DB) *RoleService {
 	return &RoleService{db: db}
 }
 
+// WithContext 绑定请求 context，写操作的审计日志据此记录操作人
+func (s *RoleService) WithContext(ctx context.Context) *RoleService {
+	return &RoleService{db: s.db.WithContext(ctx)}
+}
+
+var (
+	ErrRoleCycle          = errors.New("不能将角色自身或其下级角色设为上级角色")
+	ErrParentRoleNotFound = errors.New("上级角色不存在")
+	ErrRoleHasChildren    = errors.New("该角色下还有下级角色，无法删除")
+)
+
 func (s *RoleService) CreateRole(role *model.Role) error {
 	// 生成雪花ID
 	role.ID = utils.GenerateID()
+	if err := s.checkParent(role.ID, role.ParentID); err != nil {
+		return err
+	}
 	return s.db.Create(role).Error
 }
 
 func (s *RoleService) GetRoleByID(id int64) (*model.Role, error) {
 	var role model.Role
-	err := s.db.Preload("Users").Preload("Menus").First(&role, id).Error
+	err := s.db.Preload("Users").Preload("Menus").Preload("DataScopeOrgs").First(&role, id).Error
 	return &role, err
 }
 
 func (s *RoleService) UpdateRole(role *model.Role) error {
+	if err := s.checkParent(role.ID, role.ParentID); err != nil {
+		return err
+	}
 	return s.db.Save(role).Error
 }
 
 func (s *RoleService) DeleteRole(id int64) error {
+	// 与组织一致：存在下级时不允许删除，避免下级角色悄然失去继承的权限
+	var childCount int64
+	if err := s.db.Model(&model.Role{}).Where("parent_id = ?", id).Count(&childCount).Error; err != nil {
+		return err
+	}
+	if childCount > 0 {
+		return ErrRoleHasChildren
+	}
 	return s.db.Delete(&model.Role{}, id).Error
 }
 
@@ -73,22 +100,67 @@ func (s *RoleService) AssignUsers(roleID int64, userIDs []int64) error {
 		return err
 	}
 
-	var users []model.User
-	if err := s.db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
-		return err
-	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockAssignment(tx, []int64{roleID}, userIDs); err != nil {
+			return err
+		}
+		var users []model.User
+		if err := tx.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			return err
+		}
+		if err := checkRoleUsers(tx, roleID, users); err != nil {
+			return err
+		}
 
-	// 清除现有关联
-	if err := s.db.Model(&role).Association("Users").Clear(); err != nil {
-		return err
-	}
+		// 只增删有变化的用户，保留的授权行连同有效期原样不动
+		var current []int64
+		if err := tx.Model(&model.UserRole{}).Where("role_id = ?", roleID).Pluck("user_id", &current).Error; err != nil {
+			return err
+		}
+		held := make(map[int64]bool, len(current))
+		for _, id := range current {
+			held[id] = true
+		}
+		keep := make(map[int64]bool, len(users))
+		var added []model.UserRole
+		for _, user := range users {
+			keep[user.ID] = true
+			if !held[user.ID] {
+				added = append(added, model.UserRole{UserID: user.ID, RoleID: roleID})
+			}
+		}
+		var removed []int64
+		for _, id := range current {
+			if !keep[id] {
+				removed = append(removed, id)
+			}
+		}
 
-	// 添加新关联
-	if len(users) > 0 {
-		if err := s.db.Model(&role).Association("Users").Append(users); err != nil {
+		if len(removed) > 0 {
+			if err := tx.Where("role_id = ? AND user_id IN ?", roleID, removed).Delete(&model.UserRole{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(added) > 0 {
+			return tx.Create(&added).Error
+		}
+		return nil
+	})
+}
+
+// SetDataScopeOrgs 设置角色自定义数据权限的组织集合
+func (s *RoleService) SetDataScopeOrgs(roleID int64, orgIDs []int64) error {
+	role := model.Role{ID: roleID}
+	var orgs []model.Organization
+	if len(orgIDs) > 0 {
+		if err := s.db.Where("id IN ?", orgIDs).Find(&orgs).Error; err != nil {
 			return err
 		}
 	}
+	return s.db.Model(&role).Association("DataScopeOrgs").Replace(orgs)
+}
 
-	return nil
+// GetRoleUserIDs 查询拥有该角色或其下级角色的用户ID，用于角色绑定变化后刷新会话权限
+func (s *RoleService) GetRoleUserIDs(roleID int64) ([]int64, error) {
+	return inheritingUserIDs(s.db, "id = ?", roleID)
 }
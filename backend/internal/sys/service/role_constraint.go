@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"siqian-admin/internal/sys/model"
+	"siqian-admin/internal/utils"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 约束违规类型
+const (
+	ViolationSeparationOfDuties = "sod"         // 同时持有互斥角色
+	ViolationCardinality        = "cardinality" // 角色持有人数超限
+)
+
+var ErrInvalidRoleConstraint = errors.New("互斥集合中的角色数必须大于允许同时持有的数量，且允许数量至少为 1")
+
+// RoleConstraintViolation 一条违反职责分离约束或人数上限的记录
+type RoleConstraintViolation struct {
+	Kind           string   `json:"kind"`
+	ConstraintID   int64    `json:"constraint_id,string,omitempty"`
+	ConstraintName string   `json:"constraint_name,omitempty"`
+	UserID         int64    `json:"user_id,string,omitempty"`
+	Username       string   `json:"username,omitempty"`
+	RoleID         int64    `json:"role_id,string,omitempty"`
+	Roles          []string `json:"roles"` // 涉及的角色名称
+	Limit          int      `json:"limit"`
+	Actual         int      `json:"actual"`
+	Message        string   `json:"message"`
+}
+
+// RoleConstraintError 角色分配违反约束，Violations 列出每一条违规
+type RoleConstraintError struct {
+	Violations []RoleConstraintViolation
+}
+
+func (e *RoleConstraintError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "违反角色约束：" + strings.Join(messages, "；")
+}
+
+type RoleConstraintService struct {
+	db *gorm.DB
+}
+
+func NewRoleConstraintService(db *gorm.DB) *RoleConstraintService {
+	return &RoleConstraintService{db: db}
+}
+
+// WithContext 绑定请求 context，SQL 日志据此带上请求 ID
+func (s *RoleConstraintService) WithContext(ctx context.Context) *RoleConstraintService {
+	return &RoleConstraintService{db: s.db.WithContext(ctx)}
+}
+
+func (s *RoleConstraintService) CreateConstraint(constraint *model.RoleConstraint, roleIDs []int64) error {
+	roles, err := s.constraintRoles(constraint.MaxRoles, roleIDs)
+	if err != nil {
+		return err
+	}
+	constraint.ID = utils.GenerateID()
+	constraint.Roles = roles
+	return s.db.Create(constraint).Error
+}
+
+func (s *RoleConstraintService) GetConstraintByID(id int64) (*model.RoleConstraint, error) {
+	var constraint model.RoleConstraint
+	err := s.db.Preload("Roles").First(&constraint, id).Error
+	return &constraint, err
+}
+
+func (s *RoleConstraintService) ListConstraints() ([]model.RoleConstraint, error) {
+	var constraints []model.RoleConstraint
+	err := s.db.Preload("Roles").Order("created_at ASC").Find(&constraints).Error
+	return constraints, err
+}
+
+func (s *RoleConstraintService) UpdateConstraint(constraint *model.RoleConstraint, roleIDs []int64) error {
+	roles, err := s.constraintRoles(constraint.MaxRoles, roleIDs)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(constraint).Select("name", "description", "max_roles").Updates(constraint).Error; err != nil {
+			return err
+		}
+		return tx.Model(constraint).Association("Roles").Replace(roles)
+	})
+}
+
+func (s *RoleConstraintService) DeleteConstraint(id int64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_constraint_id = ?", id).Delete(&model.RoleConstraintRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.RoleConstraint{}, id).Error
+	})
+}
+
+// Violations 审计现有授权中违反约束的情况（约束或人数上限设置之前已存在的授权）
+func (s *RoleConstraintService) Violations() ([]RoleConstraintViolation, error) {
+	checker, err := newRoleConstraintChecker(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		UserID   int64
+		Username string
+		RoleID   int64
+	}
+	err = s.db.Table("sys_user_roles ur").
+		Select("ur.user_id, u.username, ur.role_id").
+		Joins("JOIN sys_users u ON u.id = ur.user_id AND u.deleted_at IS NULL").
+		Order("u.username ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var users []model.User
+	userRoles := map[int64][]int64{}
+	holders := map[int64]int{}
+	for _, row := range rows {
+		if _, ok := userRoles[row.UserID]; !ok {
+			users = append(users, model.User{ID: row.UserID, Username: row.Username})
+		}
+		userRoles[row.UserID] = append(userRoles[row.UserID], row.RoleID)
+		holders[row.RoleID]++
+	}
+
+	var violations []RoleConstraintViolation
+	for _, user := range users {
+		violations = append(violations, checker.separationViolations(user, userRoles[user.ID])...)
+	}
+	for _, roleID := range checker.sortedRoleIDs() {
+		if v := checker.capacityViolation(roleID, holders[roleID]); v != nil {
+			violations = append(violations, *v)
+		}
+	}
+	return violations, nil
+}
+
+// constraintRoles 校验约束配置并加载互斥角色
+func (s *RoleConstraintService) constraintRoles(maxRoles int, roleIDs []int64) ([]model.Role, error) {
+	var roles []model.Role
+	if len(roleIDs) > 0 {
+		if err := s.db.Where("id IN ?", roleIDs).Find(&roles).Error; err != nil {
+			return nil, err
+		}
+	}
+	if maxRoles < 1 || len(roles) <= maxRoles {
+		return nil, ErrInvalidRoleConstraint
+	}
+	return roles, nil
+}
+
+// lockAssignment 在事务内锁定本次分配涉及的角色行与用户行，之后的约束校验与写入都在该事务中进行，
+// 并发的分配只能排队校验，不会各自通过后一起超出人数上限或凑成互斥角色。
+// 所有分配都先锁角色再锁用户，且按 ID 升序加锁，避免相互等待形成死锁
+func lockAssignment(tx *gorm.DB, roleIDs, userIDs []int64) error {
+	if len(roleIDs) > 0 {
+		var locked []int64
+		if err := tx.Model(&model.Role{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", roleIDs).Order("id ASC").Pluck("id", &locked).Error; err != nil {
+			return err
+		}
+	}
+	if len(userIDs) > 0 {
+		var locked []int64
+		if err := tx.Model(&model.User{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", userIDs).Order("id ASC").Pluck("id", &locked).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUserRoles 校验用户直接持有 roleIDs 后是否违反互斥约束，以及新增角色是否超过人数上限
+func checkUserRoles(db *gorm.DB, user model.User, roleIDs []int64) error {
+	checker, err := newRoleConstraintChecker(db)
+	if err != nil {
+		return err
+	}
+	violations := checker.separationViolations(user, roleIDs)
+
+	var current []int64
+	if err := db.Model(&model.UserRole{}).Where("user_id = ?", user.ID).Pluck("role_id", &current).Error; err != nil {
+		return err
+	}
+	held := make(map[int64]bool, len(current))
+	for _, id := range current {
+		held[id] = true
+	}
+	for _, roleID := range uniqueRoleIDs(roleIDs) {
+		role, ok := checker.roles[roleID]
+		if held[roleID] || !ok || role.MaxUsers <= 0 {
+			continue
+		}
+		var others int64
+		if err := db.Table("sys_user_roles ur").
+			Joins("JOIN sys_users u ON u.id = ur.user_id AND u.deleted_at IS NULL").
+			Where("ur.role_id = ? AND ur.user_id <> ?", roleID, user.ID).
+			Count(&others).Error; err != nil {
+			return err
+		}
+		if v := checker.capacityViolation(roleID, int(others)+1); v != nil {
+			violations = append(violations, *v)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &RoleConstraintError{Violations: violations}
+	}
+	return nil
+}
+
+// checkRoleUsers 校验角色授予给 users 后是否超过人数上限，以及每个用户是否因此违反互斥约束
+func checkRoleUsers(db *gorm.DB, roleID int64, users []model.User) error {
+	checker, err := newRoleConstraintChecker(db)
+	if err != nil {
+		return err
+	}
+
+	var violations []RoleConstraintViolation
+	if v := checker.capacityViolation(roleID, len(users)); v != nil {
+		violations = append(violations, *v)
+	}
+	for _, user := range users {
+		var roleIDs []int64
+		if err := db.Model(&model.UserRole{}).Where("user_id = ? AND role_id <> ?", user.ID, roleID).Pluck("role_id", &roleIDs).Error; err != nil {
+			return err
+		}
+		violations = append(violations, checker.separationViolations(user, append(roleIDs, roleID))...)
+	}
+
+	if len(violations) > 0 {
+		return &RoleConstraintError{Violations: violations}
+	}
+	return nil
+}
+
+// roleConstraintChecker 在内存中按角色继承关系计算约束，角色与约束数量都很少
+type roleConstraintChecker struct {
+	roles       map[int64]model.Role
+	constraints []model.RoleConstraint
+}
+
+func newRoleConstraintChecker(db *gorm.DB) (*roleConstraintChecker, error) {
+	var roles []model.Role
+	if err := db.Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	checker := &roleConstraintChecker{roles: make(map[int64]model.Role, len(roles))}
+	for _, role := range roles {
+		checker.roles[role.ID] = role
+	}
+	if err := db.Preload("Roles").Find(&checker.constraints).Error; err != nil {
+		return nil, err
+	}
+	return checker, nil
+}
+
+// effectiveRoles 直接持有的角色加上其全部上级角色，继承来的职责同样参与互斥判断
+func (c *roleConstraintChecker) effectiveRoles(roleIDs []int64) map[int64]bool {
+	effective := map[int64]bool{}
+	for _, id := range roleIDs {
+		for next := &id; next != nil && !effective[*next]; {
+			role, ok := c.roles[*next]
+			if !ok {
+				break
+			}
+			effective[role.ID] = true
+			next = role.ParentID
+		}
+	}
+	return effective
+}
+
+func (c *roleConstraintChecker) separationViolations(user model.User, roleIDs []int64) []RoleConstraintViolation {
+	if len(c.constraints) == 0 || len(roleIDs) == 0 {
+		return nil
+	}
+	effective := c.effectiveRoles(roleIDs)
+
+	var violations []RoleConstraintViolation
+	for _, constraint := range c.constraints {
+		var names []string
+		for _, role := range constraint.Roles {
+			if effective[role.ID] {
+				names = append(names, role.Name)
+			}
+		}
+		if len(names) <= constraint.MaxRoles {
+			continue
+		}
+		violations = append(violations, RoleConstraintViolation{
+			Kind:           ViolationSeparationOfDuties,
+			ConstraintID:   constraint.ID,
+			ConstraintName: constraint.Name,
+			UserID:         user.ID,
+			Username:       user.Username,
+			Roles:          names,
+			Limit:          constraint.MaxRoles,
+			Actual:         len(names),
+			Message: fmt.Sprintf("用户 %s 同时持有互斥角色 %s，约束「%s」最多允许 %d 个",
+				user.Username, strings.Join(names, "、"), constraint.Name, constraint.MaxRoles),
+		})
+	}
+	return violations
+}
+
+// capacityViolation 角色持有人数为 holders 时是否超过上限
+func (c *roleConstraintChecker) capacityViolation(roleID int64, holders int) *RoleConstraintViolation {
+	role, ok := c.roles[roleID]
+	if !ok || role.MaxUsers <= 0 || holders <= role.MaxUsers {
+		return nil
+	}
+	return &RoleConstraintViolation{
+		Kind:    ViolationCardinality,
+		RoleID:  role.ID,
+		Roles:   []string{role.Name},
+		Limit:   role.MaxUsers,
+		Actual:  holders,
+		Message: fmt.Sprintf("角色 %s 最多授予 %d 个用户，实际为 %d 个", role.Name, role.MaxUsers, holders),
+	}
+}
+
+func (c *roleConstraintChecker) sortedRoleIDs() []int64 {
+	ids := make([]int64, 0, len(c.roles))
+	for id := range c.roles {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func uniqueRoleIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
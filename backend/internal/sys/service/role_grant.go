@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"siqian-admin/internal/sys/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidGrantWindow = errors.New("失效时间必须晚于生效时间且晚于当前时间")
+
+// ActiveRoles 预加载用户角色时只保留当前有效的授权，用法：Preload("Roles", ActiveRoles(userID))
+func ActiveRoles(userID int64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("sys_roles.id IN (SELECT role_id FROM sys_user_roles WHERE user_id = ? AND "+
+			activeGrantConditionOn("sys_user_roles")+")", userID)
+	}
+}
+
+// RoleGrant 用户角色授权及其有效期
+type RoleGrant struct {
+	UserID     int64      `json:"user_id,string"`
+	Username   string     `json:"username"`
+	RealName   string     `json:"real_name"`
+	RoleID     int64      `json:"role_id,string"`
+	RoleName   string     `json:"role_name"`
+	RoleCode   string     `json:"role_code"`
+	ValidFrom  *time.Time `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until"`
+	Active     bool       `json:"active"`
+}
+
+type RoleGrantService struct {
+	db *gorm.DB
+}
+
+func NewRoleGrantService(db *gorm.DB) *RoleGrantService {
+	return &RoleGrantService{db: db}
+}
+
+// WithContext 绑定请求 context，写操作的审计日志据此记录操作人
+func (s *RoleGrantService) WithContext(ctx context.Context) *RoleGrantService {
+	return &RoleGrantService{db: s.db.WithContext(ctx)}
+}
+
+// Grant 授予角色或调整已有授权的有效期，均为空表示长期有效
+func (s *RoleGrantService) Grant(userID, roleID int64, validFrom, validUntil *time.Time) error {
+	if validUntil != nil {
+		if !validUntil.After(time.Now()) || (validFrom != nil && !validUntil.After(*validFrom)) {
+			return ErrInvalidGrantWindow
+		}
+	}
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return err
+	}
+	if err := s.db.First(&model.Role{}, roleID).Error; err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockAssignment(tx, []int64{roleID}, []int64{userID}); err != nil {
+			return err
+		}
+		var roleIDs []int64
+		if err := tx.Model(&model.UserRole{}).Where("user_id = ?", userID).Pluck("role_id", &roleIDs).Error; err != nil {
+			return err
+		}
+		if err := checkUserRoles(tx, user, append(roleIDs, roleID)); err != nil {
+			return err
+		}
+
+		grant := model.UserRole{UserID: userID, RoleID: roleID, ValidFrom: validFrom, ValidUntil: validUntil}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "role_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"valid_from", "valid_until"}),
+		}).Create(&grant).Error
+	})
+}
+
+// ListUserGrants 列出用户的全部角色授权（含未生效与已过期未清理的）
+func (s *RoleGrantService) ListUserGrants(userID int64) ([]RoleGrant, error) {
+	var grants []RoleGrant
+	err := s.grantQuery().Where("ur.user_id = ?", userID).Order("r.sort ASC, r.id ASC").Scan(&grants).Error
+	return grants, err
+}
+
+// ListExpiring 列出在 within 时间内到期的有效授权，按到期时间排序
+func (s *RoleGrantService) ListExpiring(within time.Duration, scope *DataScope) ([]RoleGrant, error) {
+	var grants []RoleGrant
+	now := time.Now()
+	err := s.grantQuery().
+		Where("ur.valid_until > ? AND ur.valid_until <= ?", now, now.Add(within)).
+		Scopes(UserScope(scope)).
+		Order("ur.valid_until ASC").
+		Scan(&grants).Error
+	return grants, err
+}
+
+// RevokeExpired 删除已过期的授权，返回受影响的用户ID。经模型删除以触发审计回调
+func (s *RoleGrantService) RevokeExpired(now time.Time) ([]int64, error) {
+	var revoked []model.UserRole
+	if err := s.db.Clauses(clause.Returning{}).
+		Where("valid_until IS NOT NULL AND valid_until <= ?", now).
+		Delete(&revoked).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]bool, len(revoked))
+	userIDs := make([]int64, 0, len(revoked))
+	for _, grant := range revoked {
+		if !seen[grant.UserID] {
+			seen[grant.UserID] = true
+			userIDs = append(userIDs, grant.UserID)
+		}
+	}
+	return userIDs, nil
+}
+
+// ExpiredUsers 持有已过期、尚未清理的授权的用户ID
+func (s *RoleGrantService) ExpiredUsers(now time.Time) ([]int64, error) {
+	var userIDs []int64
+	err := s.db.Model(&model.UserRole{}).
+		Where("valid_until IS NOT NULL AND valid_until <= ?", now).
+		Distinct().
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// ActivatedBetween 查询在 (since, until] 期间开始生效的授权所属用户
+func (s *RoleGrantService) ActivatedBetween(since, until time.Time) ([]int64, error) {
+	var userIDs []int64
+	err := s.db.Model(&model.UserRole{}).
+		Where("valid_from > ? AND valid_from <= ?", since, until).
+		Distinct().
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+func (s *RoleGrantService) grantQuery() *gorm.DB {
+	return s.db.Table("sys_user_roles ur").
+		Select("ur.user_id, sys_users.username, sys_users.real_name, ur.role_id, r.name AS role_name, r.code AS role_code, " +
+			"ur.valid_from, ur.valid_until, (" + activeGrantConditionOn("ur") + ") AS active").
+		Joins("JOIN sys_users ON sys_users.id = ur.user_id AND sys_users.deleted_at IS NULL").
+		Joins("JOIN sys_roles r ON r.id = ur.role_id AND r.deleted_at IS NULL")
+}
+
+// activeGrantConditionOn 用户角色授权当前有效的条件，alias 为 sys_user_roles 的表名或别名
+func activeGrantConditionOn(alias string) string {
+	return "(" + alias + ".valid_from IS NULL OR " + alias + ".valid_from <= NOW()) AND (" +
+		alias + ".valid_until IS NULL OR " + alias + ".valid_until > NOW())"
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"siqian-admin/internal/sys/model"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// userRoleTreeSQL 递归展开用户当前有效的直接角色及其全部上级角色（role_tree），参数为用户ID。
+// UNION 去重，即使数据中存在环也能终止
+var userRoleTreeSQL = `WITH RECURSIVE role_tree AS (
+	SELECT r.id, r.parent_id FROM sys_roles r
+	JOIN sys_user_roles ur ON ur.role_id = r.id
+	WHERE ur.user_id = ? AND r.deleted_at IS NULL AND ` + activeGrantConditionOn("ur") + `
+	UNION
+	SELECT p.id, p.parent_id FROM sys_roles p
+	JOIN role_tree t ON p.id = t.parent_id
+	WHERE p.deleted_at IS NULL
+)`
+
+// inheritingUserIDs 查询持有满足 roleFilter 的角色或其任一下级角色的用户ID
+func inheritingUserIDs(db *gorm.DB, roleFilter string, args ...interface{}) ([]int64, error) {
+	var userIDs []int64
+	err := db.Raw(`WITH RECURSIVE role_tree AS (
+		SELECT id FROM sys_roles WHERE deleted_at IS NULL AND `+roleFilter+`
+		UNION
+		SELECT c.id FROM sys_roles c
+		JOIN role_tree t ON c.parent_id = t.id
+		WHERE c.deleted_at IS NULL
+	)
+	SELECT DISTINCT user_id FROM sys_user_roles WHERE role_id IN (SELECT id FROM role_tree)`, args...).
+		Scan(&userIDs).Error
+	return userIDs, err
+}
+
+// PermissionSource 权限来源角色
+type PermissionSource struct {
+	RoleID    int64  `json:"role_id,string"`
+	RoleName  string `json:"role_name"`
+	RoleCode  string `json:"role_code"`
+	Inherited bool   `json:"inherited"` // 是否继承自上级角色
+}
+
+// EffectivePermission 角色最终拥有的一项菜单/按钮权限
+type EffectivePermission struct {
+	MenuID     int64              `json:"menu_id,string"`
+	Name       string             `json:"name"`
+	Type       int                `json:"type"`
+	Permission string             `json:"permission"`
+	Sources    []PermissionSource `json:"sources"`
+}
+
+// RolePermissions 角色的有效权限集合
+type RolePermissions struct {
+	Role        model.Role            `json:"role"`
+	Ancestors   []model.Role          `json:"ancestors"` // 由近及远的上级角色
+	Permissions []EffectivePermission `json:"permissions"`
+}
+
+// GetEffectivePermissions 汇总角色自身及全部上级角色的菜单，并标注每项权限的来源
+func (s *RoleService) GetEffectivePermissions(roleID int64) (*RolePermissions, error) {
+	chain, err := s.ancestorChain(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RolePermissions{Role: chain[0], Ancestors: chain[1:]}
+	byMenu := map[int64]*EffectivePermission{}
+	var order []model.Menu
+	for i, role := range chain {
+		var menus []model.Menu
+		err := s.db.Joins("JOIN sys_role_menus rm ON rm.menu_id = sys_menus.id").
+			Where("rm.role_id = ? AND sys_menus.status = '1' AND sys_menus.hidden = false", role.ID).
+			Find(&menus).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range menus {
+			p, ok := byMenu[m.ID]
+			if !ok {
+				p = &EffectivePermission{MenuID: m.ID, Name: m.Name, Type: m.Type, Permission: m.Permission}
+				byMenu[m.ID] = p
+				order = append(order, m)
+			}
+			p.Sources = append(p.Sources, PermissionSource{
+				RoleID:    role.ID,
+				RoleName:  role.Name,
+				RoleCode:  role.Code,
+				Inherited: i > 0,
+			})
+		}
+	}
+
+	// 与菜单列表保持相同的排序
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i].Sort != order[j].Sort {
+			return order[i].Sort < order[j].Sort
+		}
+		return order[i].ID < order[j].ID
+	})
+	result.Permissions = make([]EffectivePermission, 0, len(order))
+	for _, m := range order {
+		result.Permissions = append(result.Permissions, *byMenu[m.ID])
+	}
+	return result, nil
+}
+
+// ancestorChain 返回角色自身及其上级角色链（由近及远）
+func (s *RoleService) ancestorChain(roleID int64) ([]model.Role, error) {
+	var chain []model.Role
+	seen := map[int64]bool{}
+	next := &roleID
+	for next != nil && !seen[*next] {
+		var role model.Role
+		if err := s.db.First(&role, *next).Error; err != nil {
+			// 上级角色已被删除时继承链在此截断
+			if len(chain) > 0 && errors.Is(err, gorm.ErrRecordNotFound) {
+				break
+			}
+			return nil, err
+		}
+		seen[role.ID] = true
+		chain = append(chain, role)
+		next = role.ParentID
+	}
+	return chain, nil
+}
+
+// checkParent 校验上级角色存在且不会形成环
+func (s *RoleService) checkParent(roleID int64, parentID *int64) error {
+	if parentID == nil {
+		return nil
+	}
+	if *parentID == roleID {
+		return ErrRoleCycle
+	}
+	chain, err := s.ancestorChain(*parentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrParentRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	for _, ancestor := range chain {
+		if ancestor.ID == roleID {
+			return ErrRoleCycle
+		}
+	}
+	return nil
+}
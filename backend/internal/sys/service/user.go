@@ -1,9 +1,12 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"siqian-admin/internal/config"
 	"siqian-admin/internal/sys/model"
 	"siqian-admin/internal/utils"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -16,6 +19,11 @@ func NewUserService(db *gorm.DB) *UserService {
 	return &UserService{db: db}
 }
 
+// WithContext 绑定请求 context，写操作的审计日志据此记录操作人
+func (s *UserService) WithContext(ctx context.Context) *UserService {
+	return &UserService{db: s.db.WithContext(ctx)}
+}
+
 func (s *UserService) CreateUser(user *model.User) error {
 	// 检查用户名是否已存在
 	var existingUser model.User
@@ -23,6 +31,11 @@ func (s *UserService) CreateUser(user *model.User) error {
 		return errors.New("用户名已存在")
 	}
 
+	// 校验密码策略
+	if err := ValidatePasswordStrength(user.Username, user.Password); err != nil {
+		return err
+	}
+
 	// 生成雪花ID
 	user.ID = utils.GenerateID()
 
@@ -32,8 +45,90 @@ func (s *UserService) CreateUser(user *model.User) error {
 		return err
 	}
 	user.Password = hashedPassword
+	now := time.Now()
+	user.PasswordChangedAt = &now
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return recordPasswordHistory(tx, user.ID, hashedPassword)
+	})
+}
+
+// ValidateNewPassword 校验新密码是否满足密码策略（含历史密码），不做修改
+func (s *UserService) ValidateNewPassword(userID int64, newPassword string) error {
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	if err := ValidatePasswordStrength(user.Username, newPassword); err != nil {
+		return err
+	}
+	return s.checkPasswordHistory(&user, newPassword)
+}
+
+// ChangePassword 按密码策略修改密码（自助修改与管理员重置共用），并记录历史
+func (s *UserService) ChangePassword(userID int64, newPassword string) error {
+	if err := s.ValidateNewPassword(userID, newPassword); err != nil {
+		return err
+	}
 
-	return s.db.Create(user).Error
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"password":            hashedPassword,
+			"password_changed_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return recordPasswordHistory(tx, userID, hashedPassword)
+	})
+}
+
+// checkPasswordHistory 新密码不能与当前密码及最近 N 次历史密码相同
+func (s *UserService) checkPasswordHistory(user *model.User, newPassword string) error {
+	historySize := config.GetConfig().PasswordPolicy.HistorySize
+	if historySize <= 0 {
+		return nil
+	}
+	reused := &PasswordPolicyError{Violations: []string{"不能与最近使用过的密码相同"}}
+	if utils.CheckPasswordHash(newPassword, user.Password) {
+		return reused
+	}
+
+	var history []model.PasswordHistory
+	if err := s.db.Where("user_id = ?", user.ID).Order("created_at DESC").Limit(historySize).Find(&history).Error; err != nil {
+		return err
+	}
+	for _, h := range history {
+		if utils.CheckPasswordHash(newPassword, h.PasswordHash) {
+			return reused
+		}
+	}
+	return nil
+}
+
+// recordPasswordHistory 写入历史密码，仅保留最近 N 条
+func recordPasswordHistory(tx *gorm.DB, userID int64, hash string) error {
+	historySize := config.GetConfig().PasswordPolicy.HistorySize
+	if historySize <= 0 {
+		return nil
+	}
+	if err := tx.Create(&model.PasswordHistory{
+		ID:           utils.GenerateID(),
+		UserID:       userID,
+		PasswordHash: hash,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ? AND id NOT IN (?)", userID,
+		tx.Model(&model.PasswordHistory{}).Select("id").Where("user_id = ?", userID).Order("created_at DESC").Limit(historySize),
+	).Delete(&model.PasswordHistory{}).Error
 }
 
 func (s *UserService) GetUserByID(id int64) (*model.User, error) {
@@ -68,102 +163,60 @@ type UserFilters struct {
 	Username string
 	Phone    string
 	Status   *string
+	Scope    *DataScope // 数据权限范围，nil 表示不限制
 }
 
-func (s *UserService) ListUsers(page, pageSize int, filters *UserFilters) ([]model.User, int64, error) {
-	var users []model.User
-	var total int64
-
-	offset := (page - 1) * pageSize
-
-	query := s.db.Model(&model.User{})
-	// Apply filters
-	if filters != nil {
-		if filters.Username != "" {
-			query = query.Where("username LIKE ?", "%"+filters.Username+"%")
-		}
-		if filters.Phone != "" {
-			query = query.Where("phone LIKE ?", "%"+filters.Phone+"%")
-		}
-		if filters.Status != nil {
-			query = query.Where("status = ?", *filters.Status)
-		}
+// apply 追加筛选条件与数据权限范围
+func (f *UserFilters) apply(query *gorm.DB) *gorm.DB {
+	if f == nil {
+		return query
 	}
-
-	// 仅统计未软删除用户
-	err := query.Where("deleted_at IS NULL").Count(&total).Error
-	if err != nil {
-		return nil, 0, err
+	if f.Username != "" {
+		query = query.Where("sys_users.username LIKE ?", "%"+f.Username+"%")
 	}
-
-	err = query.Where("deleted_at IS NULL").Offset(offset).Limit(pageSize).Find(&users).Error
-	return users, total, err
+	if f.Phone != "" {
+		query = query.Where("sys_users.phone LIKE ?", "%"+f.Phone+"%")
+	}
+	if f.Status != nil {
+		query = query.Where("sys_users.status = ?", *f.Status)
+	}
+	return query.Scopes(UserScope(f.Scope))
 }
 
-func (s *UserService) ListUsersByOrganization(organizationID int64, page, pageSize int) ([]model.User, int64, error) {
-	var users []model.User
-	var total int64
-
-	offset := (page - 1) * pageSize
-
-	// 统计该组织下的未软删除用户总数
-	err := s.db.Model(&model.User{}).Where("organization_id = ? AND deleted_at IS NULL", organizationID).Count(&total).Error
-	if err != nil {
-		return nil, 0, err
-	}
+func (s *UserService) ListUsers(page, pageSize int, filters *UserFilters) ([]model.User, int64, error) {
+	return s.listUsers(s.db.Model(&model.User{}), page, pageSize, filters)
+}
 
-	// 查询该组织下的未软删除用户
-	err = s.db.Where("organization_id = ? AND deleted_at IS NULL", organizationID).Offset(offset).Limit(pageSize).Find(&users).Error
-	return users, total, err
+// ListUsersByOrganization 查询指定组织（不含子组织）下的用户
+func (s *UserService) ListUsersByOrganization(organizationID int64, page, pageSize int, filters *UserFilters) ([]model.User, int64, error) {
+	query := s.db.Model(&model.User{}).
+		Where("sys_users.id IN (SELECT user_id FROM sys_user_organizations WHERE organization_id = ?)", organizationID)
+	return s.listUsers(query, page, pageSize, filters)
 }
 
 // ListUsersByOrganizationPath 根据组织路径查询用户（包含子组织）
 func (s *UserService) ListUsersByOrganizationPath(organizationPath string, page, pageSize int, filters *UserFilters) ([]model.User, int64, error) {
+	// 查找所有路径等于或以指定路径开头的组织下的用户
+	query := s.db.Model(&model.User{}).
+		Where(`sys_users.id IN (SELECT uo.user_id FROM sys_user_organizations uo
+			JOIN sys_organizations o ON uo.organization_id = o.id AND o.deleted_at IS NULL
+			WHERE o.path = ? OR o.path LIKE ?)`, organizationPath, organizationPath+"/%")
+	return s.listUsers(query, page, pageSize, filters)
+}
+
+func (s *UserService) listUsers(query *gorm.DB, page, pageSize int, filters *UserFilters) ([]model.User, int64, error) {
 	var users []model.User
 	var total int64
 
 	offset := (page - 1) * pageSize
+	query = filters.apply(query)
 
-	// 构建查询条件：查找所有路径以指定路径开头的组织下的用户
-	// 使用JOIN查询用户组织关联表和组织表
-	baseQuery := `
-        FROM sys_users u
-        INNER JOIN sys_user_organizations uo ON u.id = uo.user_id
-        INNER JOIN sys_organizations o ON uo.organization_id = o.id
-        WHERE (o.path LIKE ? OR o.path = ?)
-          AND u.deleted_at IS NULL
-          AND o.deleted_at IS NULL
-    `
-
-	// 动态追加筛选条件
-	whereParams := []interface{}{organizationPath + "%", organizationPath}
-	filterSQL := ""
-	if filters != nil {
-		if filters.Username != "" {
-			filterSQL += " AND u.username LIKE ?"
-			whereParams = append(whereParams, "%"+filters.Username+"%")
-		}
-		if filters.Phone != "" {
-			filterSQL += " AND u.phone LIKE ?"
-			whereParams = append(whereParams, "%"+filters.Phone+"%")
-		}
-		if filters.Status != nil {
-			filterSQL += " AND u.status = ?"
-			whereParams = append(whereParams, *filters.Status)
-		}
-	}
-
-	// 统计该组织及其子组织下的用户总数
-	countSQL := "SELECT COUNT(DISTINCT u.id) " + baseQuery + filterSQL
-	err := s.db.Raw(countSQL, whereParams...).Scan(&total).Error
-	if err != nil {
+	// 软删除用户由 GORM 自动排除
+	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
-	// 查询该组织及其子组织下的用户
-	listSQL := "SELECT DISTINCT u.* " + baseQuery + filterSQL + " LIMIT ? OFFSET ?"
-	listParams := append(append([]interface{}{}, whereParams...), pageSize, offset)
-	err = s.db.Raw(listSQL, listParams...).Scan(&users).Error
+	err := query.Offset(offset).Limit(pageSize).Find(&users).Error
 	return users, total, err
 }
 
@@ -173,12 +226,19 @@ func (s *UserService) AssignRoles(userID int64, roleIDs []int64) error {
 		return err
 	}
 
-	var roles []model.Role
-	if err := s.db.Where("id IN ?", roleIDs).Find(&roles).Error; err != nil {
-		return err
-	}
-
-	return s.db.Model(&user).Association("Roles").Replace(roles)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockAssignment(tx, roleIDs, []int64{userID}); err != nil {
+			return err
+		}
+		var roles []model.Role
+		if err := tx.Where("id IN ?", roleIDs).Find(&roles).Error; err != nil {
+			return err
+		}
+		if err := checkUserRoles(tx, user, roleIDs); err != nil {
+			return err
+		}
+		return tx.Model(&user).Association("Roles").Replace(roles)
+	})
 }
 
 func (s *UserService) AssignOrganizations(userID int64, orgIDs []int64) error {
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// RegisterGorm 注册 GORM 回调，每条 SQL 生成一个 span，作为所在请求 span 的子 span。
+// 服务层需以 db.WithContext(ctx) 执行查询才能关联到请求；
+// span 只记录带占位符的 SQL，不记录参数值
+func RegisterGorm(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("*").Register("tracing:before_create", startSpan("create")); err != nil {
+		return err
+	}
+	if err := cb.Create().After("*").Register("tracing:after_create", endSpan); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("*").Register("tracing:before_query", startSpan("query")); err != nil {
+		return err
+	}
+	if err := cb.Query().After("*").Register("tracing:after_query", endSpan); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("*").Register("tracing:before_update", startSpan("update")); err != nil {
+		return err
+	}
+	if err := cb.Update().After("*").Register("tracing:after_update", endSpan); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("*").Register("tracing:before_delete", startSpan("delete")); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("*").Register("tracing:after_delete", endSpan); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("*").Register("tracing:before_row", startSpan("row")); err != nil {
+		return err
+	}
+	if err := cb.Row().After("*").Register("tracing:after_row", endSpan); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("*").Register("tracing:before_raw", startSpan("raw")); err != nil {
+		return err
+	}
+	return cb.Raw().After("*").Register("tracing:after_raw", endSpan)
+}
+
+func startSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		// 不在采样中的请求，以及没有上级 span 的 SQL（启动迁移、后台任务）不记录，避免产生大量孤立的 trace
+		if !trace.SpanFromContext(ctx).IsRecording() {
+			return
+		}
+		name := "gorm." + operation
+		if db.Statement.Table != "" {
+			name += " " + db.Statement.Table
+		}
+		_, span := otel.Tracer(ScopeName).Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(operation)),
+		)
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func endSpan(db *gorm.DB) {
+	v, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+	defer span.End()
+
+	if db.Statement.Table != "" {
+		span.SetAttributes(semconv.DBCollectionName(db.Statement.Table))
+	}
+	span.SetAttributes(
+		semconv.DBQueryText(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if err := db.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -11,17 +11,31 @@ import (
 type Claims struct {
 	UserID   int64  `json:"user_id"`
 	Username string `json:"username"`
+	// 会话ID（即刷新令牌族ID），同一次登录轮换出的访问令牌共享该值
+	SessionID string `json:"sid,omitempty"`
 	// 可选：在JWT中内嵌简化的菜单列表，便于前端快速恢复（不强依赖）
 	Menus any `json:"menus,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID int64, username string, cfg *config.Config) (string, error) {
+// AccessTokenTTL 访问令牌有效期
+func AccessTokenTTL(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.JWT.AccessExpireMinutes) * time.Minute
+}
+
+// RefreshTokenTTL 刷新令牌有效期
+func RefreshTokenTTL(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.JWT.RefreshExpireHours) * time.Hour
+}
+
+// GenerateJWT 签发短期访问令牌
+func GenerateJWT(userID int64, username, sessionID string, cfg *config.Config) (string, error) {
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(cfg.JWT.ExpireTime) * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL(cfg))),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	"strconv"
+)
+
+// RequestIDHeader 请求 ID 的请求头与响应头
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID 在 context 中记录请求 ID，服务层以 db.WithContext(ctx) 执行的 SQL 日志会带上该 ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom 读取 context 中的请求 ID，没有时返回空串
+func RequestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID 生成 32 位十六进制请求 ID
+func NewRequestID() string {
+	id, err := RandomToken(16)
+	if err != nil {
+		// 随机源不可用时退回雪花 ID，保证每个请求都有 ID
+		return "sf" + strconv.FormatInt(GenerateID(), 10)
+	}
+	return id
+}
+
+// ValidRequestID 客户端传入的请求 ID 只接受 1~64 位字母、数字、- 与 _，避免日志注入
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"十六进制", "0123456789abcdef0123456789abcdef", true},
+		{"UUID", "3f2c1a9e-8b7d-4c6e-9f01-23456789abcd", true},
+		{"字母数字下划线", "Req_ID-42", true},
+		{"单个字符", "a", true},
+		{"64 位", strings.Repeat("a", 64), true},
+		{"空串", "", false},
+		{"超过 64 位", strings.Repeat("a", 65), false},
+		{"换行注入", "abc\ninjected=1", false},
+		{"回车", "abc\r", false},
+		{"空格", "abc def", false},
+		{"引号", `abc"`, false},
+		{"等号", "a=b", false},
+		{"点与斜杠", "../etc", false},
+		{"非 ASCII", "请求", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidRequestID(tt.id); got != tt.want {
+				t.Errorf("ValidRequestID(%q) = %v，期望 %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	id := NewRequestID()
+	if len(id) != 32 || !ValidRequestID(id) {
+		t.Errorf("NewRequestID() = %q，期望 32 位合法 ID", id)
+	}
+	if NewRequestID() == id {
+		t.Error("两次生成的请求 ID 相同")
+	}
+}
+
+func TestRequestIDContext(t *testing.T) {
+	if got := RequestIDFrom(context.Background()); got != "" {
+		t.Errorf("未设置时 RequestIDFrom() = %q，期望空串", got)
+	}
+	ctx := WithRequestID(context.Background(), "req-1")
+	if got := RequestIDFrom(ctx); got != "req-1" {
+		t.Errorf("RequestIDFrom() = %q，期望 req-1", got)
+	}
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SheetWriter 逐行写出表格，用于导出大量数据时边查边写
+type SheetWriter interface {
+	// WriteRow 写入一行，整数与浮点数按数值写出，其余按文本
+	WriteRow(cells ...interface{}) error
+	// Close 写出剩余内容，不关闭底层 io.Writer
+	Close() error
+}
+
+// NewCSVWriter UTF-8 CSV，带 BOM 以便 Excel 正确识别中文
+func NewCSVWriter(w io.Writer) (SheetWriter, error) {
+	if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+		return nil, err
+	}
+	return &csvSheet{w: csv.NewWriter(w)}, nil
+}
+
+type csvSheet struct {
+	w    *csv.Writer
+	rows int
+}
+
+func (s *csvSheet) WriteRow(cells ...interface{}) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		text := cellText(cell)
+		// 防止以 = + - @ 开头的文本在 Excel 中被当作公式执行
+		if _, isText := cell.(string); isText && text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+			text = "'" + text
+		}
+		record[i] = text
+	}
+	if err := s.w.Write(record); err != nil {
+		return err
+	}
+	// 定期刷出，避免缓冲整份文件
+	if s.rows++; s.rows%500 == 0 {
+		s.w.Flush()
+	}
+	return s.w.Error()
+}
+
+func (s *csvSheet) Close() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// NewXLSXWriter 只含一个工作表的 .xlsx，单元格使用内联字符串，按行流式写入 zip
+func NewXLSXWriter(w io.Writer, sheetName string) (SheetWriter, error) {
+	zw := zip.NewWriter(w)
+	static := map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`,
+		"_rels/.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`,
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="` + xmlEscape(sheetName) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`,
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		f, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, static[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	// 工作表必须是最后一个条目，之后的行直接追加到其中
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := &xlsxSheet{zw: zw, w: bufio.NewWriter(f)}
+	_, err = sheet.w.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return sheet, err
+}
+
+type xlsxSheet struct {
+	zw   *zip.Writer
+	w    *bufio.Writer
+	rows int
+}
+
+func (s *xlsxSheet) WriteRow(cells ...interface{}) error {
+	s.rows++
+	fmt.Fprintf(s.w, `<row r="%d">`, s.rows)
+	for _, cell := range cells {
+		switch cell.(type) {
+		case int, int32, int64, uint, uint32, uint64, float32, float64:
+			fmt.Fprintf(s.w, `<c><v>%s</v></c>`, cellText(cell))
+		default:
+			fmt.Fprintf(s.w, `<c t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, xmlEscape(cellText(cell)))
+		}
+	}
+	_, err := s.w.WriteString(`</row>`)
+	return err
+}
+
+func (s *xlsxSheet) Close() error {
+	if _, err := s.w.WriteString(`</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.zw.Close()
+}
+
+func cellText(cell interface{}) string {
+	switch v := cell.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	// 去掉 XML 1.0 不允许的控制字符，否则 Excel 无法打开文件
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
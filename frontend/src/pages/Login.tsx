@@ -1,43 +1,318 @@
 import React, { useState } from 'react';
-import { Form, Input, Button, Card, message } from 'antd';
-import { UserOutlined, LockOutlined } from '@ant-design/icons';
+import { Form, Input, Button, Card, message, Modal, QRCode, Typography, Space, Alert } from 'antd';
+import { UserOutlined, LockOutlined, SafetyOutlined, KeyOutlined } from '@ant-design/icons';
 import { useAuthStore } from '../store/authStore';
 import { useDictStore } from '../store/dictStore';
-import { authService, LoginRequest } from '../services/auth';
+import {
+  authService,
+  LoginRequest,
+  LoginResponse,
+  LoginResult,
+  TwoFactorChallenge,
+  isTwoFactorRequired,
+  isPasswordExpired,
+} from '../services/auth';
 import { useMenuStore } from '../store/menuStore';
 
+// 登录步骤：账号密码 → 两步验证（可选）→ 修改过期密码（可选）
+type LoginStep =
+  | { kind: 'password' }
+  | { kind: 'twoFactor'; challenge: TwoFactorChallenge }
+  | { kind: 'changePassword'; ticket: string; message: string };
+
+interface TwoFactorForm {
+  code?: string;
+  recovery_code?: string;
+}
+
+interface ChangePasswordForm {
+  new_password: string;
+  confirm_password: string;
+}
+
+// 恢复码只在绑定完成时返回一次，确认保存后再继续
+const showRecoveryCodes = (codes: string[]) =>
+  new Promise<void>((resolve) => {
+    Modal.info({
+      title: '请保存恢复码',
+      width: 460,
+      content: (
+        <div>
+          <p>两步验证已启用。手机不可用时可使用以下恢复码登录，每个只能使用一次，关闭后将不再显示。</p>
+          <Typography.Paragraph copyable={{ text: codes.join('\n') }}>
+            <pre style={{ margin: 0 }}>{codes.join('\n')}</pre>
+          </Typography.Paragraph>
+        </div>
+      ),
+      okText: '我已保存',
+      onOk: () => resolve(),
+    });
+  });
+
 const Login: React.FC = () => {
   const [loading, setLoading] = useState(false);
+  const [step, setStep] = useState<LoginStep>({ kind: 'password' });
+  const [useRecoveryCode, setUseRecoveryCode] = useState(false);
   const { login } = useAuthStore();
   const { setMenus } = useMenuStore();
   const { loadAllDicts } = useDictStore();
 
-  const onLogin = async (values: LoginRequest) => {
-    setLoading(true);
+  const completeLogin = async (response: LoginResponse) => {
+    if (response.recovery_codes && response.recovery_codes.length > 0) {
+      await showRecoveryCodes(response.recovery_codes);
+    }
+    login(response.token, response.refresh_token, response.user);
+    if (response.menus && Array.isArray(response.menus)) {
+      setMenus(response.menus as any, response.menus_version);
+    }
+
+    // 登录成功后加载字典数据
     try {
-      const response = await authService.login(values);
-      login(response.token, response.user);
-      if (response.menus && Array.isArray(response.menus)) {
-        setMenus(response.menus as any);
-      }
-      
-      // 登录成功后加载字典数据
-      try {
-        await loadAllDicts();
-      } catch (dictError) {
-        console.warn('加载字典数据失败:', dictError);
-        // 字典加载失败不影响登录流程
+      await loadAllDicts();
+    } catch (dictError) {
+      console.warn('加载字典数据失败:', dictError);
+      // 字典加载失败不影响登录流程
+    }
+
+    message.success('登录成功');
+  };
+
+  // 按登录接口的返回进入下一步，只有拿到令牌才算登录成功
+  const handleResult = async (result: LoginResult) => {
+    if (isTwoFactorRequired(result)) {
+      setUseRecoveryCode(false);
+      setStep({ kind: 'twoFactor', challenge: result.challenge });
+      return;
+    }
+    if (isPasswordExpired(result)) {
+      if (result.recovery_codes && result.recovery_codes.length > 0) {
+        await showRecoveryCodes(result.recovery_codes);
       }
-      
-      message.success('登录成功');
+      setStep({ kind: 'changePassword', ticket: result.change_ticket, message: result.message });
+      return;
+    }
+    await completeLogin(result);
+  };
+
+  const submit = async (request: () => Promise<LoginResult>, fallback: string) => {
+    setLoading(true);
+    try {
+      await handleResult(await request());
     } catch (error: any) {
-      message.error(error.response?.data?.error || '登录失败');
+      const data = error.response?.data;
+      const violations: string[] | undefined = data?.violations;
+      // 验证码错误时停留在当前步骤；票据过期或尝试次数过多时提示信息会要求返回重新登录
+      message.error(violations && violations.length > 0 ? violations.join('；') : data?.error || fallback);
     } finally {
       setLoading(false);
     }
   };
 
+  const onLogin = (values: LoginRequest) => submit(() => authService.login(values), '登录失败');
+
+  const onTwoFactor = (values: TwoFactorForm) => {
+    if (step.kind !== 'twoFactor') return;
+    const ticket = step.challenge.ticket;
+    return submit(
+      () =>
+        authService.loginTwoFactor(
+          useRecoveryCode ? { ticket, recovery_code: values.recovery_code } : { ticket, code: values.code }
+        ),
+      '验证失败'
+    );
+  };
+
+  const onChangePassword = (values: ChangePasswordForm) => {
+    if (step.kind !== 'changePassword') return;
+    return submit(
+      () => authService.changeExpiredPassword({ ticket: step.ticket, new_password: values.new_password }),
+      '修改密码失败'
+    );
+  };
+
+  const backToPassword = () => setStep({ kind: 'password' });
 
+  const renderPasswordStep = () => (
+    <Form
+      name="login"
+      onFinish={onLogin}
+      autoComplete="off"
+    >
+      <Form.Item
+        name="username"
+        rules={[{ required: true, message: '请输入用户名' }]}
+      >
+        <Input
+          prefix={<UserOutlined />}
+          placeholder="用户名"
+          size="large"
+        />
+      </Form.Item>
+
+      <Form.Item
+        name="password"
+        rules={[{ required: true, message: '请输入密码' }]}
+      >
+        <Input.Password
+          prefix={<LockOutlined />}
+          placeholder="密码"
+          size="large"
+        />
+      </Form.Item>
+
+      <Form.Item>
+        <Button
+          type="primary"
+          htmlType="submit"
+          loading={loading}
+          size="large"
+          block
+        >
+          登录
+        </Button>
+      </Form.Item>
+    </Form>
+  );
+
+  const renderTwoFactorStep = (challenge: TwoFactorChallenge) => (
+    <Form
+      name="login-2fa"
+      onFinish={onTwoFactor}
+      autoComplete="off"
+    >
+      {challenge.enrollment_required ? (
+        <>
+          <Alert
+            type="info"
+            showIcon
+            style={{ marginBottom: 16 }}
+            message="所属角色要求启用两步验证"
+            description="请使用身份验证器 App 扫描二维码（或手动输入密钥），然后输入 App 显示的 6 位验证码完成绑定。"
+          />
+          <Space direction="vertical" align="center" style={{ width: '100%', marginBottom: 16 }}>
+            {challenge.otpauth_uri && <QRCode value={challenge.otpauth_uri} />}
+            {challenge.secret && (
+              <Typography.Text copyable={{ text: challenge.secret }} code>
+                {challenge.secret}
+              </Typography.Text>
+            )}
+          </Space>
+        </>
+      ) : (
+        <p>{useRecoveryCode ? '请输入一个未使用过的恢复码' : '请输入身份验证器 App 显示的 6 位验证码'}</p>
+      )}
+
+      {useRecoveryCode ? (
+        <Form.Item
+          name="recovery_code"
+          rules={[{ required: true, message: '请输入恢复码' }]}
+        >
+          <Input
+            prefix={<KeyOutlined />}
+            placeholder="恢复码"
+            size="large"
+          />
+        </Form.Item>
+      ) : (
+        <Form.Item
+          name="code"
+          rules={[{ required: true, pattern: /^\d{6}$/, message: '请输入 6 位验证码' }]}
+        >
+          <Input
+            prefix={<SafetyOutlined />}
+            placeholder="验证码"
+            size="large"
+            maxLength={6}
+            inputMode="numeric"
+            autoComplete="one-time-code"
+            autoFocus
+          />
+        </Form.Item>
+      )}
+
+      <Form.Item>
+        <Button
+          type="primary"
+          htmlType="submit"
+          loading={loading}
+          size="large"
+          block
+        >
+          {challenge.enrollment_required ? '绑定并登录' : '验证'}
+        </Button>
+      </Form.Item>
+
+      <Space style={{ width: '100%', justifyContent: 'space-between' }}>
+        <Button type="link" style={{ padding: 0 }} onClick={backToPassword}>
+          返回重新登录
+        </Button>
+        {!challenge.enrollment_required && (
+          <Button type="link" style={{ padding: 0 }} onClick={() => setUseRecoveryCode(!useRecoveryCode)}>
+            {useRecoveryCode ? '使用验证码' : '使用恢复码'}
+          </Button>
+        )}
+      </Space>
+    </Form>
+  );
+
+  const renderChangePasswordStep = (notice: string) => (
+    <Form
+      name="login-change-password"
+      onFinish={onChangePassword}
+      autoComplete="off"
+    >
+      <Alert type="warning" showIcon message={notice} style={{ marginBottom: 16 }} />
+
+      <Form.Item
+        name="new_password"
+        rules={[{ required: true, message: '请输入新密码' }]}
+      >
+        <Input.Password
+          prefix={<LockOutlined />}
+          placeholder="新密码"
+          size="large"
+          autoComplete="new-password"
+        />
+      </Form.Item>
+
+      <Form.Item
+        name="confirm_password"
+        dependencies={['new_password']}
+        rules={[
+          { required: true, message: '请再次输入新密码' },
+          ({ getFieldValue }) => ({
+            validator: (_, value) =>
+              !value || getFieldValue('new_password') === value
+                ? Promise.resolve()
+                : Promise.reject(new Error('两次输入的密码不一致')),
+          }),
+        ]}
+      >
+        <Input.Password
+          prefix={<LockOutlined />}
+          placeholder="确认新密码"
+          size="large"
+          autoComplete="new-password"
+        />
+      </Form.Item>
+
+      <Form.Item>
+        <Button
+          type="primary"
+          htmlType="submit"
+          loading={loading}
+          size="large"
+          block
+        >
+          修改密码并登录
+        </Button>
+      </Form.Item>
+
+      <Button type="link" style={{ padding: 0 }} onClick={backToPassword}>
+        返回重新登录
+      </Button>
+    </Form>
+  );
 
   return (
     <div style={{
@@ -54,45 +329,9 @@ const Login: React.FC = () => {
           header: { textAlign: 'center', fontSize: '24px', fontWeight: 'bold' }
         }}
       >
-        <Form
-          name="login"
-          onFinish={onLogin}
-          autoComplete="off"
-        >
-          <Form.Item
-            name="username"
-            rules={[{ required: true, message: '请输入用户名' }]}
-          >
-            <Input
-              prefix={<UserOutlined />}
-              placeholder="用户名"
-              size="large"
-            />
-          </Form.Item>
-
-          <Form.Item
-            name="password"
-            rules={[{ required: true, message: '请输入密码' }]}
-          >
-            <Input.Password
-              prefix={<LockOutlined />}
-              placeholder="密码"
-              size="large"
-            />
-          </Form.Item>
-
-          <Form.Item>
-            <Button
-              type="primary"
-              htmlType="submit"
-              loading={loading}
-              size="large"
-              block
-            >
-              登录
-            </Button>
-          </Form.Item>
-        </Form>
+        {step.kind === 'password' && renderPasswordStep()}
+        {step.kind === 'twoFactor' && renderTwoFactorStep(step.challenge)}
+        {step.kind === 'changePassword' && renderChangePasswordStep(step.message)}
       </Card>
     </div>
   );
@@ -1,5 +1,6 @@
 import axios from 'axios';
 import { useAuthStore } from '../store/authStore';
+import { useMenuStore } from '../store/menuStore';
 
 const api = axios.create({
   baseURL: '/api/v1',
@@ -25,19 +26,76 @@ api.interceptors.request.use(
   }
 );
 
+// 刷新中的请求共享同一个 Promise，避免并发请求重复轮换刷新令牌
+let refreshing: Promise<string> | null = null;
+
+const refreshAccessToken = (): Promise<string> => {
+  if (!refreshing) {
+    const { refreshToken, setTokens } = useAuthStore.getState();
+    refreshing = axios
+      .post('/api/v1/auth/refresh', { refresh_token: refreshToken })
+      .then((res) => {
+        // 密码已过期时服务端注销会话、不再续期，需回到登录页修改密码
+        if (res.data.password_expired) {
+          throw new Error(res.data.message || '密码已过期');
+        }
+        setTokens(res.data.token, res.data.refresh_token);
+        return res.data.token as string;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
+// 角色或菜单绑定变化后服务端递增菜单版本号，发现变化时重新拉取一次菜单
+let reloadingMenus = false;
+
+const syncMenusVersion = (header: unknown) => {
+  if (header === undefined || header === null || reloadingMenus) {
+    return;
+  }
+  const version = Number(header);
+  if (Number.isNaN(version) || version === useMenuStore.getState().menusVersion) {
+    return;
+  }
+  reloadingMenus = true;
+  api
+    .get('/profile/menus')
+    .then((res) => {
+      useMenuStore.getState().setMenus(res.data.menus, res.data.menus_version);
+    })
+    .catch((error) => {
+      console.warn('刷新菜单失败:', error);
+    })
+    .finally(() => {
+      reloadingMenus = false;
+    });
+};
+
 // 响应拦截器
 api.interceptors.response.use(
   (response) => {
-    // 读取后台下发的新 token 并更新本地存储
-    const refreshed = response.headers['x-refresh-token'];
-    if (refreshed && typeof refreshed === 'string' && refreshed.length > 0) {
-      const { setToken } = useAuthStore.getState();
-      setToken(refreshed);
-    }
+    syncMenusVersion(response.headers['x-menus-version']);
     return response;
   },
-  (error) => {
-    if (error.response?.status === 401) {
+  async (error) => {
+    const original = error.config;
+    const isAuthRequest = original?.url?.startsWith('/auth/');
+    if (error.response?.status === 401 && original && !original._retry && !isAuthRequest) {
+      if (useAuthStore.getState().refreshToken) {
+        original._retry = true;
+        try {
+          const token = await refreshAccessToken();
+          original.headers.Authorization = `Bearer ${token}`;
+          return api(original);
+        } catch (refreshError) {
+          console.warn('刷新令牌失败:', refreshError);
+        }
+      }
+    }
+    if (error.response?.status === 401 && !isAuthRequest) {
       useAuthStore.getState().logout();
       window.location.href = '/login';
     }
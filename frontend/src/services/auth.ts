@@ -7,6 +7,10 @@ export interface LoginRequest {
 
 export interface LoginResponse {
   token: string;
+  refresh_token: string;
+  expires_in: number;
+  refresh_expires_in: number;
+  menus_version: number;
   user: {
     id: number;
     username: string;
@@ -15,15 +19,66 @@ export interface LoginResponse {
     avatar: string;
   };
   menus?: import('./menu').Menu[]; // 后端在登录时返回的用户菜单列表（可选）
+  recovery_codes?: string[]; // 登录时完成两步验证绑定才会返回，只展示这一次
 }
 
+// 密码校验通过后需要第二步验证
+export interface TwoFactorChallenge {
+  ticket: string;
+  expires_in: number;
+  enrollment_required: boolean; // 角色要求但尚未绑定，需先扫码绑定
+  secret?: string;
+  otpauth_uri?: string;
+}
+
+export interface TwoFactorRequiredResponse {
+  two_factor_required: true;
+  challenge: TwoFactorChallenge;
+}
+
+// 密码已过期，需凭改密票据设置新密码后才能登录
+export interface PasswordExpiredResponse {
+  password_expired: true;
+  change_ticket: string;
+  message: string;
+  recovery_codes?: string[];
+}
+
+export type LoginResult = LoginResponse | TwoFactorRequiredResponse | PasswordExpiredResponse;
+
+export interface LoginTwoFactorRequest {
+  ticket: string;
+  code?: string;
+  recovery_code?: string;
+}
+
+export interface ChangeExpiredPasswordRequest {
+  ticket: string;
+  new_password: string;
+}
+
+export const isTwoFactorRequired = (result: LoginResult): result is TwoFactorRequiredResponse =>
+  'two_factor_required' in result && result.two_factor_required === true;
+
+export const isPasswordExpired = (result: LoginResult): result is PasswordExpiredResponse =>
+  'password_expired' in result && result.password_expired === true;
 
 export const authService = {
-  login: async (data: LoginRequest): Promise<LoginResponse> => {
+  login: async (data: LoginRequest): Promise<LoginResult> => {
     const response = await api.post('/auth/login', data);
     return response.data;
   },
 
+  loginTwoFactor: async (data: LoginTwoFactorRequest): Promise<LoginResult> => {
+    const response = await api.post('/auth/login/2fa', data);
+    return response.data;
+  },
+
+  changeExpiredPassword: async (data: ChangeExpiredPasswordRequest): Promise<LoginResult> => {
+    const response = await api.post('/auth/login/change-password', data);
+    return response.data;
+  },
+
 
   logout: async (): Promise<void> => {
     await api.post('/auth/logout');
@@ -14,8 +14,9 @@ interface AuthState {
   isAuthenticated: boolean;
   user: User | null;
   token: string | null;
-  login: (token: string, user: User) => void;
-  setToken: (token: string) => void;
+  refreshToken: string | null;
+  login: (token: string, refreshToken: string, user: User) => void;
+  setTokens: (token: string, refreshToken: string) => void;
   logout: () => Promise<void>;
   updateUser: (user: User) => void;
 }
@@ -26,11 +27,12 @@ export const useAuthStore = create<AuthState>()(
       isAuthenticated: false,
       user: null,
       token: null,
-      login: (token: string, user: User) => {
-        set({ isAuthenticated: true, token, user });
+      refreshToken: null,
+      login: (token: string, refreshToken: string, user: User) => {
+        set({ isAuthenticated: true, token, refreshToken, user });
       },
-      setToken: (token: string) => {
-        set({ token });
+      setTokens: (token: string, refreshToken: string) => {
+        set({ token, refreshToken });
       },
       logout: async () => {
         try {
@@ -38,7 +40,7 @@ export const useAuthStore = create<AuthState>()(
         } catch (error) {
           console.warn('调用退出登录接口失败:', error);
         }
-        set({ isAuthenticated: false, token: null, user: null });
+        set({ isAuthenticated: false, token: null, refreshToken: null, user: null });
       },
       updateUser: (user: User) => {
         set({ user });
@@ -3,7 +3,8 @@ import { Menu } from '../services/menu';
 
 interface MenuState {
   userMenus: Menu[];
-  setMenus: (menus: Menu[]) => void;
+  menusVersion: number;
+  setMenus: (menus: Menu[], version?: number) => void;
   loadUserMenus: () => Promise<void>;
   clearMenus: () => void;
 }
@@ -11,18 +12,22 @@ interface MenuState {
 // 菜单缓存键
 const MENU_CACHE_KEY = 'user_menus_cache';
 const CACHE_EXPIRY_KEY = 'user_menus_cache_expiry';
+const VERSION_KEY = 'user_menus_version';
 const CACHE_DURATION = 5 * 60 * 1000; // 5分钟缓存
 
 export const useMenuStore = create<MenuState>((set, get) => ({
   userMenus: [],
-  setMenus: (menus: Menu[]) => {
+  menusVersion: Number(localStorage.getItem(VERSION_KEY) || 0),
+  setMenus: (menus: Menu[], version?: number) => {
+    const menusVersion = version ?? get().menusVersion;
     try {
       localStorage.setItem(MENU_CACHE_KEY, JSON.stringify(menus));
       localStorage.setItem(CACHE_EXPIRY_KEY, (Date.now() + CACHE_DURATION).toString());
+      localStorage.setItem(VERSION_KEY, menusVersion.toString());
     } catch (error) {
       console.warn('保存菜单缓存失败:', error);
     }
-    set({ userMenus: menus });
+    set({ userMenus: menus, menusVersion });
   },
 
   loadUserMenus: async () => {
@@ -57,10 +62,11 @@ export const useMenuStore = create<MenuState>((set, get) => ({
     try {
       localStorage.removeItem(MENU_CACHE_KEY);
       localStorage.removeItem(CACHE_EXPIRY_KEY);
+      localStorage.removeItem(VERSION_KEY);
     } catch (error) {
       console.warn('清除菜单缓存失败:', error);
     }
     
-    set({ userMenus: [] });
+    set({ userMenus: [], menusVersion: 0 });
   },
 }));